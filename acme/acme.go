@@ -3,10 +3,16 @@ package acme
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"io"
 	"log/slog"
+	"net/http"
+	"os"
 	"time"
 
 	"github.com/caddyserver/certmagic"
+	"github.com/mholt/acmez/v3/acme"
+	"github.com/roadrunner-server/errors"
 )
 
 type challenge string
@@ -14,41 +20,122 @@ type challenge string
 const (
 	HTTP01    challenge = "http-01"
 	TLSAlpn01 challenge = "tlsalpn-01"
+	DNS01     challenge = "dns-01"
 )
 
-func IssueCertificates(cacheDir, email, challengeType string, domains []string, useProduction bool, altHTTPPort, altTLSAlpnPort int, log *slog.Logger) (*tls.Config, error) {
+var keyTypes = map[string]certmagic.KeyType{
+	"p256":    certmagic.P256,
+	"p384":    certmagic.P384,
+	"rsa2048": certmagic.RSA2048,
+	"rsa4096": certmagic.RSA4096,
+}
+
+// Certificates are the managed certificates, issued once and shared by the https and http3 servers.
+type Certificates struct {
+	TLSConfig *tls.Config
+	Stats     *Stats
+
+	cache   *certmagic.Cache
+	storage certmagic.Storage
+}
+
+// Close stops the certificates maintenance and closes the storage client.
+func (c *Certificates) Close() error {
+	c.cache.Stop()
+
+	if closer, ok := c.storage.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+// IssueCertificates obtains and manages the configured certificates. The handler serves
+// on-demand ask checks configured as a workers path.
+func IssueCertificates(acmeCfg *Config, handler http.Handler, log *slog.Logger) (*Certificates, error) {
+	var keySource certmagic.KeyGenerator
+	if acmeCfg.KeyType != "" {
+		keySource = certmagic.StandardKeyGenerator{KeyType: keyTypes[acmeCfg.KeyType]}
+	}
+
+	storage, err := NewStorage(acmeCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var stats *Stats
 	cache := certmagic.NewCache(certmagic.CacheOptions{
 		GetConfigForCert: func(_ certmagic.Certificate) (*certmagic.Config, error) {
 			return &certmagic.Config{
-				Storage: &certmagic.FileStorage{Path: cacheDir},
+				Storage:   storage,
+				KeySource: keySource,
+				OnEvent:   stats.onEvent,
 			}, nil
 		},
 	})
+	stats = newStats(cache)
+	// closed on the errors below to stop the cache maintenance and the storage client
+	certs := &Certificates{Stats: stats, cache: cache, storage: storage}
 
 	cfg := certmagic.New(cache, certmagic.Config{
-		Storage: &certmagic.FileStorage{Path: cacheDir},
+		Storage:   storage,
+		KeySource: keySource,
+		OnEvent:   stats.onEvent,
 	})
 
 	myAcme := certmagic.NewACMEIssuer(cfg, certmagic.ACMEIssuer{
 		CA:                certmagic.LetsEncryptProductionCA,
 		TestCA:            certmagic.LetsEncryptStagingCA,
-		Email:             email,
+		Email:             acmeCfg.Email,
 		Agreed:            true,
 		ListenHost:        "0.0.0.0",
-		AltHTTPPort:       altHTTPPort,
-		AltTLSALPNPort:    altTLSAlpnPort,
+		AltHTTPPort:       acmeCfg.AltHTTPPort,
+		AltTLSALPNPort:    acmeCfg.AltTLSALPNPort,
 		CertObtainTimeout: time.Second * 240,
 	})
 
-	if !useProduction {
+	switch {
+	case acmeCfg.DirectoryURL != "":
+		// retries should not fall back to the Let's Encrypt staging
+		myAcme.CA = acmeCfg.DirectoryURL
+		myAcme.TestCA = ""
+	case !acmeCfg.UseProductionEndpoint:
 		myAcme.CA = certmagic.LetsEncryptStagingCA
 	}
 
-	switch challenge(challengeType) {
+	if acmeCfg.EABKeyID != "" {
+		myAcme.ExternalAccount = &acme.EAB{
+			KeyID:  acmeCfg.EABKeyID,
+			MACKey: acmeCfg.EABHMAC,
+		}
+	}
+
+	if acmeCfg.TrustedRootCA != "" {
+		roots, err := trustedRoots(acmeCfg.TrustedRootCA)
+		if err != nil {
+			_ = certs.Close()
+			return nil, err
+		}
+
+		myAcme.TrustedRoots = roots
+	}
+
+	switch challenge(acmeCfg.ChallengeType) {
 	case HTTP01:
 		myAcme.DisableTLSALPNChallenge = true
 	case TLSAlpn01:
 		myAcme.DisableHTTPChallenge = true
+	case DNS01:
+		solver, err := dnsSolver(acmeCfg.DNS)
+		if err != nil {
+			_ = certs.Close()
+			return nil, err
+		}
+
+		myAcme.DisableHTTPChallenge = true
+		myAcme.DisableTLSALPNChallenge = true
+		myAcme.DNS01Solver = solver
+		log.Debug("acme dns-01 challenge", "provider", acmeCfg.DNS.Provider)
 	default:
 		// default - http
 		myAcme.DisableTLSALPNChallenge = true
@@ -56,17 +143,44 @@ func IssueCertificates(cacheDir, email, challengeType string, domains []string,
 
 	cfg.Issuers = append(cfg.Issuers, myAcme)
 
-	for _, domain := range domains {
-		err := cfg.ObtainCertAsync(context.Background(), domain)
+	if acmeCfg.OnDemand != nil {
+		od := newOnDemand(acmeCfg.OnDemand, acmeCfg.Domains, handler)
+		cfg.OnDemand = &certmagic.OnDemandConfig{DecisionFunc: od.decide}
+		log.Debug("acme on-demand issuance enabled", "ask", acmeCfg.OnDemand.Ask)
+	}
+
+	for _, domain := range acmeCfg.Domains {
+		err = cfg.ObtainCertAsync(context.Background(), domain)
 		if err != nil {
+			_ = certs.Close()
 			return nil, err
 		}
 	}
 
-	err := cfg.ManageSync(context.Background(), domains)
+	err = cfg.ManageSync(context.Background(), acmeCfg.Domains)
 	if err != nil {
+		_ = certs.Close()
 		return nil, err
 	}
 
-	return cfg.TLSConfig(), nil
+	certs.TLSConfig = cfg.TLSConfig()
+
+	return certs, nil
+}
+
+// trustedRoots loads the PEM bundle used to verify the ACME server.
+func trustedRoots(path string) (*x509.CertPool, error) {
+	const op = errors.Op("acme_trusted_roots")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.E(op, errors.Errorf("no certificates found in '%s'", path))
+	}
+
+	return pool, nil
 }
@@ -1,6 +1,13 @@
 package acme
 
 import (
+	"encoding/base64"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
 	"github.com/roadrunner-server/errors"
 )
 
@@ -9,16 +16,118 @@ type Config struct {
 	CacheDir string `mapstructure:"cache_dir"`
 	// User email, mandatory
 	Email string `mapstructure:"email"`
-	// supported values: http-01, tlsalpn-01
+	// supported values: http-01, tlsalpn-01, dns-01
 	ChallengeType string `mapstructure:"challenge_type"`
 	// The alternate port to use for the ACME HTTP challenge
 	AltHTTPPort int `mapstructure:"alt_http_port"`
 	// The alternate port to use for the ACME TLS-ALPN
 	AltTLSALPNPort int `mapstructure:"alt_tlsalpn_port"`
-	// Use LE production endpoint or staging
+	// Use LE production endpoint or staging, ignored when DirectoryURL is set
 	UseProductionEndpoint bool `mapstructure:"use_production_endpoint"`
+	// DirectoryURL of a custom ACME server (ZeroSSL, step-ca, Pebble, etc.), Let's Encrypt by default
+	DirectoryURL string `mapstructure:"directory_url"`
+	// EABKeyID is the key identifier of the external account binding
+	EABKeyID string `mapstructure:"eab_kid"`
+	// EABHMAC is the base64url encoded HMAC key of the external account binding
+	EABHMAC string `mapstructure:"eab_hmac"`
+	// TrustedRootCA is a PEM bundle used to verify the ACME server certificate, system roots by default
+	TrustedRootCA string `mapstructure:"trusted_root_ca"`
+	// KeyType of the certificates private key: p256 (default), p384, rsa2048, rsa4096
+	KeyType string `mapstructure:"key_type"`
 	// Domains to obtain certificates
 	Domains []string `mapstructure:"domains"`
+	// DNS provider for the dns-01 challenge
+	DNS *DNSConfig `mapstructure:"dns"`
+	// Storage for the certificates, account keys and challenge tokens, files in CacheDir by default
+	Storage *StorageConfig `mapstructure:"storage"`
+	// OnDemand issues certificates for unknown SNI names during the handshake
+	OnDemand *OnDemandConfig `mapstructure:"on_demand"`
+}
+
+// StorageConfig configures the certificates storage shared by a cluster.
+type StorageConfig struct {
+	// Driver: file (default) or redis
+	Driver string `mapstructure:"driver"`
+	// Redis storage configuration
+	Redis *RedisStorageConfig `mapstructure:"redis"`
+	// LockTTL is the time after which a lock of a crashed node expires, 1m by default
+	LockTTL time.Duration `mapstructure:"lock_ttl"`
+	// LockPollInterval is the interval between attempts to acquire a busy lock, 1s by default
+	LockPollInterval time.Duration `mapstructure:"lock_poll_interval"`
+}
+
+// RedisStorageConfig configures the Redis (standalone or cluster) storage.
+type RedisStorageConfig struct {
+	// Addrs of the Redis nodes (host:port)
+	Addrs []string `mapstructure:"addrs"`
+	// Username for the ACL authentication
+	Username string `mapstructure:"username"`
+	// Password for the authentication
+	Password string `mapstructure:"password"`
+	// DB number, not supported by the cluster
+	DB int `mapstructure:"db"`
+	// Prefix of the keys, rr_acme by default
+	Prefix string `mapstructure:"prefix"`
+}
+
+// OnDemandConfig configures on-demand certificates issuance.
+type OnDemandConfig struct {
+	// Ask is an http(s) URL or a path (starting with /) served by the workers, called with the domain query parameter.
+	// 200 allows the issuance, 4xx denies it.
+	Ask string `mapstructure:"ask"`
+	// Timeout of the ask call, 5s by default
+	Timeout time.Duration `mapstructure:"timeout"`
+	// RateLimit is the maximum number of ask checks (and so issuances) per RateInterval, 10 by default
+	RateLimit int `mapstructure:"rate_limit"`
+	// RateInterval is the rate limit window, 1m by default
+	RateInterval time.Duration `mapstructure:"rate_interval"`
+	// DenyTTL is how long a denied domain is rejected without asking again, 5m by default
+	DenyTTL time.Duration `mapstructure:"deny_ttl"`
+}
+
+// DNSConfig configures the DNS provider used to solve the dns-01 challenge.
+type DNSConfig struct {
+	// Provider name, supported values: rfc2136, exec
+	Provider string `mapstructure:"provider"`
+	// RFC2136 dynamic updates provider configuration
+	RFC2136 *RFC2136Config `mapstructure:"rfc2136"`
+	// Exec hook provider configuration
+	Exec *ExecConfig `mapstructure:"exec"`
+	// TTL of the challenge TXT records, 2m by default
+	TTL time.Duration `mapstructure:"ttl"`
+	// PropagationDelay to wait before the propagation checks
+	PropagationDelay time.Duration `mapstructure:"propagation_delay"`
+	// PropagationTimeout is the maximum time to wait for the record to appear, 2m by default, -1 disables the checks
+	PropagationTimeout time.Duration `mapstructure:"propagation_timeout"`
+	// Resolvers used for the propagation checks (host:port), authoritative nameservers by default
+	Resolvers []string `mapstructure:"resolvers"`
+}
+
+// RFC2136Config configures DNS UPDATE (RFC 2136) requests to the primary nameserver.
+type RFC2136Config struct {
+	// Server is the nameserver address (host:port), the port defaults to 53
+	Server string `mapstructure:"server"`
+	// Network is udp (default) or tcp
+	Network string `mapstructure:"network"`
+	// TSIGKey is the name of the TSIG key
+	TSIGKey string `mapstructure:"tsig_key"`
+	// TSIGSecret is the base64 encoded TSIG secret
+	TSIGSecret string `mapstructure:"tsig_secret"`
+	// TSIGAlgorithm: hmac-sha1, hmac-sha256 (default), hmac-sha384, hmac-sha512
+	TSIGAlgorithm string `mapstructure:"tsig_algorithm"`
+	// Timeout of a single update request, 10s by default
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// ExecConfig configures a script invoked to add and remove the challenge records.
+// The script is called as: <command> [args...] <present|cleanup> <fqdn> <value> <ttl seconds>
+type ExecConfig struct {
+	// Command to execute
+	Command string `mapstructure:"command"`
+	// Args are passed before the action arguments
+	Args []string `mapstructure:"args"`
+	// Timeout of a single invocation, 30s by default
+	Timeout time.Duration `mapstructure:"timeout"`
 }
 
 func (ac *Config) InitDefaults() error {
@@ -30,10 +139,29 @@ func (ac *Config) InitDefaults() error {
 		return errors.Str("email could not be empty")
 	}
 
-	if len(ac.Domains) == 0 {
+	if len(ac.Domains) == 0 && ac.OnDemand == nil {
 		return errors.Str("should be at least 1 domain")
 	}
 
+	err := ac.validCA()
+	if err != nil {
+		return err
+	}
+
+	if ac.Storage != nil {
+		err = ac.Storage.InitDefaults()
+		if err != nil {
+			return err
+		}
+	}
+
+	if ac.OnDemand != nil {
+		err = ac.OnDemand.InitDefaults()
+		if err != nil {
+			return err
+		}
+	}
+
 	if ac.ChallengeType == "" {
 		ac.ChallengeType = "http-01"
 		if ac.AltHTTPPort == 0 {
@@ -41,5 +169,179 @@ func (ac *Config) InitDefaults() error {
 		}
 	}
 
+	if challenge(ac.ChallengeType) != DNS01 {
+		if slices.ContainsFunc(ac.Domains, func(d string) bool { return strings.HasPrefix(d, "*.") }) {
+			return errors.Str("wildcard domains could be issued only with the dns-01 challenge")
+		}
+
+		return nil
+	}
+
+	if ac.DNS == nil {
+		return errors.Str("dns-01 challenge requires the dns provider configuration")
+	}
+
+	return ac.DNS.InitDefaults()
+}
+
+func (sc *StorageConfig) InitDefaults() error {
+	if sc.Driver == "" {
+		sc.Driver = FileStorage
+	}
+
+	if sc.LockTTL == 0 {
+		sc.LockTTL = time.Minute
+	}
+
+	if sc.LockPollInterval == 0 {
+		sc.LockPollInterval = time.Second
+	}
+
+	if sc.LockTTL < 0 || sc.LockPollInterval < 0 {
+		return errors.Str("storage lock_ttl and lock_poll_interval could not be negative")
+	}
+
+	switch sc.Driver {
+	case FileStorage:
+	case RedisStorage:
+		if sc.Redis == nil || len(sc.Redis.Addrs) == 0 {
+			return errors.Str("redis storage requires at least one address")
+		}
+
+		if sc.Redis.Prefix == "" {
+			sc.Redis.Prefix = "rr_acme"
+		}
+	default:
+		return errors.Errorf("unknown storage driver '%s', supported: file, redis", sc.Driver)
+	}
+
+	return nil
+}
+
+func (oc *OnDemandConfig) InitDefaults() error {
+	if oc.Ask == "" {
+		return errors.Str("on_demand requires the ask URL or workers path")
+	}
+
+	u, err := url.Parse(oc.Ask)
+	if err != nil {
+		return errors.Errorf("malformed on_demand ask: %v", err)
+	}
+
+	isURL := (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+	isPath := u.Scheme == "" && u.Host == "" && strings.HasPrefix(u.Path, "/")
+	if !isURL && !isPath {
+		return errors.Errorf("on_demand ask '%s' should be an http(s) URL or a path starting with /", oc.Ask)
+	}
+
+	if oc.Timeout == 0 {
+		oc.Timeout = time.Second * 5
+	}
+
+	if oc.RateLimit == 0 {
+		oc.RateLimit = 10
+	}
+
+	if oc.RateInterval == 0 {
+		oc.RateInterval = time.Minute
+	}
+
+	if oc.DenyTTL == 0 {
+		oc.DenyTTL = time.Minute * 5
+	}
+
+	if oc.Timeout < 0 || oc.RateLimit < 0 || oc.RateInterval < 0 || oc.DenyTTL < 0 {
+		return errors.Str("on_demand timeout, rate_limit, rate_interval and deny_ttl could not be negative")
+	}
+
+	return nil
+}
+
+// validCA checks the ACME server, account binding and key options.
+func (ac *Config) validCA() error {
+	if ac.DirectoryURL != "" {
+		u, err := url.Parse(ac.DirectoryURL)
+		if err != nil {
+			return errors.Errorf("malformed directory_url: %v", err)
+		}
+
+		if u.Scheme != "https" || u.Host == "" {
+			return errors.Errorf("directory_url '%s' should be an absolute https URL", ac.DirectoryURL)
+		}
+	}
+
+	if (ac.EABKeyID == "") != (ac.EABHMAC == "") {
+		return errors.Str("eab_kid and eab_hmac should be set together")
+	}
+
+	if ac.EABHMAC != "" {
+		// ACME servers hand out the key both with and without padding
+		ac.EABHMAC = strings.TrimRight(ac.EABHMAC, "=")
+		if _, err := base64.RawURLEncoding.DecodeString(ac.EABHMAC); err != nil {
+			return errors.Errorf("eab_hmac should be base64url encoded: %v", err)
+		}
+	}
+
+	if ac.TrustedRootCA != "" {
+		if _, err := os.Stat(ac.TrustedRootCA); err != nil {
+			return errors.Errorf("trusted_root_ca: %v", err)
+		}
+	}
+
+	if ac.KeyType != "" {
+		if _, ok := keyTypes[ac.KeyType]; !ok {
+			return errors.Errorf("unsupported key_type '%s', supported: p256, p384, rsa2048, rsa4096", ac.KeyType)
+		}
+	}
+
+	return nil
+}
+
+func (dc *DNSConfig) InitDefaults() error {
+	if dc.TTL == 0 {
+		dc.TTL = time.Minute * 2
+	}
+
+	switch dc.Provider {
+	case RFC2136Provider:
+		if dc.RFC2136 == nil || dc.RFC2136.Server == "" {
+			return errors.Str("rfc2136 dns provider requires the server address")
+		}
+
+		if dc.RFC2136.Network == "" {
+			dc.RFC2136.Network = "udp"
+		}
+
+		if dc.RFC2136.Network != "udp" && dc.RFC2136.Network != "tcp" {
+			return errors.Errorf("unsupported rfc2136 network '%s', supported: udp, tcp", dc.RFC2136.Network)
+		}
+
+		if dc.RFC2136.Timeout == 0 {
+			dc.RFC2136.Timeout = time.Second * 10
+		}
+
+		if (dc.RFC2136.TSIGKey == "") != (dc.RFC2136.TSIGSecret == "") {
+			return errors.Str("rfc2136 tsig_key and tsig_secret should be set together")
+		}
+
+		if dc.RFC2136.TSIGAlgorithm == "" {
+			dc.RFC2136.TSIGAlgorithm = "hmac-sha256"
+		}
+
+		if _, ok := tsigAlgorithms[dc.RFC2136.TSIGAlgorithm]; !ok {
+			return errors.Errorf("unsupported rfc2136 tsig_algorithm '%s'", dc.RFC2136.TSIGAlgorithm)
+		}
+	case ExecProvider:
+		if dc.Exec == nil || dc.Exec.Command == "" {
+			return errors.Str("exec dns provider requires the command")
+		}
+
+		if dc.Exec.Timeout == 0 {
+			dc.Exec.Timeout = time.Second * 30
+		}
+	default:
+		return errors.Errorf("unknown dns provider '%s', supported: rfc2136, exec", dc.Provider)
+	}
+
 	return nil
 }
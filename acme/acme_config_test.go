@@ -1,8 +1,18 @@
 package acme
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestConfigInitDefaults(t *testing.T) {
@@ -84,3 +94,190 @@ func TestConfigInitDefaults(t *testing.T) {
 		})
 	}
 }
+
+func TestConfigInitDefaults_DNS01(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr string
+	}{
+		{
+			name:    "wildcard without dns-01",
+			cfg:     Config{Email: "a@b.c", Domains: []string{"*.x.com"}},
+			wantErr: "wildcard domains",
+		},
+		{
+			name:    "dns-01 without provider",
+			cfg:     Config{Email: "a@b.c", Domains: []string{"*.x.com"}, ChallengeType: "dns-01"},
+			wantErr: "requires the dns provider",
+		},
+		{
+			name:    "unknown provider",
+			cfg:     Config{Email: "a@b.c", Domains: []string{"x.com"}, ChallengeType: "dns-01", DNS: &DNSConfig{Provider: "route53"}},
+			wantErr: "unknown dns provider",
+		},
+		{
+			name:    "rfc2136 without server",
+			cfg:     Config{Email: "a@b.c", Domains: []string{"x.com"}, ChallengeType: "dns-01", DNS: &DNSConfig{Provider: "rfc2136", RFC2136: &RFC2136Config{}}},
+			wantErr: "requires the server address",
+		},
+		{
+			name: "rfc2136 half tsig",
+			cfg: Config{Email: "a@b.c", Domains: []string{"x.com"}, ChallengeType: "dns-01", DNS: &DNSConfig{
+				Provider: "rfc2136", RFC2136: &RFC2136Config{Server: "127.0.0.1", TSIGKey: "key"},
+			}},
+			wantErr: "should be set together",
+		},
+		{
+			name: "rfc2136 unknown tsig algorithm",
+			cfg: Config{Email: "a@b.c", Domains: []string{"x.com"}, ChallengeType: "dns-01", DNS: &DNSConfig{
+				Provider: "rfc2136", RFC2136: &RFC2136Config{Server: "127.0.0.1", TSIGAlgorithm: "hmac-md5"},
+			}},
+			wantErr: "unsupported rfc2136 tsig_algorithm",
+		},
+		{
+			name:    "exec without command",
+			cfg:     Config{Email: "a@b.c", Domains: []string{"x.com"}, ChallengeType: "dns-01", DNS: &DNSConfig{Provider: "exec", Exec: &ExecConfig{}}},
+			wantErr: "requires the command",
+		},
+		{
+			name: "wildcard with rfc2136",
+			cfg: Config{Email: "a@b.c", Domains: []string{"*.x.com", "x.com"}, ChallengeType: "dns-01", DNS: &DNSConfig{
+				Provider: "rfc2136", RFC2136: &RFC2136Config{Server: "127.0.0.1"},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			err := cfg.InitDefaults()
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.DNS.TTL != 2*time.Minute {
+				t.Errorf("TTL = %v, want 2m", cfg.DNS.TTL)
+			}
+			if cfg.DNS.RFC2136.Network != "udp" || cfg.DNS.RFC2136.TSIGAlgorithm != "hmac-sha256" {
+				t.Errorf("rfc2136 defaults = %+v", cfg.DNS.RFC2136)
+			}
+		})
+	}
+}
+
+func TestConfigInitDefaults_CustomCA(t *testing.T) {
+	roots := filepath.Join(t.TempDir(), "roots.pem")
+	if err := os.WriteFile(roots, []byte("pem"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr string
+	}{
+		{
+			name: "zerossl with eab",
+			cfg:  Config{DirectoryURL: "https://acme.zerossl.com/v2/DV90", EABKeyID: "kid", EABHMAC: "c2VjcmV0LWhtYWM=", KeyType: "rsa2048"},
+		},
+		{
+			name: "private ca with trusted root",
+			cfg:  Config{DirectoryURL: "https://localhost:14000/dir", TrustedRootCA: roots, KeyType: "p384"},
+		},
+		{
+			name:    "plain http directory",
+			cfg:     Config{DirectoryURL: "http://localhost:14000/dir"},
+			wantErr: "absolute https URL",
+		},
+		{
+			name:    "eab without hmac",
+			cfg:     Config{EABKeyID: "kid"},
+			wantErr: "should be set together",
+		},
+		{
+			name:    "eab hmac not base64url",
+			cfg:     Config{EABKeyID: "kid", EABHMAC: "not/base64+"},
+			wantErr: "base64url",
+		},
+		{
+			name:    "missing trusted root",
+			cfg:     Config{TrustedRootCA: filepath.Join(t.TempDir(), "absent.pem")},
+			wantErr: "trusted_root_ca",
+		},
+		{
+			name:    "unknown key type",
+			cfg:     Config{KeyType: "ed448"},
+			wantErr: "unsupported key_type",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			cfg.Email = "a@b.c"
+			cfg.Domains = []string{"x.com"}
+			err := cfg.InitDefaults()
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.HasSuffix(cfg.EABHMAC, "=") {
+				t.Errorf("EABHMAC = %q, want the padding stripped", cfg.EABHMAC)
+			}
+		})
+	}
+}
+
+func TestTrustedRoots(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "pebble root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "roots.pem")
+	garbage := filepath.Join(dir, "garbage.pem")
+	if err = os.WriteFile(valid, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(garbage, []byte("not a pem"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	pool, err := trustedRoots(valid)
+	if err != nil || pool == nil {
+		t.Fatalf("trustedRoots(valid) = %v, %v", pool, err)
+	}
+
+	if _, err = trustedRoots(garbage); err == nil || !strings.Contains(err.Error(), "no certificates found") {
+		t.Fatalf("error = %v, want no certificates found", err)
+	}
+}
@@ -0,0 +1,62 @@
+package acme
+
+import (
+	"github.com/caddyserver/certmagic"
+	"github.com/libdns/libdns"
+	"github.com/roadrunner-server/errors"
+)
+
+const (
+	RFC2136Provider string = "rfc2136"
+	ExecProvider    string = "exec"
+)
+
+// DNSProvider creates and removes the TXT records used to solve the dns-01 challenge.
+type DNSProvider interface {
+	libdns.RecordAppender
+	libdns.RecordDeleter
+}
+
+// NewDNSProvider returns the DNS provider configured in the dns section.
+func NewDNSProvider(cfg *DNSConfig) (DNSProvider, error) {
+	switch cfg.Provider {
+	case RFC2136Provider:
+		return &rfc2136Provider{cfg: cfg.RFC2136}, nil
+	case ExecProvider:
+		return &execProvider{cfg: cfg.Exec}, nil
+	default:
+		return nil, errors.Errorf("unknown dns provider '%s'", cfg.Provider)
+	}
+}
+
+func dnsSolver(cfg *DNSConfig) (*certmagic.DNS01Solver, error) {
+	provider, err := NewDNSProvider(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &certmagic.DNS01Solver{
+		DNSManager: certmagic.DNSManager{
+			DNSProvider:        provider,
+			TTL:                cfg.TTL,
+			PropagationDelay:   cfg.PropagationDelay,
+			PropagationTimeout: cfg.PropagationTimeout,
+			Resolvers:          cfg.Resolvers,
+		},
+	}, nil
+}
+
+// txtRecords filters the TXT records, other types are not used by the dns-01 challenge.
+func txtRecords(recs []libdns.Record) ([]libdns.TXT, error) {
+	txts := make([]libdns.TXT, 0, len(recs))
+	for _, rec := range recs {
+		rr := rec.RR()
+		if rr.Type != "TXT" {
+			return nil, errors.Errorf("unsupported record type '%s', only TXT records are supported", rr.Type)
+		}
+
+		txts = append(txts, libdns.TXT{Name: rr.Name, TTL: rr.TTL, Text: rr.Data})
+	}
+
+	return txts, nil
+}
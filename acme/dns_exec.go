@@ -0,0 +1,56 @@
+package acme
+
+import (
+	"context"
+	"os/exec"
+	"strconv"
+
+	"github.com/libdns/libdns"
+	"github.com/roadrunner-server/errors"
+)
+
+const (
+	execActionPresent = "present"
+	execActionCleanup = "cleanup"
+)
+
+// execProvider delegates the challenge records management to an external script.
+type execProvider struct {
+	cfg *ExecConfig
+}
+
+func (p *execProvider) AppendRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	return p.run(ctx, execActionPresent, zone, recs)
+}
+
+func (p *execProvider) DeleteRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	return p.run(ctx, execActionCleanup, zone, recs)
+}
+
+func (p *execProvider) run(ctx context.Context, action, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	const op = errors.Op("exec_dns_provider")
+
+	txts, err := txtRecords(recs)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	for _, txt := range txts {
+		fqdn := libdns.AbsoluteName(txt.Name, zone)
+		args := append(append(make([]string, 0, len(p.cfg.Args)+4), p.cfg.Args...),
+			action,
+			fqdn,
+			txt.Text,
+			strconv.Itoa(int(txt.TTL.Seconds())),
+		)
+
+		cmdCtx, cancel := context.WithTimeout(ctx, p.cfg.Timeout)
+		out, err := exec.CommandContext(cmdCtx, p.cfg.Command, args...).CombinedOutput() //nolint:gosec
+		cancel()
+		if err != nil {
+			return nil, errors.E(op, errors.Errorf("%s %s failed: %v, output: %s", action, fqdn, err, out))
+		}
+	}
+
+	return recordsOf(txts), nil
+}
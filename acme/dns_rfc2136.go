@@ -0,0 +1,135 @@
+package acme
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+	"github.com/roadrunner-server/errors"
+)
+
+// maximum length of a single TXT character-string
+const txtChunkSize = 255
+
+var tsigAlgorithms = map[string]string{
+	"hmac-sha1":   dns.HmacSHA1,
+	"hmac-sha256": dns.HmacSHA256,
+	"hmac-sha384": dns.HmacSHA384,
+	"hmac-sha512": dns.HmacSHA512,
+}
+
+// rfc2136Provider manages the challenge records via DNS UPDATE messages (RFC 2136), optionally signed with TSIG.
+type rfc2136Provider struct {
+	cfg *RFC2136Config
+}
+
+func (p *rfc2136Provider) AppendRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	const op = errors.Op("rfc2136_append_records")
+
+	txts, err := txtRecords(recs)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	msg := new(dns.Msg)
+	msg.SetUpdate(dns.Fqdn(zone))
+	msg.Insert(p.rrs(zone, txts))
+
+	err = p.exchange(ctx, msg)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	return recordsOf(txts), nil
+}
+
+func (p *rfc2136Provider) DeleteRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	const op = errors.Op("rfc2136_delete_records")
+
+	txts, err := txtRecords(recs)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	msg := new(dns.Msg)
+	msg.SetUpdate(dns.Fqdn(zone))
+	msg.Remove(p.rrs(zone, txts))
+
+	err = p.exchange(ctx, msg)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	return recordsOf(txts), nil
+}
+
+func (p *rfc2136Provider) rrs(zone string, txts []libdns.TXT) []dns.RR {
+	rrs := make([]dns.RR, 0, len(txts))
+	for _, txt := range txts {
+		rrs = append(rrs, &dns.TXT{
+			Hdr: dns.RR_Header{
+				Name:   dns.Fqdn(libdns.AbsoluteName(txt.Name, zone)),
+				Rrtype: dns.TypeTXT,
+				Class:  dns.ClassINET,
+				Ttl:    uint32(txt.TTL.Seconds()),
+			},
+			Txt: splitTXT(txt.Text),
+		})
+	}
+
+	return rrs
+}
+
+func (p *rfc2136Provider) exchange(ctx context.Context, msg *dns.Msg) error {
+	client := &dns.Client{
+		Net:     p.cfg.Network,
+		Timeout: p.cfg.Timeout,
+	}
+
+	if p.cfg.TSIGKey != "" {
+		key := dns.Fqdn(p.cfg.TSIGKey)
+		client.TsigSecret = map[string]string{key: p.cfg.TSIGSecret}
+		msg.SetTsig(key, tsigAlgorithms[p.cfg.TSIGAlgorithm], 300, time.Now().Unix())
+	}
+
+	reply, _, err := client.ExchangeContext(ctx, msg, serverAddr(p.cfg.Server))
+	if err != nil {
+		return err
+	}
+
+	if reply.Rcode != dns.RcodeSuccess {
+		return errors.Errorf("dns update was rejected by the server: %s", dns.RcodeToString[reply.Rcode])
+	}
+
+	return nil
+}
+
+// serverAddr appends the default DNS port if missing.
+func serverAddr(server string) string {
+	if _, _, err := net.SplitHostPort(server); err == nil {
+		return server
+	}
+
+	return net.JoinHostPort(server, "53")
+}
+
+func splitTXT(text string) []string {
+	chunks := make([]string, 0, len(text)/txtChunkSize+1)
+	for len(text) > txtChunkSize {
+		chunks = append(chunks, text[:txtChunkSize])
+		text = text[txtChunkSize:]
+	}
+
+	return append(chunks, text)
+}
+
+func recordsOf(txts []libdns.TXT) []libdns.Record {
+	recs := make([]libdns.Record, 0, len(txts))
+	for _, txt := range txts {
+		recs = append(recs, txt)
+	}
+
+	return recs
+}
@@ -0,0 +1,233 @@
+package acme
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+const (
+	testTSIGKey    = "rr-key."
+	testTSIGSecret = "c2VjcmV0LXNlY3JldC1zZWNyZXQtc2VjcmV0LTAxMjM="
+)
+
+// updateServer is a local nameserver accepting TSIG signed DNS UPDATE messages.
+type updateServer struct {
+	mu      sync.Mutex
+	updates []*dns.Msg
+	addr    string
+}
+
+func startUpdateServer(t *testing.T) *updateServer {
+	t.Helper()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	us := &updateServer{addr: pc.LocalAddr().String()}
+	started := make(chan struct{})
+	srv := &dns.Server{
+		PacketConn:        pc,
+		TsigSecret:        map[string]string{testTSIGKey: testTSIGSecret},
+		NotifyStartedFunc: func() { close(started) },
+		// the default accept func rejects UPDATE messages
+		MsgAcceptFunc: func(dns.Header) dns.MsgAcceptAction { return dns.MsgAccept },
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			m := new(dns.Msg)
+			m.SetReply(r)
+
+			switch {
+			case r.Opcode != dns.OpcodeUpdate:
+				m.Rcode = dns.RcodeNotImplemented
+			case r.IsTsig() == nil || w.TsigStatus() != nil:
+				m.Rcode = dns.RcodeNotAuth
+			default:
+				us.mu.Lock()
+				us.updates = append(us.updates, r)
+				us.mu.Unlock()
+				m.SetTsig(testTSIGKey, dns.HmacSHA256, 300, time.Now().Unix())
+			}
+
+			_ = w.WriteMsg(m)
+		}),
+	}
+
+	go func() { _ = srv.ActivateAndServe() }()
+	<-started
+	t.Cleanup(func() { _ = srv.Shutdown() })
+
+	return us
+}
+
+func (us *updateServer) received() []*dns.Msg {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	return us.updates
+}
+
+func rfc2136Config(addr, secret string) *DNSConfig {
+	cfg := &DNSConfig{
+		Provider: RFC2136Provider,
+		RFC2136: &RFC2136Config{
+			Server:     addr,
+			TSIGKey:    strings.TrimSuffix(testTSIGKey, "."),
+			TSIGSecret: secret,
+		},
+	}
+
+	return cfg
+}
+
+func TestRFC2136Provider_AppendAndDelete(t *testing.T) {
+	us := startUpdateServer(t)
+
+	cfg := rfc2136Config(us.addr, testTSIGSecret)
+	if err := cfg.InitDefaults(); err != nil {
+		t.Fatal(err)
+	}
+
+	provider, err := NewDNSProvider(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recs := []libdns.Record{libdns.TXT{Name: "_acme-challenge", TTL: time.Minute, Text: "token"}}
+
+	if _, err = provider.AppendRecords(context.Background(), "example.com.", recs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = provider.DeleteRecords(context.Background(), "example.com.", recs); err != nil {
+		t.Fatal(err)
+	}
+
+	updates := us.received()
+	if len(updates) != 2 {
+		t.Fatalf("updates = %d, want 2", len(updates))
+	}
+
+	for i, wantClass := range []uint16{dns.ClassINET, dns.ClassNONE} {
+		if updates[i].Question[0].Name != "example.com." {
+			t.Errorf("zone = %q, want example.com.", updates[i].Question[0].Name)
+		}
+
+		txt, ok := updates[i].Ns[0].(*dns.TXT)
+		if !ok {
+			t.Fatalf("update record = %T, want *dns.TXT", updates[i].Ns[0])
+		}
+		if txt.Hdr.Name != "_acme-challenge.example.com." || txt.Txt[0] != "token" {
+			t.Errorf("record = %s", txt)
+		}
+		if txt.Hdr.Class != wantClass {
+			t.Errorf("class = %d, want %d", txt.Hdr.Class, wantClass)
+		}
+	}
+}
+
+func TestRFC2136Provider_WrongTSIGRejected(t *testing.T) {
+	us := startUpdateServer(t)
+
+	cfg := rfc2136Config(us.addr, "d3Jvbmctc2VjcmV0")
+	if err := cfg.InitDefaults(); err != nil {
+		t.Fatal(err)
+	}
+
+	provider, err := NewDNSProvider(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = provider.AppendRecords(context.Background(), "example.com.", []libdns.Record{libdns.TXT{Name: "_acme-challenge", Text: "token"}})
+	if err == nil {
+		t.Fatal("expected the update to be rejected")
+	}
+	if len(us.received()) != 0 {
+		t.Error("the server accepted an update signed with a wrong key")
+	}
+}
+
+func TestExecProvider_RunsHook(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "calls.log")
+	script := filepath.Join(dir, "hook.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho \"$@\" >> "+log+"\n"), 0o700); err != nil { //nolint:gosec
+		t.Fatal(err)
+	}
+
+	cfg := &DNSConfig{Provider: ExecProvider, Exec: &ExecConfig{Command: script, Args: []string{"--zone-id=1"}}}
+	if err := cfg.InitDefaults(); err != nil {
+		t.Fatal(err)
+	}
+
+	provider, err := NewDNSProvider(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recs := []libdns.Record{libdns.TXT{Name: "_acme-challenge", TTL: time.Minute, Text: "token"}}
+	if _, err = provider.AppendRecords(context.Background(), "example.com.", recs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = provider.DeleteRecords(context.Background(), "example.com.", recs); err != nil {
+		t.Fatal(err)
+	}
+
+	calls, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "--zone-id=1 present _acme-challenge.example.com. token 60\n" +
+		"--zone-id=1 cleanup _acme-challenge.example.com. token 60\n"
+	if string(calls) != want {
+		t.Errorf("calls = %q, want %q", calls, want)
+	}
+}
+
+func TestExecProvider_FailureReportsOutput(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "hook.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho zone not found\nexit 3\n"), 0o700); err != nil { //nolint:gosec
+		t.Fatal(err)
+	}
+
+	provider, err := NewDNSProvider(&DNSConfig{Provider: ExecProvider, Exec: &ExecConfig{Command: script, Timeout: time.Second}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = provider.AppendRecords(context.Background(), "example.com.", []libdns.Record{libdns.TXT{Name: "_acme-challenge", Text: "token"}})
+	if err == nil || !strings.Contains(err.Error(), "zone not found") {
+		t.Fatalf("error = %v, want it to contain the hook output", err)
+	}
+}
+
+func TestDNSProvider_OnlyTXTRecords(t *testing.T) {
+	provider := &execProvider{cfg: &ExecConfig{Command: "true", Timeout: time.Second}}
+
+	_, err := provider.AppendRecords(context.Background(), "example.com.", []libdns.Record{libdns.RR{Name: "www", Type: "A", Data: "127.0.0.1"}})
+	if err == nil || !strings.Contains(err.Error(), "only TXT records") {
+		t.Fatalf("error = %v, want a record type error", err)
+	}
+}
+
+func TestSplitTXT(t *testing.T) {
+	long := strings.Repeat("a", 300)
+
+	chunks := splitTXT(long)
+	if len(chunks) != 2 || len(chunks[0]) != 255 || len(chunks[1]) != 45 {
+		t.Errorf("chunks lengths = %d", len(chunks))
+	}
+	if got := splitTXT("token"); len(got) != 1 || got[0] != "token" {
+		t.Errorf("splitTXT(token) = %v", got)
+	}
+}
@@ -0,0 +1,202 @@
+package acme
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/roadrunner-server/errors"
+)
+
+// negative cache entries are pruned when the cache grows beyond this size
+const deniedPruneSize = 1024
+
+// onDemand authorizes certificates issuance for unknown SNI names during the handshake.
+type onDemand struct {
+	cfg     *OnDemandConfig
+	domains []string
+	// handler serves the worker path checks
+	handler http.Handler
+	client  *http.Client
+
+	mu     sync.Mutex
+	denied map[string]time.Time
+	// ask checks within the current rate limit window
+	issued []time.Time
+	now    func() time.Time
+}
+
+func newOnDemand(cfg *OnDemandConfig, domains []string, handler http.Handler) *onDemand {
+	return &onDemand{
+		cfg:     cfg,
+		domains: domains,
+		handler: handler,
+		client:  &http.Client{Timeout: cfg.Timeout},
+		denied:  make(map[string]time.Time),
+		now:     time.Now,
+	}
+}
+
+// decide is the certmagic DecisionFunc: statically configured domains are always allowed,
+// recently denied names are rejected without asking, the rest are rate limited and checked via the ask hook.
+// Every ask uses up the rate limit, so a flood of random names could not reach the hook.
+func (o *onDemand) decide(ctx context.Context, name string) error {
+	const op = errors.Op("acme_on_demand_decision")
+
+	name = strings.ToLower(name)
+	if slices.ContainsFunc(o.domains, func(d string) bool { return strings.EqualFold(d, name) }) {
+		return nil
+	}
+
+	o.mu.Lock()
+	now := o.now()
+	if until, ok := o.denied[name]; ok && now.Before(until) {
+		o.mu.Unlock()
+		return errors.E(op, errors.Errorf("certificate for '%s' was recently denied", name))
+	}
+
+	// sliding window over the last RateInterval
+	o.issued = slices.DeleteFunc(o.issued, func(t time.Time) bool { return now.Sub(t) >= o.cfg.RateInterval })
+	if len(o.issued) >= o.cfg.RateLimit {
+		o.mu.Unlock()
+		return errors.E(op, errors.Errorf("on-demand issuance rate limit of %d per %s exceeded", o.cfg.RateLimit, o.cfg.RateInterval))
+	}
+
+	o.issued = append(o.issued, now)
+	o.mu.Unlock()
+
+	allowed, err := o.ask(ctx, name)
+	if err != nil {
+		// transient failures are not cached
+		return errors.E(op, err)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if !allowed {
+		o.deny(name, o.now())
+		return errors.E(op, errors.Errorf("certificate for '%s' is not allowed", name))
+	}
+
+	delete(o.denied, name)
+
+	return nil
+}
+
+// deny puts the name into the negative cache, should be called under the lock.
+func (o *onDemand) deny(name string, now time.Time) {
+	if len(o.denied) >= deniedPruneSize {
+		for n, until := range o.denied {
+			if !now.Before(until) {
+				delete(o.denied, n)
+			}
+		}
+	}
+
+	o.denied[name] = now.Add(o.cfg.DenyTTL)
+}
+
+// ask calls the configured hook with the domain query parameter. 200 allows the issuance,
+// other 4xx statuses deny it, everything else is reported as an error.
+func (o *onDemand) ask(ctx context.Context, name string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, o.cfg.Timeout)
+	defer cancel()
+
+	u, err := url.Parse(o.cfg.Ask)
+	if err != nil {
+		return false, err
+	}
+
+	q := u.Query()
+	q.Set("domain", name)
+	u.RawQuery = q.Encode()
+
+	var status int
+	if u.Host == "" {
+		status, err = o.askWorker(ctx, name, u)
+	} else {
+		status, err = o.askURL(ctx, u)
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	switch {
+	case status == http.StatusOK:
+		return true, nil
+	case status >= 400 && status < 500:
+		return false, nil
+	default:
+		return false, errors.Errorf("on-demand ask returned unexpected status %d", status)
+	}
+}
+
+func (o *onDemand) askURL(ctx context.Context, u *url.URL) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), http.NoBody)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+
+	_ = resp.Body.Close()
+
+	return resp.StatusCode, nil
+}
+
+// askWorker dispatches the check to the workers as a GET request to the requested host.
+func (o *onDemand) askWorker(ctx context.Context, name string, u *url.URL) (int, error) {
+	if o.handler == nil {
+		return 0, errors.Str("on-demand ask path requires the workers handler")
+	}
+
+	u.Scheme = "https"
+	u.Host = name
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), http.NoBody)
+	if err != nil {
+		return 0, err
+	}
+
+	req.RemoteAddr = "127.0.0.1:0"
+
+	rec := &statusRecorder{header: make(http.Header)}
+	o.handler.ServeHTTP(rec, req)
+
+	if rec.status == 0 {
+		return http.StatusOK, nil
+	}
+
+	return rec.status, nil
+}
+
+// statusRecorder keeps the response status and discards the body.
+type statusRecorder struct {
+	header http.Header
+	status int
+}
+
+func (r *statusRecorder) Header() http.Header { return r.header }
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+
+	return len(b), nil
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
@@ -0,0 +1,198 @@
+package acme
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// askServer allows the domains ending with .customer.com and counts the calls.
+func askServer(t *testing.T, calls *atomic.Int32) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		switch domain := r.URL.Query().Get("domain"); {
+		case domain == "broken.com":
+			w.WriteHeader(http.StatusBadGateway)
+		case strings.HasSuffix(domain, ".customer.com"):
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func newTestOnDemand(t *testing.T, cfg *OnDemandConfig, handler http.Handler) *onDemand {
+	t.Helper()
+
+	if err := cfg.InitDefaults(); err != nil {
+		t.Fatal(err)
+	}
+
+	return newOnDemand(cfg, []string{"Static.com"}, handler)
+}
+
+func TestOnDemandDecide_AskURL(t *testing.T) {
+	var calls atomic.Int32
+	od := newTestOnDemand(t, &OnDemandConfig{Ask: askServer(t, &calls).URL + "/allow"}, nil)
+
+	if err := od.decide(context.Background(), "static.com"); err != nil {
+		t.Errorf("static domain: %v", err)
+	}
+	if err := od.decide(context.Background(), "a.customer.com"); err != nil {
+		t.Errorf("allowed domain: %v", err)
+	}
+	if err := od.decide(context.Background(), "evil.com"); err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Errorf("denied domain: %v", err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("ask calls = %d, want 2", got)
+	}
+}
+
+// Denied names are served from the negative cache until the deny ttl expires, transient errors are not cached.
+func TestOnDemandDecide_NegativeCache(t *testing.T) {
+	var calls atomic.Int32
+	od := newTestOnDemand(t, &OnDemandConfig{Ask: askServer(t, &calls).URL, DenyTTL: time.Minute}, nil)
+
+	now := time.Now()
+	od.now = func() time.Time { return now }
+
+	for range 3 {
+		_ = od.decide(context.Background(), "evil.com")
+	}
+	if err := od.decide(context.Background(), "evil.com"); err == nil || !strings.Contains(err.Error(), "recently denied") {
+		t.Errorf("cached denial: %v", err)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("ask calls = %d, want 1", got)
+	}
+
+	now = now.Add(time.Minute)
+	_ = od.decide(context.Background(), "evil.com")
+	if got := calls.Load(); got != 2 {
+		t.Errorf("ask calls after ttl = %d, want 2", got)
+	}
+
+	for range 2 {
+		if err := od.decide(context.Background(), "broken.com"); err == nil || !strings.Contains(err.Error(), "unexpected status 502") {
+			t.Errorf("transient error: %v", err)
+		}
+	}
+	if got := calls.Load(); got != 4 {
+		t.Errorf("ask calls with transient errors = %d, want 4", got)
+	}
+}
+
+func TestOnDemandDecide_RateLimit(t *testing.T) {
+	var calls atomic.Int32
+	od := newTestOnDemand(t, &OnDemandConfig{Ask: askServer(t, &calls).URL, RateLimit: 2, RateInterval: time.Minute}, nil)
+
+	now := time.Now()
+	od.now = func() time.Time { return now }
+
+	for _, name := range []string{"a.customer.com", "b.customer.com"} {
+		if err := od.decide(context.Background(), name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := od.decide(context.Background(), "c.customer.com"); err == nil || !strings.Contains(err.Error(), "rate limit") {
+		t.Fatalf("error = %v, want the rate limit error", err)
+	}
+
+	now = now.Add(time.Minute)
+	if err := od.decide(context.Background(), "c.customer.com"); err != nil {
+		t.Errorf("after the window: %v", err)
+	}
+}
+
+// The limit is checked before the ask hook, so the denied names use it up too.
+func TestOnDemandDecide_RateLimitBeforeAsk(t *testing.T) {
+	var calls atomic.Int32
+	od := newTestOnDemand(t, &OnDemandConfig{Ask: askServer(t, &calls).URL, RateLimit: 2, RateInterval: time.Minute}, nil)
+
+	for _, name := range []string{"evil1.com", "evil2.com"} {
+		if err := od.decide(context.Background(), name); err == nil || !strings.Contains(err.Error(), "not allowed") {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+	if err := od.decide(context.Background(), "evil3.com"); err == nil || !strings.Contains(err.Error(), "rate limit") {
+		t.Fatalf("error = %v, want the rate limit error", err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("ask calls = %d, want 2", got)
+	}
+}
+
+func TestOnDemandDecide_AskWorker(t *testing.T) {
+	var gotHost, gotPath string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHost, gotPath = r.Host, r.URL.Path
+		if r.URL.Query().Get("domain") != "a.customer.com" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	})
+
+	od := newTestOnDemand(t, &OnDemandConfig{Ask: "/tls/allow"}, handler)
+
+	if err := od.decide(context.Background(), "a.customer.com"); err != nil {
+		t.Fatal(err)
+	}
+	if gotHost != "a.customer.com" || gotPath != "/tls/allow" {
+		t.Errorf("worker request = %s%s", gotHost, gotPath)
+	}
+	if err := od.decide(context.Background(), "evil.com"); err == nil {
+		t.Error("expected the worker to deny evil.com")
+	}
+}
+
+func TestOnDemandConfigInitDefaults(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     OnDemandConfig
+		wantErr string
+	}{
+		{"url", OnDemandConfig{Ask: "http://127.0.0.1:9000/allow"}, ""},
+		{"workers path", OnDemandConfig{Ask: "/tls/allow"}, ""},
+		{"no ask", OnDemandConfig{}, "requires the ask"},
+		{"relative path", OnDemandConfig{Ask: "allow"}, "should be an http(s) URL or a path"},
+		{"other scheme", OnDemandConfig{Ask: "ftp://127.0.0.1/allow"}, "should be an http(s) URL or a path"},
+		{"negative rate limit", OnDemandConfig{Ask: "/allow", RateLimit: -1}, "could not be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			err := cfg.InitDefaults()
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Timeout != 5*time.Second || cfg.RateLimit != 10 || cfg.RateInterval != time.Minute || cfg.DenyTTL != 5*time.Minute {
+				t.Errorf("defaults = %+v", cfg)
+			}
+		})
+	}
+
+	acmeCfg := Config{Email: "a@b.c", OnDemand: &OnDemandConfig{Ask: "/allow"}}
+	if err := acmeCfg.InitDefaults(); err != nil {
+		t.Errorf("on-demand without static domains: %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package acme
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/certmagic"
+)
+
+const (
+	OperationObtain string = "obtain"
+	OperationRenew  string = "renew"
+
+	ResultSuccess string = "success"
+	ResultFailure string = "failure"
+)
+
+// Outcome is an issuance operation and its result.
+type Outcome struct {
+	Operation string
+	Result    string
+}
+
+// CertificateInfo describes a certificate loaded into the cache.
+type CertificateInfo struct {
+	// Name is the first SAN of the certificate
+	Name     string
+	NotAfter time.Time
+}
+
+// Stats collects the issuance outcomes and tracks the managed certificates.
+type Stats struct {
+	mu       sync.Mutex
+	outcomes map[Outcome]uint64
+	// names seen in the cache events, used to look up the current certificates
+	names map[string]struct{}
+	cache *certmagic.Cache
+}
+
+func newStats(cache *certmagic.Cache) *Stats {
+	return &Stats{
+		outcomes: make(map[Outcome]uint64),
+		names:    make(map[string]struct{}),
+		cache:    cache,
+	}
+}
+
+// Outcomes returns a copy of the issuance counters.
+func (s *Stats) Outcomes() map[Outcome]uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make(map[Outcome]uint64, len(s.outcomes))
+	for k, v := range s.outcomes {
+		out[k] = v
+	}
+
+	return out
+}
+
+// Certificates returns the managed certificates currently in the cache.
+func (s *Stats) Certificates() []CertificateInfo {
+	s.mu.Lock()
+	names := make([]string, 0, len(s.names))
+	for name := range s.names {
+		names = append(names, name)
+	}
+	s.mu.Unlock()
+
+	seen := make(map[string]struct{})
+	certs := make([]CertificateInfo, 0, len(names))
+	for _, name := range names {
+		for _, cert := range s.cache.AllMatchingCertificates(name) {
+			if _, ok := seen[cert.Hash()]; ok || cert.Leaf == nil || len(cert.Names) == 0 {
+				continue
+			}
+
+			seen[cert.Hash()] = struct{}{}
+			certs = append(certs, CertificateInfo{Name: cert.Names[0], NotAfter: cert.Leaf.NotAfter})
+		}
+	}
+
+	return certs
+}
+
+// onEvent is the certmagic event handler.
+func (s *Stats) onEvent(_ context.Context, event string, data map[string]any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch event {
+	case "cached_managed_cert":
+		if sans, ok := data["sans"].([]string); ok {
+			for _, name := range sans {
+				s.names[name] = struct{}{}
+			}
+		}
+	case "cert_obtained":
+		s.outcomes[Outcome{Operation: operation(data), Result: ResultSuccess}]++
+	case "cert_failed":
+		s.outcomes[Outcome{Operation: operation(data), Result: ResultFailure}]++
+	}
+
+	return nil
+}
+
+func operation(data map[string]any) string {
+	if renewal, _ := data["renewal"].(bool); renewal {
+		return OperationRenew
+	}
+
+	return OperationObtain
+}
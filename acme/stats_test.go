@@ -0,0 +1,86 @@
+package acme
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/certmagic"
+)
+
+func TestStats_Outcomes(t *testing.T) {
+	stats := newStats(nil)
+	ctx := context.Background()
+
+	_ = stats.onEvent(ctx, "cert_obtained", map[string]any{"renewal": false, "identifier": "example.com"})
+	_ = stats.onEvent(ctx, "cert_obtained", map[string]any{"renewal": true, "identifier": "example.com"})
+	_ = stats.onEvent(ctx, "cert_failed", map[string]any{"renewal": true, "identifier": "example.com"})
+	_ = stats.onEvent(ctx, "cert_failed", map[string]any{"renewal": true, "identifier": "other.com"})
+	_ = stats.onEvent(ctx, "tls_get_certificate", map[string]any{})
+
+	got := stats.Outcomes()
+	want := map[Outcome]uint64{
+		{Operation: OperationObtain, Result: ResultSuccess}: 1,
+		{Operation: OperationRenew, Result: ResultSuccess}:  1,
+		{Operation: OperationRenew, Result: ResultFailure}:  2,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Outcomes = %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("Outcomes[%v] = %d, want %d", k, got[k], v)
+		}
+	}
+}
+
+func TestStats_Certificates(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notAfter := time.Now().Add(90 * 24 * time.Hour).Truncate(time.Second)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com", "www.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cfg *certmagic.Config
+	cache := certmagic.NewCache(certmagic.CacheOptions{
+		GetConfigForCert: func(certmagic.Certificate) (*certmagic.Config, error) { return cfg, nil },
+	})
+	t.Cleanup(cache.Stop)
+	cfg = certmagic.New(cache, certmagic.Config{Storage: &certmagic.FileStorage{Path: t.TempDir()}})
+
+	stats := newStats(cache)
+	if _, err = cfg.CacheUnmanagedTLSCertificate(context.Background(), tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if certs := stats.Certificates(); len(certs) != 0 {
+		t.Fatalf("Certificates = %v before the cache event", certs)
+	}
+
+	// both names point to the same certificate
+	_ = stats.onEvent(context.Background(), "cached_managed_cert", map[string]any{"sans": []string{"example.com", "www.example.com"}})
+
+	certs := stats.Certificates()
+	if len(certs) != 1 || certs[0].Name != "example.com" || !certs[0].NotAfter.Equal(notAfter) {
+		t.Errorf("Certificates = %+v", certs)
+	}
+}
@@ -0,0 +1,53 @@
+package acme
+
+import (
+	"context"
+	"time"
+
+	"github.com/caddyserver/certmagic"
+	"github.com/redis/go-redis/v9"
+	"github.com/roadrunner-server/errors"
+)
+
+const (
+	FileStorage  string = "file"
+	RedisStorage string = "redis"
+)
+
+// KV is a shared key-value store used to keep the certificates, account keys and challenge tokens
+// of a cluster in one place. Missing keys are reported with fs.ErrNotExist.
+type KV interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte) error
+	Delete(ctx context.Context, keys ...string) error
+	// Keys returns every key starting with the prefix
+	Keys(ctx context.Context, prefix string) ([]string, error)
+	// SetNX stores the value with the ttl only if the key does not exist
+	SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+	// Refresh resets the ttl of the key if it still holds the value
+	Refresh(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+	// DeleteIf deletes the key if it still holds the value
+	DeleteIf(ctx context.Context, key string, value []byte) error
+}
+
+// NewStorage returns the certmagic storage configured for the ACME certificates.
+func NewStorage(cfg *Config) (certmagic.Storage, error) {
+	if cfg.Storage == nil || cfg.Storage.Driver == FileStorage {
+		return &certmagic.FileStorage{Path: cfg.CacheDir}, nil
+	}
+
+	switch cfg.Storage.Driver {
+	case RedisStorage:
+		rc := cfg.Storage.Redis
+		client := redis.NewUniversalClient(&redis.UniversalOptions{
+			Addrs:    rc.Addrs,
+			Username: rc.Username,
+			Password: rc.Password,
+			DB:       rc.DB,
+		})
+
+		return NewKVStorage(&redisKV{client: client}, rc.Prefix, cfg.Storage.LockTTL, cfg.Storage.LockPollInterval), nil
+	default:
+		return nil, errors.Errorf("unknown acme storage driver '%s'", cfg.Storage.Driver)
+	}
+}
@@ -0,0 +1,244 @@
+package acme
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	stderr "errors"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/certmagic"
+	"github.com/roadrunner-server/errors"
+)
+
+// kvRecord is a stored value with the metadata required by certmagic.
+type kvRecord struct {
+	Value    []byte    `json:"value"`
+	Modified time.Time `json:"modified"`
+}
+
+// kvLock is a lock held by this node, refreshed until released.
+type kvLock struct {
+	token []byte
+	stop  chan struct{}
+}
+
+// KVStorage implements certmagic.Storage over a shared KV. Locks are keys with a ttl refreshed
+// by the holder, so a lock of a crashed node expires after the ttl.
+type KVStorage struct {
+	kv           KV
+	prefix       string
+	lockTTL      time.Duration
+	pollInterval time.Duration
+
+	mu    sync.Mutex
+	locks map[string]*kvLock
+}
+
+var _ certmagic.Storage = (*KVStorage)(nil)
+
+func NewKVStorage(kv KV, prefix string, lockTTL, pollInterval time.Duration) *KVStorage {
+	return &KVStorage{
+		kv:           kv,
+		prefix:       prefix,
+		lockTTL:      lockTTL,
+		pollInterval: pollInterval,
+		locks:        make(map[string]*kvLock),
+	}
+}
+
+func (s *KVStorage) Store(ctx context.Context, key string, value []byte) error {
+	data, err := json.Marshal(&kvRecord{Value: value, Modified: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+
+	return s.kv.Set(ctx, s.dataKey(key), data)
+}
+
+func (s *KVStorage) Load(ctx context.Context, key string) ([]byte, error) {
+	rec, err := s.load(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return rec.Value, nil
+}
+
+// Delete removes the key or, if the key is a directory, everything in it.
+func (s *KVStorage) Delete(ctx context.Context, key string) error {
+	keys, err := s.kv.Keys(ctx, s.dataKey(key)+"/")
+	if err != nil {
+		return err
+	}
+
+	return s.kv.Delete(ctx, append(keys, s.dataKey(key))...)
+}
+
+func (s *KVStorage) Exists(ctx context.Context, key string) bool {
+	_, err := s.Stat(ctx, key)
+	return err == nil
+}
+
+// List returns the keys in the path, only the direct children when not recursive.
+func (s *KVStorage) List(ctx context.Context, dir string, recursive bool) ([]string, error) {
+	keys, err := s.kv.Keys(ctx, s.dataKey(dir)+"/")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		return nil, fs.ErrNotExist
+	}
+
+	base := s.dataKey(dir) + "/"
+	list := make([]string, 0, len(keys))
+	for _, k := range keys {
+		rel := strings.TrimPrefix(k, base)
+		if !recursive {
+			rel, _, _ = strings.Cut(rel, "/")
+		}
+
+		list = append(list, path.Join(dir, rel))
+	}
+
+	slices.Sort(list)
+
+	return slices.Compact(list), nil
+}
+
+func (s *KVStorage) Stat(ctx context.Context, key string) (certmagic.KeyInfo, error) {
+	rec, err := s.load(ctx, key)
+	if err == nil {
+		return certmagic.KeyInfo{
+			Key:        key,
+			Modified:   rec.Modified,
+			Size:       int64(len(rec.Value)),
+			IsTerminal: true,
+		}, nil
+	}
+
+	if !stderr.Is(err, fs.ErrNotExist) {
+		return certmagic.KeyInfo{}, err
+	}
+
+	children, err := s.kv.Keys(ctx, s.dataKey(key)+"/")
+	if err != nil {
+		return certmagic.KeyInfo{}, err
+	}
+
+	if len(children) == 0 {
+		return certmagic.KeyInfo{}, fs.ErrNotExist
+	}
+
+	return certmagic.KeyInfo{Key: key}, nil
+}
+
+// Lock blocks until the lock is acquired or the context is canceled.
+func (s *KVStorage) Lock(ctx context.Context, name string) error {
+	token := make([]byte, 16)
+	_, _ = rand.Read(token)
+	token = []byte(hex.EncodeToString(token))
+
+	for {
+		ok, err := s.kv.SetNX(ctx, s.lockKey(name), token, s.lockTTL)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.pollInterval):
+		}
+	}
+
+	l := &kvLock{token: token, stop: make(chan struct{})}
+
+	s.mu.Lock()
+	s.locks[name] = l
+	s.mu.Unlock()
+
+	go s.refresh(name, l)
+
+	return nil
+}
+
+func (s *KVStorage) Unlock(ctx context.Context, name string) error {
+	s.mu.Lock()
+	l, ok := s.locks[name]
+	delete(s.locks, name)
+	s.mu.Unlock()
+
+	if !ok {
+		return errors.Errorf("lock '%s' is not held", name)
+	}
+
+	close(l.stop)
+
+	return s.kv.DeleteIf(ctx, s.lockKey(name), l.token)
+}
+
+// Close closes the KV client, if the KV holds one.
+func (s *KVStorage) Close() error {
+	if c, ok := s.kv.(io.Closer); ok {
+		return c.Close()
+	}
+
+	return nil
+}
+
+// refresh keeps the lock alive while the holder works.
+func (s *KVStorage) refresh(name string, l *kvLock) {
+	ticker := time.NewTicker(s.lockTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), s.lockTTL/3)
+			ok, err := s.kv.Refresh(ctx, s.lockKey(name), l.token, s.lockTTL)
+			cancel()
+			// the lock expired and was probably taken over, nothing to refresh anymore
+			if err == nil && !ok {
+				return
+			}
+		}
+	}
+}
+
+func (s *KVStorage) load(ctx context.Context, key string) (*kvRecord, error) {
+	data, err := s.kv.Get(ctx, s.dataKey(key))
+	if err != nil {
+		return nil, err
+	}
+
+	rec := &kvRecord{}
+	err = json.Unmarshal(data, rec)
+	if err != nil {
+		return nil, err
+	}
+
+	return rec, nil
+}
+
+func (s *KVStorage) dataKey(key string) string {
+	return path.Join(s.prefix, "data", key)
+}
+
+func (s *KVStorage) lockKey(name string) string {
+	return path.Join(s.prefix, "locks", name)
+}
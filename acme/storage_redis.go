@@ -0,0 +1,127 @@
+package acme
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// scan batch size
+const redisScanCount = 100
+
+var (
+	redisRefresh = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+	redisDeleteIf = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+)
+
+// redisKV is the KV backed by a Redis server or cluster.
+type redisKV struct {
+	client redis.UniversalClient
+}
+
+func (r *redisKV) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := r.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, fs.ErrNotExist
+	}
+
+	return data, err
+}
+
+func (r *redisKV) Set(ctx context.Context, key string, value []byte) error {
+	return r.client.Set(ctx, key, value, 0).Err()
+}
+
+func (r *redisKV) Delete(ctx context.Context, keys ...string) error {
+	// one by one, cluster keys may live in different slots
+	for _, key := range keys {
+		err := r.client.Del(ctx, key).Err()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *redisKV) Keys(ctx context.Context, prefix string) ([]string, error) {
+	match := escapeGlob(prefix) + "*"
+
+	// SCAN walks the keys of one node, every master of a cluster holds its own slots
+	cluster, ok := r.client.(*redis.ClusterClient)
+	if !ok {
+		return scanKeys(ctx, r.client, match)
+	}
+
+	var mu sync.Mutex
+	var keys []string
+	err := cluster.ForEachMaster(ctx, func(ctx context.Context, master *redis.Client) error {
+		found, err := scanKeys(ctx, master, match)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		keys = append(keys, found...)
+		mu.Unlock()
+
+		return nil
+	})
+
+	return keys, err
+}
+
+func (r *redisKV) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	return r.client.SetNX(ctx, key, value, ttl).Result()
+}
+
+func (r *redisKV) Refresh(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	n, err := redisRefresh.Run(ctx, r.client, []string{key}, value, ttl.Milliseconds()).Int()
+	return n == 1, err
+}
+
+func (r *redisKV) DeleteIf(ctx context.Context, key string, value []byte) error {
+	return redisDeleteIf.Run(ctx, r.client, []string{key}, value).Err()
+}
+
+// Close closes the Redis client.
+func (r *redisKV) Close() error {
+	return r.client.Close()
+}
+
+func scanKeys(ctx context.Context, client redis.Cmdable, match string) ([]string, error) {
+	var keys []string
+	iter := client.Scan(ctx, 0, match, redisScanCount).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+
+	return keys, iter.Err()
+}
+
+// escapeGlob escapes the SCAN MATCH pattern special characters.
+func escapeGlob(s string) string {
+	out := make([]byte, 0, len(s))
+	for i := range len(s) {
+		switch s[i] {
+		case '*', '?', '[', ']', '\\':
+			out = append(out, '\\')
+		}
+		out = append(out, s[i])
+	}
+
+	return string(out)
+}
@@ -0,0 +1,231 @@
+package acme
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/caddyserver/certmagic"
+	"github.com/redis/go-redis/v9"
+)
+
+// newRedisStorage returns a node storage backed by the local Redis stand-in.
+func newRedisStorage(t *testing.T, mr *miniredis.Miniredis) *KVStorage {
+	t.Helper()
+
+	cfg := &Config{Storage: &StorageConfig{Driver: RedisStorage, Redis: &RedisStorageConfig{Addrs: []string{mr.Addr()}}}}
+	if err := cfg.Storage.InitDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Storage.LockPollInterval = 10 * time.Millisecond
+
+	storage, err := NewStorage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return storage.(*KVStorage)
+}
+
+func TestKVStorage_Data(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	first, second := newRedisStorage(t, mr), newRedisStorage(t, mr)
+
+	certKey := "certificates/acme/example.com/example.com.crt"
+	if err := first.Store(ctx, certKey, []byte("cert")); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Store(ctx, "certificates/acme/example.com/example.com.key", []byte("key")); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Store(ctx, "acme/account.json", []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the other node sees everything the first one stored
+	data, err := second.Load(ctx, certKey)
+	if err != nil || string(data) != "cert" {
+		t.Fatalf("Load = %q, %v", data, err)
+	}
+	if !mr.Exists("rr_acme/data/" + certKey) {
+		t.Error("the data key is not prefixed")
+	}
+
+	info, err := second.Stat(ctx, certKey)
+	if err != nil || !info.IsTerminal || info.Size != 4 || info.Modified.IsZero() {
+		t.Errorf("Stat = %+v, %v", info, err)
+	}
+	if info, err = second.Stat(ctx, "certificates/acme"); err != nil || info.IsTerminal {
+		t.Errorf("Stat(dir) = %+v, %v", info, err)
+	}
+	if !second.Exists(ctx, "certificates") || second.Exists(ctx, "absent") {
+		t.Error("Exists reports wrong results")
+	}
+
+	list, err := second.List(ctx, "certificates", false)
+	if err != nil || !slices.Equal(list, []string{"certificates/acme"}) {
+		t.Errorf("List = %v, %v", list, err)
+	}
+	list, err = second.List(ctx, "certificates", true)
+	if err != nil || len(list) != 2 {
+		t.Errorf("List(recursive) = %v, %v", list, err)
+	}
+
+	if err = second.Delete(ctx, "certificates"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = first.Load(ctx, certKey); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Load after delete = %v, want fs.ErrNotExist", err)
+	}
+	if _, err = first.List(ctx, "certificates", true); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("List after delete = %v, want fs.ErrNotExist", err)
+	}
+	if !first.Exists(ctx, "acme/account.json") {
+		t.Error("Delete removed keys outside of the directory")
+	}
+}
+
+func TestKVStorage_LockExcludesOtherNodes(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	first, second := newRedisStorage(t, mr), newRedisStorage(t, mr)
+
+	if err := first.Lock(ctx, "issue_cert_example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if err := second.Lock(waitCtx, "issue_cert_example.com"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Lock while held = %v, want deadline exceeded", err)
+	}
+
+	// a node could not release a lock it does not hold
+	if err := second.Unlock(ctx, "issue_cert_example.com"); err == nil || !strings.Contains(err.Error(), "not held") {
+		t.Errorf("Unlock by other node = %v", err)
+	}
+
+	if err := first.Unlock(ctx, "issue_cert_example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Lock(ctx, "issue_cert_example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Unlock(ctx, "issue_cert_example.com"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// The lock of a crashed node expires after the lock ttl and is taken over by another node.
+func TestKVStorage_ExpiredLockTakenOver(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	crashed, alive := newRedisStorage(t, mr), newRedisStorage(t, mr)
+
+	if err := crashed.Lock(ctx, "issue_cert_example.com"); err != nil {
+		t.Fatal(err)
+	}
+	close(crashed.locks["issue_cert_example.com"].stop)
+
+	mr.FastForward(time.Minute)
+
+	if err := alive.Lock(ctx, "issue_cert_example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the late unlock of the crashed node keeps the new holder lock
+	crashed.locks["issue_cert_example.com"].stop = make(chan struct{})
+	if err := crashed.Unlock(ctx, "issue_cert_example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if !mr.Exists("rr_acme/locks/issue_cert_example.com") {
+		t.Error("a stale holder released the lock of another node")
+	}
+}
+
+func TestRedisKV_KeysCluster(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	kv := &redisKV{client: redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{mr.Addr()}})}
+	t.Cleanup(func() { _ = kv.Close() })
+
+	for _, key := range []string{"rr_acme/data/a", "rr_acme/data/b", "other/c"} {
+		if err := kv.Set(ctx, key, []byte("v")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keys, err := kv.Keys(ctx, "rr_acme/data/")
+	slices.Sort(keys)
+	if err != nil || !slices.Equal(keys, []string{"rr_acme/data/a", "rr_acme/data/b"}) {
+		t.Errorf("Keys = %v, %v", keys, err)
+	}
+}
+
+func TestKVStorage_CloseClosesClient(t *testing.T) {
+	mr := miniredis.RunT(t)
+	storage := newRedisStorage(t, mr)
+
+	if err := storage.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Store(context.Background(), "key", []byte("value")); !errors.Is(err, redis.ErrClosed) {
+		t.Errorf("Store after Close = %v, want redis.ErrClosed", err)
+	}
+}
+
+func TestNewStorage_File(t *testing.T) {
+	storage, err := NewStorage(&Config{CacheDir: "/tmp/le"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fsStorage, ok := storage.(*certmagic.FileStorage)
+	if !ok || fsStorage.Path != "/tmp/le" {
+		t.Errorf("storage = %#v, want file storage in cache_dir", storage)
+	}
+}
+
+func TestStorageConfigInitDefaults(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     StorageConfig
+		wantErr string
+	}{
+		{"file", StorageConfig{}, ""},
+		{"redis", StorageConfig{Driver: RedisStorage, Redis: &RedisStorageConfig{Addrs: []string{"127.0.0.1:6379"}}}, ""},
+		{"redis without addrs", StorageConfig{Driver: RedisStorage}, "at least one address"},
+		{"unknown driver", StorageConfig{Driver: "etcd"}, "unknown storage driver"},
+		{"negative ttl", StorageConfig{LockTTL: -time.Second}, "could not be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			err := cfg.InitDefaults()
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.LockTTL != time.Minute || cfg.LockPollInterval != time.Second {
+				t.Errorf("lock defaults = %v, %v", cfg.LockTTL, cfg.LockPollInterval)
+			}
+			if cfg.Redis != nil && cfg.Redis.Prefix != "rr_acme" {
+				t.Errorf("Prefix = %q, want rr_acme", cfg.Redis.Prefix)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"net"
 	"strings"
 
 	"github.com/roadrunner-server/http/v6/servers/fcgi"
@@ -11,10 +12,47 @@ import (
 	"github.com/roadrunner-server/pool/v2/pool"
 )
 
+// the cookie values decoding
+const (
+	CookieDecodeQuery string = "query"
+	CookieDecodePath  string = "path"
+	CookieDecodeNone  string = "none"
+)
+
+// the request body encodings decoded by the server
+const (
+	EncodingGzip    string = "gzip"
+	EncodingDeflate string = "deflate"
+	EncodingBrotli  string = "br"
+	EncodingZstd    string = "zstd"
+)
+
+// MaxInputNestingLimit is the deepest allowed max_input_nesting, the data tree keeps one more level for the root key.
+const MaxInputNestingLimit = 126
+
 // Config configures RoadRunner HTTP server.
 type Config struct {
 	// RawBody if turned on, RR will not parse the incoming HTTP body and will send it as is
 	RawBody bool `mapstructure:"raw_body"`
+	// MaxInputVars limits the number of the form fields (PHP max_input_vars), 0 - unlimited.
+	MaxInputVars int `mapstructure:"max_input_vars"`
+	// MaxInputNesting limits the nesting of the form field names (PHP max_input_nesting_level), 0 - unlimited.
+	MaxInputNesting int `mapstructure:"max_input_nesting"`
+	// MaxInputKeyLength limits the length of the form field names, 0 - unlimited.
+	MaxInputKeyLength int `mapstructure:"max_input_key_length"`
+	// CookieDecode decodes the cookie values: query (url.QueryUnescape, default), path (url.PathUnescape) or none.
+	// The value failing to decode is sent as is.
+	CookieDecode string `mapstructure:"cookie_decode"`
+	// RawCookies sends the undecoded cookie values as JSON in the rr:raw_cookies attribute.
+	RawCookies bool `mapstructure:"raw_cookies"`
+	// ParseQuery parses the query string into the nested tree of the forms, sent as the rr:query attribute.
+	ParseQuery bool `mapstructure:"parse_query"`
+	// ParseJSON validates the application/json and +json bodies and sends them to the worker as the parsed body.
+	ParseJSON bool `mapstructure:"parse_json"`
+	// JSONMaxDepth limits the nesting of the parsed JSON bodies, default 64.
+	JSONMaxDepth int `mapstructure:"json_max_depth"`
+	// JSONMaxSize limits the size of the parsed JSON bodies in megabytes, default 8.
+	JSONMaxSize uint64 `mapstructure:"json_max_size"`
 	// Host and port to handle as http server.
 	Address string `mapstructure:"address"`
 	// AccessLogs turn on/off, logged at Info log level, default: false
@@ -27,6 +65,9 @@ type Config struct {
 	InternalErrorCode uint64 `mapstructure:"internal_error_code"`
 	// MaxRequestSize specified max size for payload body in megabytes. 0 = 1GB.
 	MaxRequestSize uint64 `mapstructure:"max_request_size"`
+	// Decompress lists the request body encodings decoded before the body is read (gzip, deflate, br or zstd),
+	// the decoded size is limited by max_request_size. Empty - the bodies are passed as is.
+	Decompress []string `mapstructure:"decompress"`
 	// SSLConfig defines https server options.
 	SSLConfig *https.SSL `mapstructure:"ssl"`
 	// FCGIConfig configuration. You can use FastCGI without HTTP server.
@@ -36,6 +77,8 @@ type Config struct {
 	HTTP3Config *http3.Config `mapstructure:"http3"`
 	// Uploads configures uploads configuration.
 	Uploads *Uploads `mapstructure:"uploads"`
+	// EarlyHints configures 103 Early Hints, nil - disabled.
+	EarlyHints *EarlyHints `mapstructure:"early_hints"`
 
 	// private
 	UID int
@@ -57,7 +100,7 @@ func (c *Config) EnableTLS() bool {
 	if c.SSLConfig == nil {
 		return false
 	}
-	if c.SSLConfig.Acme != nil {
+	if c.SSLConfig.Acme != nil || c.SSLConfig.DevCertificates {
 		return true
 	}
 	return c.SSLConfig.Key != "" && c.SSLConfig.Cert != ""
@@ -87,6 +130,24 @@ func (c *Config) InitDefaults() error {
 		c.MaxRequestSize = 1000
 	}
 
+	for i := range c.Decompress {
+		c.Decompress[i] = strings.ToLower(strings.TrimSpace(c.Decompress[i]))
+	}
+
+	if c.CookieDecode == "" {
+		c.CookieDecode = CookieDecodeQuery
+	}
+
+	if c.ParseJSON {
+		if c.JSONMaxDepth == 0 {
+			c.JSONMaxDepth = 64
+		}
+
+		if c.JSONMaxSize == 0 {
+			c.JSONMaxSize = 8
+		}
+	}
+
 	if c.HTTP2Config != nil {
 		err := c.HTTP2Config.InitDefaults()
 		if err != nil {
@@ -95,12 +156,27 @@ func (c *Config) InitDefaults() error {
 	}
 
 	if c.SSLConfig != nil {
+		// the dev certificate should also cover the HTTP/3 listener using it
+		if c.SSLConfig.DevCertificates && c.HTTP3Config != nil && c.HTTP3Config.Key == "" && c.HTTP3Config.Cert == "" {
+			if host, _, err := net.SplitHostPort(c.HTTP3Config.Address); err == nil && host != "" {
+				c.SSLConfig.DevCertificatesNames = append(c.SSLConfig.DevCertificatesNames, host)
+			}
+		}
+
 		err := c.SSLConfig.InitDefaults()
 		if err != nil {
 			return err
 		}
 	}
 
+	if c.HTTP3Config != nil {
+		c.HTTP3Config.InitDefaults()
+
+		if c.SSLConfig != nil {
+			c.HTTP3Config.InheritSSL(c.SSLConfig)
+		}
+	}
+
 	if c.Uploads == nil {
 		c.Uploads = &Uploads{}
 	}
@@ -110,6 +186,13 @@ func (c *Config) InitDefaults() error {
 		return err
 	}
 
+	if c.EarlyHints != nil {
+		err = c.EarlyHints.InitDefaults()
+		if err != nil {
+			return err
+		}
+	}
+
 	return c.Valid()
 }
 
@@ -128,6 +211,32 @@ func (c *Config) Valid() error {
 		return errors.E(op, errors.Str("unable to run http service, no method has been specified (http, https, http/2 or FastCGI)"))
 	}
 
+	if c.MaxInputVars < 0 || c.MaxInputNesting < 0 || c.MaxInputKeyLength < 0 {
+		return errors.E(op, errors.Str("max_input_vars, max_input_nesting and max_input_key_length could not be negative"))
+	}
+
+	if c.MaxInputNesting > MaxInputNestingLimit {
+		return errors.E(op, errors.Errorf("max_input_nesting could not be greater than %d", MaxInputNestingLimit))
+	}
+
+	for _, enc := range c.Decompress {
+		switch enc {
+		case EncodingGzip, EncodingDeflate, EncodingBrotli, EncodingZstd:
+		default:
+			return errors.E(op, errors.Errorf("unknown decompress encoding: %s, should be gzip, deflate, br or zstd", enc))
+		}
+	}
+
+	switch c.CookieDecode {
+	case CookieDecodeQuery, CookieDecodePath, CookieDecodeNone:
+	default:
+		return errors.E(op, errors.Errorf("unknown cookie_decode value: %s, should be query, path or none", c.CookieDecode))
+	}
+
+	if c.JSONMaxDepth < 0 {
+		return errors.E(op, errors.Str("json_max_depth could not be negative"))
+	}
+
 	if c.Address != "" && !strings.Contains(c.Address, ":") {
 		return errors.E(op, errors.Str("malformed http server address"))
 	}
@@ -139,5 +248,16 @@ func (c *Config) Valid() error {
 		}
 	}
 
+	if c.EnableHTTP3() {
+		if c.HTTP3Config.Address == "" {
+			return errors.E(op, errors.Str("http3 address is required without the ssl section"))
+		}
+
+		err := c.HTTP3Config.Valid()
+		if err != nil {
+			return errors.E(op, err)
+		}
+	}
+
 	return nil
 }
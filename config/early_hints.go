@@ -0,0 +1,57 @@
+package config
+
+import (
+	"strings"
+	"time"
+
+	"github.com/roadrunner-server/errors"
+)
+
+// EarlyHints configures the 103 Early Hints generated from the preload links of the worker responses.
+type EarlyHints struct {
+	// Routes are the preload links sent for the request path before the worker starts.
+	// Example: "/": ["</app.css>; rel=preload; as=style"]
+	Routes map[string][]string `mapstructure:"routes"`
+	// Cache remembers the preload links of the worker responses per route and sends them
+	// before the worker starts on the next requests to the same route.
+	Cache bool `mapstructure:"cache"`
+	// CacheTTL is the lifetime of the cached links, default 10m.
+	CacheTTL time.Duration `mapstructure:"cache_ttl"`
+	// CacheSize is the maximum number of the cached routes, default 1000.
+	CacheSize int `mapstructure:"cache_size"`
+}
+
+// InitDefaults sets missing values to their default values.
+func (eh *EarlyHints) InitDefaults() error {
+	if eh.CacheTTL == 0 {
+		eh.CacheTTL = time.Minute * 10
+	}
+
+	if eh.CacheSize == 0 {
+		eh.CacheSize = 1000
+	}
+
+	return eh.Valid()
+}
+
+// Valid validates the configuration.
+func (eh *EarlyHints) Valid() error {
+	const op = errors.Op("early_hints_validation")
+	if eh.CacheTTL < 0 || eh.CacheSize < 0 {
+		return errors.E(op, errors.Str("cache_ttl and cache_size could not be negative"))
+	}
+
+	for route, links := range eh.Routes {
+		if !strings.HasPrefix(route, "/") {
+			return errors.E(op, errors.Errorf("early hints route should start with /, got: %s", route))
+		}
+
+		for _, link := range links {
+			if !strings.HasPrefix(strings.TrimSpace(link), "<") {
+				return errors.E(op, errors.Errorf("malformed early hints link for the route %s: %s", route, link))
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"time"
+
+	"github.com/roadrunner-server/errors"
+)
+
+const (
+	ScanDriverClamd string = "clamd"
+	ScanDriverICAP  string = "icap"
+)
+
+// UploadScan configures the malware scanning of the uploaded files before the worker sees them.
+type UploadScan struct {
+	// Driver is clamd or icap.
+	Driver string `mapstructure:"driver"`
+	// Address of the scanner: tcp://127.0.0.1:3310 or unix:///run/clamav/clamd.ctl for clamd,
+	// icap://127.0.0.1:1344/avscan for ICAP.
+	Address string `mapstructure:"address"`
+	// Timeout of a single file scan, default 30s.
+	Timeout time.Duration `mapstructure:"timeout"`
+	// FailOpen passes the files to the worker when they could not be scanned,
+	// by default such requests are rejected with 503 (fail closed).
+	FailOpen bool `mapstructure:"fail_open"`
+}
+
+// InitDefaults sets missing values to their default values.
+func (s *UploadScan) InitDefaults() error {
+	if s.Timeout == 0 {
+		s.Timeout = time.Second * 30
+	}
+
+	return s.Valid()
+}
+
+// Valid validates the configuration.
+func (s *UploadScan) Valid() error {
+	const op = errors.Op("upload_scan_validation")
+	switch s.Driver {
+	case ScanDriverClamd, ScanDriverICAP:
+	default:
+		return errors.E(op, errors.Errorf("unknown upload scan driver: %s, should be clamd or icap", s.Driver))
+	}
+
+	if s.Address == "" {
+		return errors.E(op, errors.Str("upload scan address is required"))
+	}
+
+	if s.Timeout < 0 {
+		return errors.E(op, errors.Str("upload scan timeout could not be negative"))
+	}
+
+	return nil
+}
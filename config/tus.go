@@ -0,0 +1,60 @@
+package config
+
+import (
+	"strings"
+	"time"
+
+	"github.com/roadrunner-server/errors"
+)
+
+// Tus configures the tus 1.0 resumable uploads endpoint. The chunks are assembled in the uploads dir and
+// the completed file is sent to the worker as a regular upload.
+type Tus struct {
+	// Path is the endpoint prefix, the upload URLs are <path><id>, default /files/.
+	Path string `mapstructure:"path"`
+	// MaxSize is the maximum size of an upload in megabytes, 0 - limited by max_file_size only (one of them is required).
+	MaxSize uint64 `mapstructure:"max_size"`
+	// MaxUploads is the maximum number of the incomplete uploads, default 100.
+	MaxUploads int `mapstructure:"max_uploads"`
+	// Expiration of the incomplete uploads, default 24h.
+	Expiration time.Duration `mapstructure:"expiration"`
+}
+
+// InitDefaults sets missing values to their default values.
+func (t *Tus) InitDefaults() error {
+	if t.Path == "" {
+		t.Path = "/files/"
+	}
+
+	if !strings.HasSuffix(t.Path, "/") {
+		t.Path += "/"
+	}
+
+	if t.MaxUploads == 0 {
+		t.MaxUploads = 100
+	}
+
+	if t.Expiration == 0 {
+		t.Expiration = time.Hour * 24
+	}
+
+	return t.Valid()
+}
+
+// Valid validates the configuration.
+func (t *Tus) Valid() error {
+	const op = errors.Op("tus_validation")
+	if !strings.HasPrefix(t.Path, "/") {
+		return errors.E(op, errors.Errorf("tus path should start with /, got: %s", t.Path))
+	}
+
+	if t.MaxUploads < 0 {
+		return errors.E(op, errors.Str("tus max_uploads could not be negative"))
+	}
+
+	if t.Expiration < 0 {
+		return errors.E(op, errors.Str("tus expiration could not be negative"))
+	}
+
+	return nil
+}
@@ -2,8 +2,43 @@ package config
 
 import (
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/roadrunner-server/errors"
+)
+
+const (
+	// OnLimitError marks the file exceeding a limit with the PHP-style error code, the request goes to the worker.
+	OnLimitError string = "error"
+	// OnLimitReject rejects the request exceeding a limit with 413.
+	OnLimitReject string = "reject"
+)
+
+// the digests of the uploaded files passed to the worker
+const (
+	ChecksumSHA256 string = "sha256"
+	ChecksumMD5    string = "md5"
+	ChecksumCRC32C string = "crc32c"
 )
 
+// NoUploadLimit lifts the upload limit, the route limits set to 0 inherit the global ones instead.
+const NoUploadLimit = -1
+
+// UploadLimits limits the uploaded files, 0 or NoUploadLimit - unlimited.
+type UploadLimits struct {
+	// MaxFileSize is the maximum size of a single file in megabytes (UPLOAD_ERR_INI_SIZE).
+	MaxFileSize int64 `mapstructure:"max_file_size"`
+	// MaxFiles is the maximum number of the files in a request (UPLOAD_ERR_INI_SIZE for the rest).
+	MaxFiles int `mapstructure:"max_files"`
+	// MaxTotalSize is the maximum size of all the files in a request in megabytes (UPLOAD_ERR_FORM_SIZE).
+	MaxTotalSize int64 `mapstructure:"max_total_size"`
+	// OnLimit is either error (default) or reject.
+	OnLimit string `mapstructure:"on_limit"`
+}
+
 // Uploads describes file location and controls access to them.
 type Uploads struct {
 	// Dir contains name of directory to control access to.
@@ -16,6 +51,38 @@ type Uploads struct {
 	// Allowed files
 	Allow []string `mapstructure:"allow"`
 
+	// DetectMime sniffs the content type from the first bytes of the file, implied by the options below.
+	DetectMime bool `mapstructure:"detect_mime"`
+	// AllowMime specifies list of the allowed content types, e.g. image/png or image/*.
+	AllowMime []string `mapstructure:"allow_mime"`
+	// ForbidMime specifies list of the forbidden content types, e.g. application/x-httpd-php.
+	ForbidMime []string `mapstructure:"forbid_mime"`
+	// RejectMismatch rejects the files which content disagrees with the extension, e.g. a .jpg PHP script.
+	RejectMismatch bool `mapstructure:"reject_mismatch"`
+
+	// Checksums lists the digests computed while the files are written to disk: sha256, md5 or crc32c.
+	Checksums []string `mapstructure:"checksums"`
+	// ImageSize passes the width and height of the uploaded png, jpeg and gif images.
+	ImageSize bool `mapstructure:"image_size"`
+
+	// Scan checks the uploaded files for malware, nil - disabled.
+	Scan *UploadScan `mapstructure:"scan"`
+
+	// ClaimDir is the directory the files claimed by the worker (X-Upload-Claim) are moved to, empty - kept in place.
+	ClaimDir string `mapstructure:"claim_dir"`
+	// OrphanTTL removes the temp files older than the TTL from the uploads dir: the files left by crashes and
+	// the claimed files kept in place, 0 - disabled. Requires a dedicated dir, not the system temp dir.
+	OrphanTTL time.Duration `mapstructure:"orphan_ttl"`
+
+	// Tus enables the resumable uploads endpoint, nil - disabled.
+	Tus *Tus `mapstructure:"tus"`
+
+	// Limits for all the requests.
+	UploadLimits `mapstructure:",squash"`
+	// Routes override the limits for the request path prefix matched on the segment boundary (/avatars matches
+	// /avatars and /avatars/1, but not /avatars-old), the longest prefix wins.
+	Routes map[string]*UploadLimits `mapstructure:"routes"`
+
 	// internal
 	Forbidden map[string]struct{} `mapstructure:"-"`
 	Allowed   map[string]struct{} `mapstructure:"-"`
@@ -45,5 +112,168 @@ func (cfg *Uploads) InitDefaults() error {
 	cfg.Forbid = nil
 	cfg.Allow = nil
 
+	for i := range cfg.AllowMime {
+		cfg.AllowMime[i] = strings.ToLower(strings.TrimSpace(cfg.AllowMime[i]))
+	}
+
+	for i := range cfg.ForbidMime {
+		cfg.ForbidMime[i] = strings.ToLower(strings.TrimSpace(cfg.ForbidMime[i]))
+	}
+
+	if len(cfg.AllowMime) > 0 || len(cfg.ForbidMime) > 0 || cfg.RejectMismatch {
+		cfg.DetectMime = true
+	}
+
+	for i := range cfg.Checksums {
+		cfg.Checksums[i] = strings.ToLower(strings.TrimSpace(cfg.Checksums[i]))
+	}
+
+	slices.Sort(cfg.Checksums)
+	cfg.Checksums = slices.Compact(cfg.Checksums)
+
+	if cfg.Scan != nil {
+		err := cfg.Scan.InitDefaults()
+		if err != nil {
+			return err
+		}
+	}
+
+	if cfg.ClaimDir != "" {
+		cfg.ClaimDir = filepath.Clean(cfg.ClaimDir)
+	}
+
+	if cfg.Tus != nil {
+		err := cfg.Tus.InitDefaults()
+		if err != nil {
+			return err
+		}
+	}
+
+	if cfg.OnLimit == "" {
+		cfg.OnLimit = OnLimitError
+	}
+
+	// the route limits not set inherit the global ones, NoUploadLimit lifts them
+	for _, l := range cfg.Routes {
+		if l == nil {
+			continue
+		}
+
+		if l.MaxFileSize == 0 {
+			l.MaxFileSize = cfg.MaxFileSize
+		}
+
+		if l.MaxFiles == 0 {
+			l.MaxFiles = cfg.MaxFiles
+		}
+
+		if l.MaxTotalSize == 0 {
+			l.MaxTotalSize = cfg.MaxTotalSize
+		}
+
+		if l.OnLimit == "" {
+			l.OnLimit = cfg.OnLimit
+		}
+	}
+
+	return cfg.Valid()
+}
+
+// Valid validates the configuration.
+func (cfg *Uploads) Valid() error {
+	const op = errors.Op("uploads_validation")
+	err := cfg.UploadLimits.valid()
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	for _, mt := range append(slices.Clone(cfg.AllowMime), cfg.ForbidMime...) {
+		if !strings.Contains(mt, "/") {
+			return errors.E(op, errors.Errorf("malformed mime type, should be type/subtype or type/*: %s", mt))
+		}
+	}
+
+	// the uploads are stored before the worker sees them, the disk usage should be bounded
+	if cfg.Tus != nil && cfg.Tus.MaxSize == 0 && cfg.MaxFileSize <= 0 {
+		return errors.E(op, errors.Str("tus requires tus.max_size or max_file_size"))
+	}
+
+	if cfg.OrphanTTL < 0 {
+		return errors.E(op, errors.Str("orphan_ttl could not be negative"))
+	}
+
+	// the system temp dir is shared with the other processes, their files could match the upload names
+	if cfg.OrphanTTL > 0 && filepath.Clean(cfg.Dir) == filepath.Clean(os.TempDir()) {
+		return errors.E(op, errors.Str("orphan_ttl requires a dedicated uploads dir, not the system temp dir"))
+	}
+
+	if cfg.ClaimDir != "" {
+		fi, errS := os.Stat(cfg.ClaimDir)
+		if errS != nil {
+			return errors.E(op, errS)
+		}
+
+		if !fi.IsDir() {
+			return errors.E(op, errors.Errorf("claim_dir is not a directory: %s", cfg.ClaimDir))
+		}
+	}
+
+	for _, c := range cfg.Checksums {
+		switch c {
+		case ChecksumSHA256, ChecksumMD5, ChecksumCRC32C:
+		default:
+			return errors.E(op, errors.Errorf("unknown checksum: %s, should be sha256, md5 or crc32c", c))
+		}
+	}
+
+	for route, l := range cfg.Routes {
+		if !strings.HasPrefix(route, "/") {
+			return errors.E(op, errors.Errorf("uploads route should start with /, got: %s", route))
+		}
+
+		if l == nil {
+			return errors.E(op, errors.Errorf("empty uploads limits for the route %s", route))
+		}
+
+		err = l.valid()
+		if err != nil {
+			return errors.E(op, errors.Errorf("route %s: %v", route, err))
+		}
+	}
+
 	return nil
 }
+
+func (l *UploadLimits) valid() error {
+	if l.MaxFileSize < NoUploadLimit || l.MaxFiles < NoUploadLimit || l.MaxTotalSize < NoUploadLimit {
+		return errors.Str("max_file_size, max_files and max_total_size could not be less than -1 (unlimited)")
+	}
+
+	switch l.OnLimit {
+	case OnLimitError, OnLimitReject:
+		return nil
+	default:
+		return errors.Errorf("unknown on_limit value: %s, should be error or reject", l.OnLimit)
+	}
+}
+
+// Limits returns the limits of the request path: the route with the longest matching prefix or the global ones.
+func (cfg *Uploads) Limits(path string) *UploadLimits {
+	limits, longest := &cfg.UploadLimits, -1
+	for route, l := range cfg.Routes {
+		if len(route) > longest && matchRoute(path, route) {
+			limits, longest = l, len(route)
+		}
+	}
+
+	return limits
+}
+
+// matchRoute checks the path is the route or is under it, the route ending with / matches the paths under it only.
+func matchRoute(path, route string) bool {
+	if !strings.HasPrefix(path, route) {
+		return false
+	}
+
+	return len(path) == len(route) || strings.HasSuffix(route, "/") || path[len(route)] == '/'
+}
@@ -0,0 +1,244 @@
+package devcert
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/roadrunner-server/errors"
+)
+
+const (
+	CAFile    string = "rootCA.pem"
+	CAKeyFile string = "rootCA-key.pem"
+	CertFile  string = "cert.pem"
+	KeyFile   string = "key.pem"
+
+	caValidity   = 10 * 365 * 24 * time.Hour
+	leafValidity = 90 * 24 * time.Hour
+	// the leaf certificate is re-issued when it expires sooner than this
+	renewBefore = 7 * 24 * time.Hour
+)
+
+// Bundle contains the paths of the generated files.
+type Bundle struct {
+	// CA is the certificate to add to the trust store of the browser or the OS
+	CA   string
+	Cert string
+	Key  string
+}
+
+// Ensure creates (or reuses) the CA and the leaf certificate in dir. The leaf certificate is re-issued when it
+// does not cover every host, is about to expire or was not signed by the CA in dir.
+func Ensure(dir string, hosts []string) (*Bundle, error) {
+	const op = errors.Op("devcert_ensure")
+
+	if len(hosts) == 0 {
+		return nil, errors.E(op, errors.Str("at least one host is required"))
+	}
+
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	b := &Bundle{
+		CA:   filepath.Join(dir, CAFile),
+		Cert: filepath.Join(dir, CertFile),
+		Key:  filepath.Join(dir, KeyFile),
+	}
+
+	ca, caKey, err := loadOrCreateCA(b.CA, filepath.Join(dir, CAKeyFile))
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	if leafValid(b.Cert, ca, hosts) {
+		return b, nil
+	}
+
+	err = createLeaf(b.Cert, b.Key, ca, caKey, hosts)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	return b, nil
+}
+
+func loadOrCreateCA(certPath, keyPath string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	cert, errC := loadCert(certPath)
+	key, errK := loadKey(keyPath)
+	if errC == nil && errK == nil && time.Until(cert.NotAfter) > renewBefore {
+		return cert, key, nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization: []string{"RoadRunner development CA"},
+			CommonName:   "RoadRunner development CA",
+		},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = writeFiles(certPath, keyPath, der, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cert, err = x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cert, key, nil
+}
+
+func createLeaf(certPath, keyPath string, ca *x509.Certificate, caKey *ecdsa.PrivateKey, hosts []string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	serial, err := serialNumber()
+	if err != nil {
+		return err
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization: []string{"RoadRunner development certificate"},
+			CommonName:   hosts[0],
+		},
+		NotBefore:   time.Now().Add(-time.Hour),
+		NotAfter:    time.Now().Add(leafValidity),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+			continue
+		}
+
+		tmpl.DNSNames = append(tmpl.DNSNames, h)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return err
+	}
+
+	return writeFiles(certPath, keyPath, der, key)
+}
+
+// leafValid reports whether the existing leaf certificate could be reused.
+func leafValid(certPath string, ca *x509.Certificate, hosts []string) bool {
+	cert, err := loadCert(certPath)
+	if err != nil {
+		return false
+	}
+
+	if time.Until(cert.NotAfter) < renewBefore || cert.CheckSignatureFrom(ca) != nil {
+		return false
+	}
+
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			if !slices.ContainsFunc(cert.IPAddresses, ip.Equal) {
+				return false
+			}
+			continue
+		}
+
+		if !slices.Contains(cert.DNSNames, h) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func loadCert(path string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.Errorf("no certificate found in '%s'", path)
+	}
+
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func loadKey(path string) (*ecdsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "EC PRIVATE KEY" {
+		return nil, errors.Errorf("no private key found in '%s'", path)
+	}
+
+	return x509.ParseECPrivateKey(block.Bytes)
+}
+
+func writeFiles(certPath, keyPath string, der []byte, key *ecdsa.PrivateKey) error {
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(keyPath, pemEncode("EC PRIVATE KEY", keyDER), 0o600)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(certPath, pemEncode("CERTIFICATE", der), 0o644)
+}
+
+func pemEncode(typ string, der []byte) []byte {
+	buf := &bytes.Buffer{}
+	_ = pem.Encode(buf, &pem.Block{Type: typ, Bytes: der})
+	return buf.Bytes()
+}
+
+func serialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
@@ -0,0 +1,97 @@
+package devcert
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnsure_CertificateVerifiesForEveryHost(t *testing.T) {
+	dir := t.TempDir()
+	hosts := []string{"localhost", "127.0.0.1", "::1", "app.test"}
+
+	b, err := Ensure(dir, hosts)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, CAFile), b.CA)
+
+	pair, err := tls.LoadX509KeyPair(b.Cert, b.Key)
+	require.NoError(t, err)
+
+	caPEM, err := os.ReadFile(b.CA)
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM(caPEM))
+
+	for _, h := range hosts {
+		_, err = pair.Leaf.Verify(x509.VerifyOptions{DNSName: h, Roots: roots})
+		assert.NoError(t, err, h)
+	}
+
+	_, err = pair.Leaf.Verify(x509.VerifyOptions{DNSName: "other.test", Roots: roots})
+	assert.Error(t, err)
+
+	info, err := os.Stat(b.Key)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
+
+func TestEnsure_ReusesCachedCertificates(t *testing.T) {
+	dir := t.TempDir()
+
+	b, err := Ensure(dir, []string{"localhost", "127.0.0.1"})
+	require.NoError(t, err)
+	ca1 := readFile(t, b.CA)
+	cert1 := readFile(t, b.Cert)
+
+	// a subset of the names is covered by the existing certificate
+	b, err = Ensure(dir, []string{"localhost"})
+	require.NoError(t, err)
+	assert.Equal(t, ca1, readFile(t, b.CA))
+	assert.Equal(t, cert1, readFile(t, b.Cert))
+
+	// a new name re-issues the leaf with the same CA
+	b, err = Ensure(dir, []string{"localhost", "127.0.0.1", "app.test"})
+	require.NoError(t, err)
+	assert.Equal(t, ca1, readFile(t, b.CA))
+	assert.NotEqual(t, cert1, readFile(t, b.Cert))
+}
+
+func TestEnsure_ReissuesLeafForNewCA(t *testing.T) {
+	dir := t.TempDir()
+
+	b, err := Ensure(dir, []string{"localhost"})
+	require.NoError(t, err)
+	cert1 := readFile(t, b.Cert)
+
+	require.NoError(t, os.Remove(b.CA))
+
+	b, err = Ensure(dir, []string{"localhost"})
+	require.NoError(t, err)
+	assert.NotEqual(t, cert1, readFile(t, b.Cert))
+
+	pair, err := tls.LoadX509KeyPair(b.Cert, b.Key)
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM(readFile(t, b.CA)))
+	_, err = pair.Leaf.Verify(x509.VerifyOptions{DNSName: "localhost", Roots: roots})
+	assert.NoError(t, err)
+}
+
+func TestEnsure_NoHosts(t *testing.T) {
+	_, err := Ensure(t.TempDir(), nil)
+	assert.Error(t, err)
+}
+
+func readFile(t *testing.T, path string) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	return data
+}
@@ -0,0 +1,3 @@
+// Package devcert generates a local certificate authority and self-signed
+// leaf certificates for development HTTPS and HTTP/3 listeners.
+package devcert
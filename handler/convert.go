@@ -25,21 +25,3 @@ func convert(headers http.Header) map[string]*httpV1proto.HeaderValue {
 
 	return resp
 }
-
-func convertCookies(headers map[string]string) map[string]*httpV1proto.HeaderValue {
-	if len(headers) == 0 {
-		return nil
-	}
-
-	resp := make(map[string]*httpV1proto.HeaderValue, len(headers))
-
-	for k, v := range headers {
-		if resp[k] == nil {
-			resp[k] = &httpV1proto.HeaderValue{}
-		}
-
-		resp[k].Value = append(resp[k].GetValue(), []byte(v))
-	}
-
-	return resp
-}
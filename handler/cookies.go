@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/roadrunner-server/http/v6/config"
+)
+
+// RawCookiesAttribute is the attribute the undecoded cookie values are sent in as JSON (raw_cookies).
+const RawCookiesAttribute = "rr:raw_cookies"
+
+// cookieRules decodes the request cookies, every value is kept in the order of the Cookie headers.
+type cookieRules struct {
+	// nil - the values are sent as is
+	decode func(string) (string, error)
+	// send the undecoded values as well
+	raw bool
+}
+
+func newCookieRules(cfg *config.Config) *cookieRules {
+	c := &cookieRules{raw: cfg.RawCookies}
+
+	switch cfg.CookieDecode {
+	case config.CookieDecodePath:
+		c.decode = url.PathUnescape
+	case config.CookieDecodeNone:
+	default:
+		c.decode = url.QueryUnescape
+	}
+
+	return c
+}
+
+// parse copies the request cookies. Unlike http.Request.Cookies, the duplicate names (the path-scoped cookies)
+// and the values failing to validate or decode are kept.
+func (c *cookieRules) parse(r *http.Request, req *Request) {
+	var raw map[string][]string
+	if c.raw {
+		raw = make(map[string][]string)
+	}
+
+	for _, line := range r.Header.Values("Cookie") {
+		for part := range strings.SplitSeq(line, ";") {
+			name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+
+			if raw != nil {
+				raw[name] = append(raw[name], value)
+			}
+
+			v := value
+			if len(v) > 1 && v[0] == '"' && v[len(v)-1] == '"' {
+				v = v[1 : len(v)-1]
+			}
+
+			if c.decode != nil {
+				if dv, err := c.decode(v); err == nil {
+					v = dv
+				}
+			}
+
+			req.Cookies[name] = append(req.Cookies[name], v)
+		}
+	}
+
+	if len(raw) > 0 {
+		// a map of strings always marshals
+		req.rawCookies, _ = json.Marshal(raw)
+	}
+}
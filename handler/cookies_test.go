@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/roadrunner-server/http/v6/config"
+)
+
+func TestCookieRules_Parse(t *testing.T) {
+	tests := []struct {
+		decode string
+		want   map[string][]string
+	}{
+		{config.CookieDecodeQuery, map[string][]string{"a": {"b c", "x+y"}, "d": {"e f"}, "bad": {"%zz"}, "q": {"v"}}},
+		{config.CookieDecodePath, map[string][]string{"a": {"b c", "x+y"}, "d": {"e+f"}, "bad": {"%zz"}, "q": {"v"}}},
+		{config.CookieDecodeNone, map[string][]string{"a": {"b%20c", "x%2By"}, "d": {"e+f"}, "bad": {"%zz"}, "q": {"v"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.decode, func(t *testing.T) {
+			r := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/", nil)
+			// the path-scoped cookies share the name
+			r.Header.Add("Cookie", `a=b%20c; d=e+f; bad=%zz`)
+			r.Header.Add("Cookie", `a=x%2By; q="v"`)
+
+			req := newPSRRequest(r)
+			newCookieRules(&config.Config{CookieDecode: tt.decode}).parse(r, req)
+
+			if diff := cmp.Diff(tt.want, req.Cookies); diff != "" {
+				t.Errorf("cookies mismatch (-want +got):\n%s", diff)
+			}
+			if req.rawCookies != nil {
+				t.Errorf("rawCookies = %s, want nil unless raw_cookies is set", req.rawCookies)
+			}
+		})
+	}
+}
+
+func TestCookieRules_Raw(t *testing.T) {
+	r := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/", nil)
+	r.Header.Add("Cookie", `a=b%20c; a="q"; empty=`)
+
+	req := newPSRRequest(r)
+	newCookieRules(&config.Config{CookieDecode: config.CookieDecodeQuery, RawCookies: true}).parse(r, req)
+
+	if got := string(req.rawCookies); got != `{"a":["b%20c","\"q\""],"empty":[""]}` {
+		t.Errorf("rawCookies = %s", got)
+	}
+	if diff := cmp.Diff(map[string][]string{"a": {"b c", "q"}, "empty": {""}}, req.Cookies); diff != "" {
+		t.Errorf("cookies mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestServeHTTP_DuplicateCookies_SentInOrder(t *testing.T) {
+	cfg := defaultCfg()
+	cfg.RawCookies = true
+	p := &capturePool{}
+	h := newTestHandler(t, cfg, p)
+
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/", nil)
+	req.Header.Add("Cookie", "session=one; session=two%21")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if p.req == nil {
+		t.Fatal("the request was not sent to the worker")
+	}
+
+	values := p.req.GetCookies()["session"].GetValue()
+	if len(values) != 2 || string(values[0]) != "one" || string(values[1]) != "two!" {
+		t.Errorf("session cookie = %q, want both values in order", values)
+	}
+
+	raw := p.req.GetAttributes()[RawCookiesAttribute]
+	if raw == nil || string(raw.GetValue()[0]) != `{"session":["one","two%21"]}` {
+		t.Errorf("%s attribute = %v, want the undecoded values", RawCookiesAttribute, raw)
+	}
+}
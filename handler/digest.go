@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"crypto/md5" //nolint:gosec
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"hash/crc32"
+	"image"
+	// the image formats known to image.DecodeConfig
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+
+	"github.com/roadrunner-server/http/v6/config"
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// digests enriches the stored files with the checksums computed on the way to disk and the image dimensions,
+// so the worker does not have to re-read the files.
+type digests struct {
+	checksums []string
+	imageSize bool
+}
+
+func newDigests(cfg *config.Uploads) *digests {
+	if len(cfg.Checksums) == 0 && !cfg.ImageSize {
+		return nil
+	}
+
+	return &digests{
+		checksums: cfg.Checksums,
+		imageSize: cfg.ImageSize,
+	}
+}
+
+// writer returns dst teeing the content into the configured hashes.
+func (d *digests) writer(dst io.Writer) (io.Writer, map[string]hash.Hash) {
+	if d == nil || len(d.checksums) == 0 {
+		return dst, nil
+	}
+
+	hashes := make(map[string]hash.Hash, len(d.checksums))
+	writers := []io.Writer{dst}
+	for _, c := range d.checksums {
+		h := newHash(c)
+		hashes[c] = h
+		writers = append(writers, h)
+	}
+
+	return io.MultiWriter(writers...), hashes
+}
+
+// apply sets the checksums and the image dimensions of the stored file.
+func (d *digests) apply(f *FileUpload, hashes map[string]hash.Hash) {
+	if d == nil {
+		return
+	}
+
+	if len(hashes) > 0 {
+		f.Checksums = make(map[string]string, len(hashes))
+		for c, h := range hashes {
+			f.Checksums[c] = hex.EncodeToString(h.Sum(nil))
+		}
+	}
+
+	if d.imageSize {
+		f.Width, f.Height = imageSize(f.TempFilename)
+	}
+}
+
+func newHash(checksum string) hash.Hash {
+	switch checksum {
+	case config.ChecksumMD5:
+		return md5.New() //nolint:gosec
+	case config.ChecksumCRC32C:
+		return crc32.New(castagnoli)
+	default:
+		return sha256.New()
+	}
+}
+
+// imageSize reads the image header only, 0 - not an image (or an unknown format).
+func imageSize(filename string) (int, int) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return 0, 0
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	cfg, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return 0, 0
+	}
+
+	return cfg.Width, cfg.Height
+}
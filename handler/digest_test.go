@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/roadrunner-server/http/v6/config"
+)
+
+func digestUploads(t *testing.T, checksums []string, imageSize bool) *uploads {
+	t.Helper()
+
+	cfg := &config.Uploads{Dir: t.TempDir(), Checksums: checksums, ImageSize: imageSize}
+	if err := cfg.InitDefaults(); err != nil {
+		t.Fatal(err)
+	}
+
+	return &uploads{dir: cfg.Dir, mime: newMimeRules(cfg), digests: newDigests(cfg)}
+}
+
+func TestFileUploadStore_Checksums(t *testing.T) {
+	up := digestUploads(t, []string{"SHA256", "md5", "crc32c", "md5"}, false)
+
+	f := newPartUpload(newFilePart(t, "hello.txt"), 0, 0)
+	if err := f.store(strings.NewReader("hello world"), up, nil, -1); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { (&Uploads{list: []*FileUpload{f}}).Clear(nil) })
+
+	want := map[string]string{
+		"sha256": "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9",
+		"md5":    "5eb63bbbe01eeed093cb22bb8f5acdc3",
+		"crc32c": "c99465aa",
+	}
+
+	if len(f.Checksums) != len(want) {
+		t.Fatalf("Checksums = %v, want %v", f.Checksums, want)
+	}
+	for c, sum := range want {
+		if f.Checksums[c] != sum {
+			t.Errorf("%s = %s, want %s", c, f.Checksums[c], sum)
+		}
+	}
+
+	if f.Width != 0 || f.Height != 0 {
+		t.Errorf("size = %dx%d, want no image size", f.Width, f.Height)
+	}
+}
+
+func TestFileUploadStore_ChecksumsWithSniffing(t *testing.T) {
+	up := digestUploads(t, []string{config.ChecksumSHA256}, false)
+	up.mime = &mimeRules{}
+
+	content := strings.Repeat("a", sniffLen*3)
+	f := newPartUpload(newFilePart(t, "a.txt"), 0, 0)
+	if err := f.store(strings.NewReader(content), up, nil, -1); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { (&Uploads{list: []*FileUpload{f}}).Clear(nil) })
+
+	// the sniffed head is hashed too
+	up.mime = nil
+	g := newPartUpload(newFilePart(t, "b.txt"), 0, 0)
+	if err := g.store(strings.NewReader(content), up, nil, -1); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { (&Uploads{list: []*FileUpload{g}}).Clear(nil) })
+
+	if f.Checksums["sha256"] != g.Checksums["sha256"] {
+		t.Errorf("sha256 = %s with sniffing, %s without", f.Checksums["sha256"], g.Checksums["sha256"])
+	}
+}
+
+func TestFileUploadStore_NoChecksumsForDroppedFile(t *testing.T) {
+	up := digestUploads(t, []string{config.ChecksumSHA256}, true)
+
+	f := newPartUpload(newFilePart(t, "big.txt"), 0, 0)
+	if err := f.store(strings.NewReader("too large"), up, nil, 4); !errors.Is(err, errTooLarge) {
+		t.Fatalf("error = %v, want %v", err, errTooLarge)
+	}
+
+	if f.Checksums != nil {
+		t.Errorf("Checksums = %v, want none for the dropped file", f.Checksums)
+	}
+}
+
+func TestFileUploadStore_ImageSize(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 320, 200))); err != nil {
+		t.Fatal(err)
+	}
+
+	up := digestUploads(t, nil, true)
+
+	tests := []struct {
+		filename string
+		content  string
+		width    int
+		height   int
+	}{
+		{"logo.png", buf.String(), 320, 200},
+		{"notes.png", "not an image", 0, 0},
+	}
+
+	for _, tt := range tests {
+		f := newPartUpload(newFilePart(t, tt.filename), 0, 0)
+		if err := f.store(strings.NewReader(tt.content), up, nil, -1); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { (&Uploads{list: []*FileUpload{f}}).Clear(nil) })
+
+		if f.Width != tt.width || f.Height != tt.height {
+			t.Errorf("%s: size = %dx%d, want %dx%d", tt.filename, f.Width, f.Height, tt.width, tt.height)
+		}
+		if f.Checksums != nil {
+			t.Errorf("%s: Checksums = %v, want none", tt.filename, f.Checksums)
+		}
+	}
+}
+
+func TestUploadsConfig_UnknownChecksum(t *testing.T) {
+	cfg := &config.Uploads{Checksums: []string{"sha1"}}
+	if err := cfg.InitDefaults(); err == nil {
+		t.Error("expected an error for the unknown checksum")
+	}
+}
@@ -0,0 +1,352 @@
+package handler
+
+import (
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	httpV1proto "github.com/roadrunner-server/api-go/v6/http/v1"
+	"github.com/roadrunner-server/http/v6/config"
+)
+
+const linkHeader string = "Link"
+
+// link relations worth sending before the final response
+var hintRels = []string{"preload", "modulepreload", "preconnect"}
+
+// preload destinations of the legacy Http2-Push targets
+var pushAs = map[string]string{
+	".css":   "style",
+	".js":    "script",
+	".mjs":   "script",
+	".woff":  "font",
+	".woff2": "font",
+	".ttf":   "font",
+	".otf":   "font",
+	".png":   "image",
+	".jpg":   "image",
+	".jpeg":  "image",
+	".gif":   "image",
+	".svg":   "image",
+	".webp":  "image",
+	".avif":  "image",
+}
+
+// earlyHints turns the preload links of the worker responses into 103 Early Hints.
+type earlyHints struct {
+	routes map[string][]string
+	// nil without the cache
+	cache *hintsCache
+}
+
+// hintsState is the early hints state of a single request.
+type hintsState struct {
+	// cache key, empty - the response is not cached
+	route string
+	// the client could not receive the informational responses
+	disabled bool
+	// links already sent to the client
+	sent map[string]struct{}
+}
+
+func newEarlyHints(cfg *config.EarlyHints) *earlyHints {
+	if cfg == nil {
+		return nil
+	}
+
+	eh := &earlyHints{routes: cfg.Routes}
+	if cfg.Cache {
+		eh.cache = &hintsCache{
+			ttl:     cfg.CacheTTL,
+			size:    cfg.CacheSize,
+			entries: make(map[string]hintsEntry),
+			now:     time.Now,
+		}
+	}
+
+	return eh
+}
+
+// start sends the configured and the cached links of the route before the request goes to the worker.
+func (eh *earlyHints) start(w http.ResponseWriter, r *http.Request) *hintsState {
+	if eh == nil {
+		return nil
+	}
+
+	st := &hintsState{
+		// HTTP/1.0 clients do not expect the informational responses
+		disabled: !r.ProtoAtLeast(1, 1),
+		sent:     make(map[string]struct{}),
+	}
+
+	if eh.cache != nil && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+		st.route = r.Host + r.URL.Path
+	}
+
+	if st.disabled {
+		return st
+	}
+
+	links := slices.Clone(eh.routes[r.URL.Path])
+	if st.route != "" {
+		links = append(links, eh.cache.get(st.route)...)
+	}
+
+	st.send(w, links)
+
+	return st
+}
+
+// final sends the preload links of the final worker response which were not sent yet and caches them for the route.
+// The legacy Http2-Push header is converted into the preload links and removed from the response, without the
+// early hints the links are added to the Link header of the final response.
+func (eh *earlyHints) final(w http.ResponseWriter, headers map[string]*httpV1proto.HeaderValue, st *hintsState) {
+	push := pushLinks(headers)
+	if eh == nil {
+		if len(push) == 0 {
+			return
+		}
+
+		hv, ok := headers[linkHeader]
+		if !ok {
+			hv = &httpV1proto.HeaderValue{}
+			headers[linkHeader] = hv
+		}
+
+		for _, link := range push {
+			hv.Value = append(hv.Value, []byte(link))
+		}
+
+		return
+	}
+
+	if st == nil {
+		st = &hintsState{sent: make(map[string]struct{})}
+	}
+
+	var links []string
+	for k, hv := range headers {
+		if strings.EqualFold(k, linkHeader) {
+			links = append(links, hintLinks(hv.GetValue())...)
+		}
+	}
+
+	links = append(links, push...)
+
+	if st.route != "" {
+		eh.cache.put(st.route, links)
+	}
+
+	if !st.disabled {
+		st.send(w, links)
+	}
+}
+
+// pushLinks removes the Http2-Push header and returns its targets as the preload links.
+func pushLinks(headers map[string]*httpV1proto.HeaderValue) []string {
+	hv, ok := headers[HTTP2Push]
+	if !ok {
+		return nil
+	}
+
+	delete(headers, HTTP2Push)
+
+	links := make([]string, 0, len(hv.GetValue()))
+	for _, target := range hv.GetValue() {
+		links = append(links, pushLink(string(target)))
+	}
+
+	return links
+}
+
+// record remembers the links of the 103 response sent by the worker itself.
+func (st *hintsState) record(headers map[string]*httpV1proto.HeaderValue) {
+	if st == nil {
+		return
+	}
+
+	for k, hv := range headers {
+		if !strings.EqualFold(k, linkHeader) {
+			continue
+		}
+
+		for _, link := range splitLinks(hv.GetValue()) {
+			st.sent[link] = struct{}{}
+		}
+	}
+}
+
+// send writes the 103 response with the links which were not sent yet.
+func (st *hintsState) send(w http.ResponseWriter, links []string) {
+	hv := &httpV1proto.HeaderValue{}
+	for _, link := range links {
+		if _, ok := st.sent[link]; ok {
+			continue
+		}
+
+		st.sent[link] = struct{}{}
+		hv.Value = append(hv.Value, []byte(link))
+	}
+
+	if len(hv.GetValue()) == 0 {
+		return
+	}
+
+	writeInformational(http.StatusEarlyHints, map[string]*httpV1proto.HeaderValue{linkHeader: hv}, w)
+}
+
+// hintLinks returns the links with the preload, modulepreload or preconnect relation.
+func hintLinks(values [][]byte) []string {
+	var links []string
+	for _, link := range splitLinks(values) {
+		if hintLink(link) {
+			links = append(links, link)
+		}
+	}
+
+	return links
+}
+
+// splitLinks splits the Link header values into the single links, commas inside the URI and quotes are kept.
+func splitLinks(values [][]byte) []string {
+	var links []string
+	for _, v := range values {
+		inURI, inQuotes, start := false, false, 0
+		for i, c := range v {
+			switch {
+			case c == '<' && !inQuotes:
+				inURI = true
+			case c == '>' && !inQuotes:
+				inURI = false
+			case c == '"' && !inURI:
+				inQuotes = !inQuotes
+			case c == ',' && !inURI && !inQuotes:
+				links = appendLink(links, v[start:i])
+				start = i + 1
+			}
+		}
+
+		links = appendLink(links, v[start:])
+	}
+
+	return links
+}
+
+func appendLink(links []string, link []byte) []string {
+	if l := strings.TrimSpace(string(link)); l != "" {
+		return append(links, l)
+	}
+
+	return links
+}
+
+func hintLink(link string) bool {
+	_, params, ok := strings.Cut(link, ">")
+	if !ok {
+		return false
+	}
+
+	for param := range strings.SplitSeq(params, ";") {
+		k, v, ok := strings.Cut(param, "=")
+		if !ok || !strings.EqualFold(strings.TrimSpace(k), "rel") {
+			continue
+		}
+
+		for rel := range strings.FieldsSeq(strings.Trim(strings.TrimSpace(v), `"`)) {
+			if slices.ContainsFunc(hintRels, func(r string) bool { return strings.EqualFold(r, rel) }) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// pushLink converts the Http2-Push target into the preload link.
+func pushLink(target string) string {
+	link := "<" + target + ">; rel=preload"
+
+	ext := target
+	if i := strings.IndexAny(ext, "?#"); i >= 0 {
+		ext = ext[:i]
+	}
+
+	as, ok := pushAs[strings.ToLower(path.Ext(ext))]
+	if !ok {
+		return link
+	}
+
+	link += "; as=" + as
+	if as == "font" {
+		// fonts are always fetched in the CORS mode
+		link += "; crossorigin"
+	}
+
+	return link
+}
+
+type hintsEntry struct {
+	links   []string
+	expires time.Time
+}
+
+// hintsCache keeps the preload links of the worker responses per route.
+type hintsCache struct {
+	ttl  time.Duration
+	size int
+	now  func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]hintsEntry
+}
+
+func (c *hintsCache) get(route string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[route]
+	if !ok {
+		return nil
+	}
+
+	if c.now().After(e.expires) {
+		delete(c.entries, route)
+		return nil
+	}
+
+	return e.links
+}
+
+// put stores the links of the route, a response without the links removes the route.
+func (c *hintsCache) put(route string, links []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(links) == 0 {
+		delete(c.entries, route)
+		return
+	}
+
+	now := c.now()
+	if _, ok := c.entries[route]; !ok && len(c.entries) >= c.size {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+
+		// still full, evict any route
+		for k := range c.entries {
+			if len(c.entries) < c.size {
+				break
+			}
+
+			delete(c.entries, k)
+		}
+	}
+
+	c.entries[route] = hintsEntry{links: links, expires: now.Add(c.ttl)}
+}
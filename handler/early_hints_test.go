@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/roadrunner-server/http/v6/config"
+)
+
+func TestSplitLinks(t *testing.T) {
+	got := splitLinks([][]byte{
+		[]byte(`</a.css>; rel=preload; as=style, </b,c.js>; rel="preload"; title="x, y"`),
+		[]byte(` </d.js>; rel=modulepreload ,`),
+	})
+
+	want := []string{
+		"</a.css>; rel=preload; as=style",
+		`</b,c.js>; rel="preload"; title="x, y"`,
+		"</d.js>; rel=modulepreload",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("links = %q, want %q", got, want)
+	}
+}
+
+func TestHintLink(t *testing.T) {
+	tests := []struct {
+		link string
+		want bool
+	}{
+		{"</a.css>; rel=preload; as=style", true},
+		{`</a.css>; REL="Preload"`, true},
+		{"<https://cdn.example.com>; rel=preconnect", true},
+		{`</a.js>; rel="modulepreload stylesheet"`, true},
+		{"</next>; rel=next", false},
+		{"</a.css>; as=style", false},
+		{"no uri", false},
+	}
+
+	for _, tt := range tests {
+		if got := hintLink(tt.link); got != tt.want {
+			t.Errorf("hintLink(%q) = %v, want %v", tt.link, got, tt.want)
+		}
+	}
+}
+
+func TestPushLink(t *testing.T) {
+	tests := map[string]string{
+		"/a.css":          "</a.css>; rel=preload; as=style",
+		"/app.js?v=2":     "</app.js?v=2>; rel=preload; as=script",
+		"/font.WOFF2":     "</font.WOFF2>; rel=preload; as=font; crossorigin",
+		"/logo.svg#icon":  "</logo.svg#icon>; rel=preload; as=image",
+		"/data.json":      "</data.json>; rel=preload",
+		"/no-extension/x": "</no-extension/x>; rel=preload",
+	}
+
+	for target, want := range tests {
+		if got := pushLink(target); got != want {
+			t.Errorf("pushLink(%q) = %q, want %q", target, got, want)
+		}
+	}
+}
+
+func TestHintsCache(t *testing.T) {
+	now := time.Unix(100, 0)
+	c := &hintsCache{
+		ttl:     time.Minute,
+		size:    2,
+		entries: make(map[string]hintsEntry),
+		now:     func() time.Time { return now },
+	}
+
+	c.put("a", []string{"</a.css>; rel=preload"})
+	if got := c.get("a"); len(got) != 1 {
+		t.Fatalf("get(a) = %v, want the cached link", got)
+	}
+
+	// a response without the links removes the route
+	c.put("a", nil)
+	if got := c.get("a"); got != nil {
+		t.Errorf("get(a) = %v, want nil after an empty response", got)
+	}
+
+	c.put("a", []string{"</a.css>; rel=preload"})
+	c.put("b", []string{"</b.css>; rel=preload"})
+	c.put("c", []string{"</c.css>; rel=preload"})
+	if len(c.entries) != 2 {
+		t.Errorf("entries = %d, want the cache size 2", len(c.entries))
+	}
+	if c.get("c") == nil {
+		t.Error("the new route must be cached after the eviction")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if got := c.get("c"); got != nil {
+		t.Errorf("get(c) = %v, want nil after the ttl", got)
+	}
+}
+
+func TestEarlyHints_Start(t *testing.T) {
+	eh := newEarlyHints(&config.EarlyHints{
+		Routes:    map[string][]string{"/": {"</app.css>; rel=preload; as=style"}},
+		Cache:     true,
+		CacheTTL:  time.Minute,
+		CacheSize: 10,
+	})
+
+	r := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "http://example.com/?q=1", nil)
+	eh.cache.put("example.com/", []string{"</app.js>; rel=preload; as=script"})
+
+	rr := &hintRecorder{}
+	st := eh.start(rr, r)
+
+	if st.route != "example.com/" {
+		t.Errorf("route = %q, want the host and path", st.route)
+	}
+	if len(rr.hints) != 1 {
+		t.Fatalf("hints = %+v, want a single 103", rr.hints)
+	}
+	want := []string{"</app.css>; rel=preload; as=style", "</app.js>; rel=preload; as=script"}
+	if got := rr.hints[0].header.Values("Link"); !slices.Equal(got, want) {
+		t.Errorf("hint Link = %v, want %v", got, want)
+	}
+
+	// the POST responses are not cached
+	post := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "http://example.com/", nil)
+	if st := eh.start(&hintRecorder{}, post); st.route != "" {
+		t.Errorf("route = %q, want empty for POST", st.route)
+	}
+
+	// HTTP/1.0 clients do not get the informational responses
+	old := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "http://example.com/", nil)
+	old.ProtoMajor, old.ProtoMinor = 1, 0
+	rr = &hintRecorder{}
+	if st := eh.start(rr, old); !st.disabled || len(rr.hints) != 0 {
+		t.Errorf("state = %+v, hints = %+v, want disabled without hints", st, rr.hints)
+	}
+}
+
+func TestServeHTTP_EarlyHintsBeforeWorker(t *testing.T) {
+	cfg := defaultCfg()
+	cfg.EarlyHints = &config.EarlyHints{Routes: map[string][]string{"/": {"</app.css>; rel=preload; as=style"}}}
+	h := newTestHandler(t, cfg, &mockPool{execErr: fmt.Errorf("worker died")})
+
+	rr := &hintRecorder{}
+	h.ServeHTTP(rr, httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/", nil))
+
+	if len(rr.hints) != 1 || rr.hints[0].header.Get("Link") != "</app.css>; rel=preload; as=style" {
+		t.Errorf("hints = %+v, want the route links", rr.hints)
+	}
+	if rr.code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", rr.code, http.StatusInternalServerError)
+	}
+}
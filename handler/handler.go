@@ -29,6 +29,29 @@ type uploads struct {
 	dir    string
 	allow  map[string]struct{}
 	forbid map[string]struct{}
+	// nil - unlimited
+	cfg *config.Uploads
+	// nil - the content is not sniffed
+	mime *mimeRules
+	// nil - no checksums and image dimensions
+	digests *digests
+	// nil - the files are not scanned
+	scan *scanPolicy
+	// the files claimed by the worker are moved to, empty - kept in place
+	claimDir string
+	// the temp files of the requests being served, nil - not tracked (no janitor)
+	inflight *inflight
+}
+
+var unlimited = &config.UploadLimits{}
+
+// limits returns the upload limits of the request path.
+func (u *uploads) limits(path string) *config.UploadLimits {
+	if u.cfg == nil {
+		return unlimited
+	}
+
+	return u.cfg.Limits(path)
 }
 
 // Handler serves http connections to underlying PHP application using PSR-7 protocol. Context will include request headers,
@@ -38,9 +61,22 @@ type Handler struct {
 	log         *slog.Logger
 	pool        api.Pool
 	internalCtx context.Context
+	// nil when the early hints are disabled
+	hints *earlyHints
+	// nil when the resumable uploads are disabled
+	tus *tus
+	// nil when the orphaned uploads are kept
+	janitor *janitor
+	// nil when the JSON bodies are sent as is
+	json *jsonRules
+	// the form fields limits
+	input *inputLimits
+	// the cookies decoding
+	cookies *cookieRules
 
 	internalHTTPCode uint64
 	sendRawBody      bool
+	parseQuery       bool
 	debugMode        bool
 
 	// permissions
@@ -57,17 +93,39 @@ type Handler struct {
 
 // NewHandler return 'handler' interface implementation
 func NewHandler(cfg *config.Config, pool api.Pool, log *slog.Logger) (*Handler, error) {
+	const op = errors.Op("http_handler_new")
+
+	scan, err := newScanPolicy(cfg.Uploads.Scan, log)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	files := newInflight(cfg.Uploads)
+
 	return &Handler{
 		uploads: &uploads{
-			dir:    cfg.Uploads.Dir,
-			allow:  cfg.Uploads.Allowed,
-			forbid: cfg.Uploads.Forbidden,
+			dir:      cfg.Uploads.Dir,
+			allow:    cfg.Uploads.Allowed,
+			forbid:   cfg.Uploads.Forbidden,
+			cfg:      cfg.Uploads,
+			mime:     newMimeRules(cfg.Uploads),
+			digests:  newDigests(cfg.Uploads),
+			scan:     scan,
+			claimDir: cfg.Uploads.ClaimDir,
+			inflight: files,
 		},
+		hints:            newEarlyHints(cfg.EarlyHints),
+		tus:              newTus(cfg.Uploads, cfg.UID, cfg.GID),
+		janitor:          newJanitor(cfg.Uploads, files, log),
+		json:             newJSONRules(cfg),
+		input:            newInputLimits(cfg),
+		cookies:          newCookieRules(cfg),
 		pool:             pool,
 		debugMode:        checkDebug(cfg),
 		log:              log,
 		internalHTTPCode: cfg.InternalErrorCode,
 		sendRawBody:      cfg.RawBody,
+		parseQuery:       cfg.ParseQuery,
 		internalCtx:      context.Background(),
 
 		// permissions
@@ -83,7 +141,7 @@ func NewHandler(cfg *config.Config, pool api.Pool, log *slog.Logger) (*Handler,
 			New: func() any {
 				return &Request{
 					Attributes: make(map[string][]string),
-					Cookies:    make(map[string]string),
+					Cookies:    make(map[string][]string),
 					body:       nil,
 				}
 			},
@@ -118,13 +176,21 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	const op = errors.Op("serve_http")
 	start := time.Now()
 
+	if h.tus.match(r.URL.Path) {
+		h.serveTus(w, r, start)
+		return
+	}
+
 	req := h.getReq(r)
-	err := request(r, req, h.uid, h.gid, h.sendRawBody)
+	err := request(r, req, h.uploads, h.input, h.json, h.uid, h.gid, h.sendRawBody)
+	if err == nil && h.parseQuery {
+		err = req.parseQuery(h.input)
+	}
 	if err != nil {
 		// if the pipe is broken, there is no sense to write the header
 		// in this case, we just report about error
 		if stderr.Is(err, errEPIPE) {
-			req.Close(h.log, r)
+			req.Close(h.log)
 			h.putReq(req)
 			h.log.Error(
 				"write response error",
@@ -135,15 +201,25 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		req.Close(h.log, r)
+		req.Close(h.log)
 		h.putReq(req)
 		// a request-forming error is a bad request, not a server fault:
 		// request() only touches client-supplied bytes. Default to 400 and let
-		// the size-limit branch bump it to 413.
+		// the size-limit branches bump it to 413.
 		status := http.StatusBadRequest
 		if _, ok := stderr.AsType[*http.MaxBytesError](err); ok {
 			status = http.StatusRequestEntityTooLarge
 		}
+		if _, ok := stderr.AsType[*uploadLimitError](err); ok {
+			status = http.StatusRequestEntityTooLarge
+		}
+		if _, ok := stderr.AsType[*inputLimitError](err); ok {
+			status = http.StatusRequestEntityTooLarge
+		}
+		// the scanner is unavailable, the files must not reach the worker unscanned
+		if _, ok := stderr.AsType[*scanError](err); ok {
+			status = http.StatusServiceUnavailable
+		}
 		http.Error(w, errors.E(op, err).Error(), status)
 		h.log.Error(
 			"request forming error",
@@ -154,15 +230,20 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	req.Open(h.log, h.uploads.dir, h.uploads.forbid, h.uploads.allow)
+	h.exec(w, r, req, start)
+}
+
+// exec sends the formed request to the worker and writes the response, the request is released.
+func (h *Handler) exec(w http.ResponseWriter, r *http.Request, req *Request, start time.Time) {
+	req.Report(h.log)
 	// get payload from the pool
 	pld := h.getPld()
 	// get proto request from the pool
 	reqproto := h.getProtoReq(req)
-	err = req.Payload(pld, h.sendRawBody, reqproto)
+	err := req.Payload(pld, h.sendRawBody, reqproto)
 	h.putProtoReq(reqproto)
 	if err != nil {
-		req.Close(h.log, r)
+		req.Close(h.log)
 		h.putReq(req)
 		h.putPld(pld)
 		h.handleError(w, err)
@@ -175,10 +256,13 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// the configured and the cached preload links go out before the worker starts
+	hints := h.hints.start(w, r)
+
 	stopCh := h.getCh()
 	wResp, err := h.pool.Exec(h.internalCtx, pld, stopCh)
 	if err != nil {
-		req.Close(h.log, r)
+		req.Close(h.log)
 		h.putReq(req)
 		h.putPld(pld)
 		h.putCh(stopCh)
@@ -191,7 +275,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	for recv := range wResp {
 		if recv.Error() != nil {
-			req.Close(h.log, r)
+			req.Close(h.log)
 			h.putReq(req)
 			h.putCh(stopCh)
 			w.WriteHeader(int(h.internalHTTPCode)) //nolint:gosec
@@ -202,7 +286,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		err = h.Write(recv.Payload(), w)
+		err = h.write(recv.Payload(), w, hints, req.Uploads)
 		if err != nil {
 			// send a stop signal to the worker pool
 			select {
@@ -218,11 +302,16 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	req.Close(h.log, r)
+	req.Close(h.log)
 	h.putReq(req)
 	h.putCh(stopCh)
 }
 
+// Stop stops the background cleanup of the uploads dir.
+func (h *Handler) Stop() {
+	h.janitor.close()
+}
+
 // handleError will handle internal RR errors and return 500
 func (h *Handler) handleError(w http.ResponseWriter, err error) {
 	// if there are no free workers -> write a special header
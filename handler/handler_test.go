@@ -352,3 +352,62 @@ func TestServeHTTP_NoFreeWorkers_SetsHeader(t *testing.T) {
 		t.Errorf("expected 500, got %d", rr.Code)
 	}
 }
+
+func TestServeHTTP_ParseQuery_SentAsAttribute(t *testing.T) {
+	cfg := defaultCfg()
+	cfg.ParseQuery = true
+	p := &capturePool{}
+	h := newTestHandler(t, cfg, p)
+
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/?a[b][]=1&a[b][]=2&c=3", nil)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if p.req == nil {
+		t.Fatal("the request was not sent to the worker")
+	}
+	if p.req.GetRawQuery() != "a[b][]=1&a[b][]=2&c=3" {
+		t.Errorf("RawQuery = %q, want it kept", p.req.GetRawQuery())
+	}
+
+	attr := p.req.GetAttributes()[QueryAttribute]
+	if attr == nil || string(attr.GetValue()[0]) != `{"a":{"b":["1","2"]},"c":"3"}` {
+		t.Errorf("%s attribute = %v, want the query tree", QueryAttribute, attr)
+	}
+}
+
+func TestServeHTTP_ParseQuery_SkipsMalformedPairs(t *testing.T) {
+	cfg := defaultCfg()
+	cfg.ParseQuery = true
+	p := &capturePool{}
+	h := newTestHandler(t, cfg, p)
+
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/?a=%zz&c=3", nil)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if p.req == nil {
+		t.Fatal("the request with a malformed query was not sent to the worker")
+	}
+	if p.req.GetRawQuery() != "a=%zz&c=3" {
+		t.Errorf("RawQuery = %q, want it kept", p.req.GetRawQuery())
+	}
+
+	attr := p.req.GetAttributes()[QueryAttribute]
+	if attr == nil || string(attr.GetValue()[0]) != `{"c":"3"}` {
+		t.Errorf("%s attribute = %v, want the valid pairs", QueryAttribute, attr)
+	}
+}
+
+func TestServeHTTP_ParseQuery_TooManyVars_Returns413(t *testing.T) {
+	cfg := defaultCfg()
+	cfg.ParseQuery = true
+	cfg.MaxInputVars = 2
+	h := newTestHandler(t, cfg, nil)
+
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/?a=1&b=2&c=3", nil)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413, got %d", rr.Code)
+	}
+}
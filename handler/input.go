@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"io"
+
+	"github.com/roadrunner-server/errors"
+	"github.com/roadrunner-server/http/v6/config"
+)
+
+// inputLimits protects the form parsing from the crafted forms, the same as PHP max_input_vars and
+// max_input_nesting_level. 0 - unlimited.
+type inputLimits struct {
+	maxVars      int
+	maxNesting   int
+	maxKeyLength int
+}
+
+func newInputLimits(cfg *config.Config) *inputLimits {
+	return &inputLimits{
+		maxVars:      cfg.MaxInputVars,
+		maxNesting:   cfg.MaxInputNesting,
+		maxKeyLength: cfg.MaxInputKeyLength,
+	}
+}
+
+// inputLimitError rejects the form with too many fields with 413.
+type inputLimitError struct {
+	limit string
+}
+
+func (e *inputLimitError) Error() string {
+	return "input limit exceeded: " + e.limit
+}
+
+// key validates the form field name, the name too long or too deep is a bad request.
+func (l *inputLimits) key(k string) error {
+	const op = errors.Op("input_limits")
+	if l == nil {
+		return nil
+	}
+
+	if l.maxKeyLength > 0 && len(k) > l.maxKeyLength {
+		return errors.E(op, errors.Errorf("the form field name exceeds max_input_key_length (%d)", l.maxKeyLength))
+	}
+
+	// a[b][c] is nested twice
+	if l.maxNesting > 0 && len(fetchIndexes(k))-1 > l.maxNesting {
+		return errors.E(op, errors.Errorf("the form field %.64q exceeds max_input_nesting (%d)", k, l.maxNesting))
+	}
+
+	return nil
+}
+
+// vars checks the number of the form fields.
+func (l *inputLimits) vars(n int) error {
+	if l == nil || l.maxVars <= 0 || n <= l.maxVars {
+		return nil
+	}
+
+	return &inputLimitError{limit: "max_input_vars"}
+}
+
+// body stops reading the urlencoded body as soon as it has more fields than allowed, before it is parsed.
+func (l *inputLimits) body(rc io.ReadCloser) io.ReadCloser {
+	if l == nil || l.maxVars <= 0 {
+		return rc
+	}
+
+	return &fieldCounter{ReadCloser: rc, left: l.maxVars}
+}
+
+// fieldCounter counts the non-empty pairs, the same as the parsed ones (a=1&&b=2 has 2 fields).
+type fieldCounter struct {
+	io.ReadCloser
+	left int
+	// inside a non-empty pair
+	pair bool
+}
+
+func (c *fieldCounter) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	for _, b := range p[:n] {
+		switch {
+		case b == '&':
+			c.pair = false
+		case !c.pair:
+			c.pair = true
+			c.left--
+		}
+	}
+
+	if c.left < 0 {
+		return n, &inputLimitError{limit: "max_input_vars"}
+	}
+
+	return n, err
+}
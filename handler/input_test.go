@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/roadrunner-server/http/v6/config"
+)
+
+func TestInputLimits_Key(t *testing.T) {
+	in := &inputLimits{maxNesting: 2, maxKeyLength: 16}
+
+	tests := []struct {
+		key string
+		ok  bool
+	}{
+		{"name", true},
+		{"user[address][city]", false},
+		{"user[tags][]", true},
+		{"a[b][c][d]", false},
+		{strings.Repeat("k", 17), false},
+	}
+
+	for _, tt := range tests {
+		if err := in.key(tt.key); (err == nil) != tt.ok {
+			t.Errorf("key(%q) = %v, want ok = %v", tt.key, err, tt.ok)
+		}
+	}
+
+	var unlimited *inputLimits
+	if err := unlimited.key(strings.Repeat("[a]", 200)); err != nil {
+		t.Errorf("nil limits: %v", err)
+	}
+}
+
+func TestInputLimits_NestingWithinMaxLevel(t *testing.T) {
+	cfg := &config.Config{Address: "127.0.0.1:8080", MaxInputNesting: config.MaxInputNestingLimit + 1}
+	if err := cfg.InitDefaults(); err == nil {
+		t.Fatal("expected an error for max_input_nesting deeper than the data tree")
+	}
+
+	// the deepest allowed field is kept, not dropped by the tree
+	key := "a" + strings.Repeat("[b]", config.MaxInputNestingLimit)
+	in := &inputLimits{maxNesting: config.MaxInputNestingLimit}
+	if err := in.key(key); err != nil {
+		t.Fatal(err)
+	}
+
+	data := make(dataTree)
+	if err := data.push(key, []string{"v"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(data) == 0 {
+		t.Error("the deepest allowed field was dropped")
+	}
+}
+
+func TestInputLimits_Body_StopsReading(t *testing.T) {
+	in := &inputLimits{maxVars: 3}
+
+	tests := []struct {
+		body string
+		ok   bool
+	}{
+		{"a=1&b=2&c=3", true},
+		{"a=1&b=2&c=3&d=4", false},
+		// the empty pairs are not fields
+		{"a=1&&&b=2&c=3&", true},
+		{"&a=1&b=2&&c=3&d", false},
+	}
+
+	for _, tt := range tests {
+		_, err := io.ReadAll(in.body(io.NopCloser(strings.NewReader(tt.body))))
+
+		var limitErr *inputLimitError
+		if ok := !errors.As(err, &limitErr); ok != tt.ok {
+			t.Errorf("%s: error = %v, want ok = %v", tt.body, err, tt.ok)
+		}
+	}
+}
+
+func TestRequest_URLEncoded_InputLimits(t *testing.T) {
+	in := &inputLimits{maxVars: 1000, maxNesting: 64, maxKeyLength: 1024}
+
+	fields := make([]string, 0, 1001)
+	for i := range 1001 {
+		fields = append(fields, fmt.Sprintf("f%d=v", i))
+	}
+
+	tests := []struct {
+		name  string
+		body  string
+		limit bool
+	}{
+		{"too many fields", strings.Join(fields, "&"), true},
+		{"too deep", "a" + strings.Repeat("[a]", 65) + "=1", false},
+		{"key too long", strings.Repeat("k", 1025) + "=1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			err := request(r, newPSRRequest(r), testUploads(t), in, nil, 0, 0, false)
+			if err == nil {
+				t.Fatal("expected an input limit error")
+			}
+
+			var limitErr *inputLimitError
+			if errors.As(err, &limitErr) != tt.limit {
+				t.Errorf("error = %v, want the 413 limit error = %v", err, tt.limit)
+			}
+		})
+	}
+}
+
+func TestParseMultipart_InputLimits(t *testing.T) {
+	in := &inputLimits{maxVars: 2, maxNesting: 1, maxKeyLength: 64}
+
+	t.Run("too many values", func(t *testing.T) {
+		r := newMultipartRequest(t, func(w *multipart.Writer) {
+			_ = w.WriteField("a", "1")
+			writeFile(t, w, "file", "a.txt", "files are not counted")
+			_ = w.WriteField("b", "2")
+			_ = w.WriteField("c", "3")
+		})
+
+		_, _, err := parseMultipart(r, &uploads{dir: t.TempDir()}, in, 0, 0)
+
+		var limitErr *inputLimitError
+		if !errors.As(err, &limitErr) {
+			t.Errorf("error = %v, want the max_input_vars error", err)
+		}
+	})
+
+	t.Run("file field too deep", func(t *testing.T) {
+		r := newMultipartRequest(t, func(w *multipart.Writer) {
+			writeFile(t, w, "docs[a][b]", "a.txt", "content")
+		})
+
+		if _, _, err := parseMultipart(r, &uploads{dir: t.TempDir()}, in, 0, 0); err == nil {
+			t.Error("expected an error for the nested field")
+		}
+	})
+
+	t.Run("within limits", func(t *testing.T) {
+		r := newMultipartRequest(t, func(w *multipart.Writer) {
+			_ = w.WriteField("user[name]", "john")
+			_ = w.WriteField("b", "2")
+			writeFile(t, w, "docs[]", "a.txt", "content")
+		})
+
+		_, u, err := parseMultipart(r, &uploads{dir: t.TempDir()}, in, 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u.Clear(nil)
+	})
+}
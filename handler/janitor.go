@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/roadrunner-server/http/v6/config"
+)
+
+// the uploads dir is swept at most once per interval
+const janitorInterval = time.Minute
+
+// janitor removes the orphaned temp files from the uploads dir: the files left by crashes and the claimed
+// files kept in place and never moved by the application.
+type janitor struct {
+	dir string
+	ttl time.Duration
+	log *slog.Logger
+	// the files of the requests being served
+	files *inflight
+	stop  chan struct{}
+	once  sync.Once
+}
+
+func newJanitor(cfg *config.Uploads, files *inflight, log *slog.Logger) *janitor {
+	if cfg.OrphanTTL == 0 {
+		return nil
+	}
+
+	j := &janitor{
+		dir:   cfg.Dir,
+		ttl:   cfg.OrphanTTL,
+		log:   log,
+		files: files,
+		stop:  make(chan struct{}),
+	}
+
+	go j.run()
+
+	return j
+}
+
+func (j *janitor) run() {
+	ticker := time.NewTicker(min(j.ttl, janitorInterval))
+	defer ticker.Stop()
+
+	// the files left by the previous run are swept on start
+	j.sweep(time.Now())
+
+	for {
+		select {
+		case <-j.stop:
+			return
+		case now := <-ticker.C:
+			j.sweep(now)
+		}
+	}
+}
+
+// sweep removes the temp files and the tus uploads without the upload info (completed, but not removed)
+// not modified for the TTL. The incomplete tus uploads expire on their own, the files of the requests
+// still being served (e.g. a slow worker) are kept.
+func (j *janitor) sweep(now time.Time) {
+	entries, err := os.ReadDir(j.dir)
+	if err != nil {
+		j.log.Error("error reading the uploads dir", "error", err)
+		return
+	}
+
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || j.files.has(name) || !orphan(j.dir, name) {
+			continue
+		}
+
+		fi, err := e.Info()
+		if err != nil || now.Sub(fi.ModTime()) < j.ttl {
+			continue
+		}
+
+		err = os.Remove(filepath.Join(j.dir, name))
+		if err != nil && !os.IsNotExist(err) {
+			j.log.Error("error removing the orphaned file", "name", name, "error", err)
+			continue
+		}
+
+		j.log.Debug("orphaned upload removed", "name", name)
+	}
+}
+
+func (j *janitor) close() {
+	if j == nil {
+		return
+	}
+
+	j.once.Do(func() {
+		close(j.stop)
+	})
+}
+
+func orphan(dir, name string) bool {
+	switch {
+	case strings.HasPrefix(name, pattern):
+		return true
+	case strings.HasPrefix(name, tusPrefix) && !strings.HasSuffix(name, tusInfoSuffix):
+		_, err := os.Stat(filepath.Join(dir, name+tusInfoSuffix))
+		return os.IsNotExist(err)
+	default:
+		return false
+	}
+}
+
+// inflight is the set of the temp files (the base names) of the requests being served.
+type inflight struct {
+	mu    sync.Mutex
+	files map[string]int
+}
+
+// newInflight returns nil when the orphaned uploads are kept, nothing is tracked then.
+func newInflight(cfg *config.Uploads) *inflight {
+	if cfg.OrphanTTL == 0 {
+		return nil
+	}
+
+	return &inflight{files: make(map[string]int)}
+}
+
+func (s *inflight) add(name string) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.files[filepath.Base(name)]++
+	s.mu.Unlock()
+}
+
+func (s *inflight) remove(name string) {
+	if s == nil {
+		return
+	}
+
+	name = filepath.Base(name)
+
+	s.mu.Lock()
+	if s.files[name]--; s.files[name] <= 0 {
+		delete(s.files, name)
+	}
+	s.mu.Unlock()
+}
+
+func (s *inflight) has(name string) bool {
+	if s == nil {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.files[name]
+	return ok
+}
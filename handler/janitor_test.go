@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/roadrunner-server/http/v6/config"
+)
+
+func TestJanitorSweep(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-time.Hour)
+
+	files := map[string]bool{
+		// name: removed
+		"upload123":           true,
+		"upload-fresh":        false,
+		"upload-inflight":     false,
+		"tus-completed":       true,
+		"tus-incomplete":      false,
+		"tus-incomplete.info": false,
+		"application.log":     false,
+	}
+
+	for name := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(uploadContent), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if name != "upload-fresh" {
+			if err := os.Chtimes(path, old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// the slow request still serving its upload
+	inflight := &inflight{files: make(map[string]int)}
+	inflight.add(filepath.Join(dir, "upload-inflight"))
+
+	j := &janitor{dir: dir, ttl: time.Minute * 30, log: slog.New(slog.DiscardHandler), files: inflight}
+	j.sweep(time.Now())
+
+	for name, removed := range files {
+		if exists(filepath.Join(dir, name)) == removed {
+			t.Errorf("%s: exists = %v, want removed = %v", name, !removed, removed)
+		}
+	}
+}
+
+func TestUploadsClear_ReleasesInflight(t *testing.T) {
+	dir := t.TempDir()
+	files := &inflight{files: make(map[string]int)}
+
+	r := newMultipartRequest(t, func(w *multipart.Writer) {
+		writeFile(t, w, "file", "a.txt", uploadContent)
+	})
+
+	_, u, err := parseMultipart(r, &uploads{dir: dir, inflight: files}, nil, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := filepath.Base(u.list[0].TempFilename)
+	if !files.has(name) {
+		t.Fatalf("%s is not tracked during the request", name)
+	}
+
+	u.Clear(nil)
+	if files.has(name) {
+		t.Errorf("%s is still tracked after the request", name)
+	}
+}
+
+func TestFileUploadStore_StalledUploadTracked(t *testing.T) {
+	dir := t.TempDir()
+	u := &Uploads{inflight: &inflight{files: make(map[string]int)}}
+	f := newPartUpload(newFilePart(t, "a.txt"), 0, 0)
+
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- f.store(pr, &uploads{dir: dir}, u, -1)
+	}()
+
+	// the upload stalls after the first bytes
+	if _, err := pw.Write([]byte("first")); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("entries = %v, err = %v, want the temp file", entries, err)
+	}
+
+	j := &janitor{dir: dir, ttl: time.Millisecond, log: slog.New(slog.DiscardHandler), files: u.inflight}
+	j.sweep(time.Now().Add(time.Hour))
+
+	_ = pw.Close()
+	if err = <-done; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { u.Clear(nil) })
+
+	if !exists(f.TempFilename) || f.Size != int64(len("first")) {
+		t.Errorf("the stalled upload was removed by the janitor, size = %d", f.Size)
+	}
+}
+
+func TestUploadsConfig_OrphanTTLRequiresDedicatedDir(t *testing.T) {
+	cfg := &config.Uploads{OrphanTTL: time.Hour}
+	if err := cfg.InitDefaults(); err == nil {
+		t.Fatal("expected an error for orphan_ttl in the system temp dir")
+	}
+
+	cfg = &config.Uploads{Dir: t.TempDir(), OrphanTTL: time.Hour}
+	if err := cfg.InitDefaults(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJanitorClose(t *testing.T) {
+	j := &janitor{dir: t.TempDir(), ttl: time.Millisecond, log: slog.New(slog.DiscardHandler), stop: make(chan struct{})}
+
+	done := make(chan struct{})
+	go func() {
+		j.run()
+		close(done)
+	}()
+
+	j.close()
+	j.close()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the janitor did not stop")
+	}
+}
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/roadrunner-server/errors"
+	"github.com/roadrunner-server/http/v6/config"
+)
+
+// jsonRules validates the JSON bodies sent to the worker as the parsed body (parse_json).
+type jsonRules struct {
+	maxDepth int
+	maxSize  int64
+}
+
+func newJSONRules(cfg *config.Config) *jsonRules {
+	if !cfg.ParseJSON {
+		return nil
+	}
+
+	return &jsonRules{
+		maxDepth: cfg.JSONMaxDepth,
+		maxSize:  int64(cfg.JSONMaxSize * mb), //nolint:gosec
+	}
+}
+
+// parse reads and validates the body. Only the objects and the arrays are parsed (PSR-7 parsed body is
+// an array or an object), the other values and the empty body are returned with parsed=false.
+// The body larger than maxSize is reported as *http.MaxBytesError (413).
+func (j *jsonRules) parse(r io.Reader) ([]byte, bool, error) {
+	const op = errors.Op("parse_json")
+
+	body, err := io.ReadAll(io.LimitReader(r, j.maxSize+1))
+	if err != nil {
+		return nil, false, err
+	}
+
+	if int64(len(body)) > j.maxSize {
+		return nil, false, errors.E(op, &http.MaxBytesError{Limit: j.maxSize})
+	}
+
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return body, false, nil
+	}
+
+	if !json.Valid(trimmed) {
+		return nil, false, errors.E(op, errors.Str("malformed JSON body"))
+	}
+
+	if jsonDepth(trimmed) > j.maxDepth {
+		return nil, false, errors.E(op, errors.Errorf("JSON body exceeds the maximum depth of %d", j.maxDepth))
+	}
+
+	return body, trimmed[0] == '{' || trimmed[0] == '[', nil
+}
+
+// jsonDepth returns the maximum nesting of the objects and the arrays of the valid JSON.
+func jsonDepth(data []byte) int {
+	depth, maxDepth := 0, 0
+	inString, escaped := false, false
+
+	for _, c := range data {
+		switch {
+		case escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '{' || c == '[':
+			depth++
+			maxDepth = max(maxDepth, depth)
+		case c == '}' || c == ']':
+			depth--
+		}
+	}
+
+	return maxDepth
+}
+
+// isJSON reports whether the content type is application/json or a +json structured syntax suffix.
+func isJSON(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return mt == "application/json" || strings.HasSuffix(mt, "+json")
+}
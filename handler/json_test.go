@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestJSONRules_Parse(t *testing.T) {
+	js := &jsonRules{maxDepth: 3, maxSize: 64}
+
+	tests := []struct {
+		name   string
+		body   string
+		parsed bool
+		err    bool
+	}{
+		{"object", `{"a": [1, {"b": 2}]}`, true, false},
+		{"array with leading whitespace", " \n[1, 2]", true, false},
+		{"scalar is not a parsed body", `"text"`, false, false},
+		{"empty body", "", false, false},
+		{"malformed", `{"a": 1`, false, true},
+		{"trailing garbage", `{"a": 1} {}`, false, true},
+		{"too deep", `[[[[1]]]]`, false, true},
+		{"brackets in strings do not count", `{"a": "[[[[{{{{"}`, true, false},
+		{"too large", `["` + strings.Repeat("x", 64) + `"]`, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, parsed, err := js.parse(strings.NewReader(tt.body))
+			if (err != nil) != tt.err {
+				t.Fatalf("error = %v, want error %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+
+			if parsed != tt.parsed {
+				t.Errorf("parsed = %v, want %v", parsed, tt.parsed)
+			}
+			if string(body) != tt.body {
+				t.Errorf("body = %q, want the body as is", body)
+			}
+		})
+	}
+}
+
+func TestJSONRules_TooLarge_MaxBytesError(t *testing.T) {
+	js := &jsonRules{maxDepth: 64, maxSize: 4}
+
+	_, _, err := js.parse(strings.NewReader(`[1, 2, 3]`))
+
+	var maxErr *http.MaxBytesError
+	if !errors.As(err, &maxErr) || maxErr.Limit != 4 {
+		t.Errorf("error = %v, want the max bytes error (413)", err)
+	}
+}
+
+func TestJSONDepth(t *testing.T) {
+	tests := map[string]int{
+		`1`:                         0,
+		`{}`:                        1,
+		`{"a": {"b": [1, [2]]}}`:    4,
+		`[{}, {}, [{}]]`:            3,
+		`{"a\"[": "\\", "b": [[]]}`: 3,
+	}
+
+	for data, want := range tests {
+		if got := jsonDepth([]byte(data)); got != want {
+			t.Errorf("jsonDepth(%s) = %d, want %d", data, got, want)
+		}
+	}
+}
+
+func TestRequest_JSON(t *testing.T) {
+	newReq := func(body string) *http.Request {
+		r := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/vnd.api+json")
+		return r
+	}
+
+	t.Run("parsed", func(t *testing.T) {
+		r := newReq(`{"a": 1}`)
+		req := newPSRRequest(r)
+		if err := request(r, req, testUploads(t), nil, &jsonRules{maxDepth: 64, maxSize: mb}, 0, 0, false); err != nil {
+			t.Fatal(err)
+		}
+
+		if body, ok := req.body.([]byte); !ok || string(body) != `{"a": 1}` || !req.Parsed {
+			t.Errorf("body = %v, parsed = %v, want the parsed JSON", req.body, req.Parsed)
+		}
+	})
+
+	for _, body := range []string{`"text"`, `42`, ``, ` `} {
+		t.Run("unparsed "+body, func(t *testing.T) {
+			r := newReq(body)
+			req := newPSRRequest(r)
+			if err := request(r, req, testUploads(t), nil, &jsonRules{maxDepth: 64, maxSize: mb}, 0, 0, false); err != nil {
+				t.Fatal(err)
+			}
+
+			if b, ok := req.body.([]byte); !ok || string(b) != body || req.Parsed {
+				t.Errorf("body = %v, parsed = %v, want the raw body", req.body, req.Parsed)
+			}
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		r := newReq(`{"a": 1`)
+		req := newPSRRequest(r)
+		if err := request(r, req, testUploads(t), nil, nil, 0, 0, false); err != nil {
+			t.Fatal(err)
+		}
+
+		if req.Parsed {
+			t.Error("Parsed is true, JSON parsing is disabled")
+		}
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		r := newReq(`{"a": 1`)
+		if err := request(r, newPSRRequest(r), testUploads(t), nil, &jsonRules{maxDepth: 64, maxSize: mb}, 0, 0, false); err == nil {
+			t.Error("expected an error for the malformed JSON")
+		}
+	})
+}
+
+func TestServeHTTP_MalformedJSON_Returns400(t *testing.T) {
+	cfg := defaultCfg()
+	cfg.ParseJSON = true
+	cfg.JSONMaxDepth = 64
+	cfg.JSONMaxSize = 1
+	h := newTestHandler(t, cfg, nil)
+
+	r := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/", strings.NewReader(`{"a":`))
+	r.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/roadrunner-server/http/v6/config"
+)
+
+// sniffLen is the number of the first bytes used to detect the content type, the same as net/http uses.
+const sniffLen = 512
+
+const (
+	mimePHP        = "application/x-httpd-php"
+	mimeExecutable = "application/x-executable"
+	mimeWindowsExe = "application/x-msdownload"
+	mimeShell      = "text/x-shellscript"
+)
+
+// the magic numbers not known to http.DetectContentType, the scripts may start with whitespace
+var signatures = []struct {
+	prefix []byte
+	script bool
+	mime   string
+}{
+	{[]byte("<?php"), true, mimePHP},
+	{[]byte("<?="), true, mimePHP},
+	{[]byte("#!"), true, mimeShell},
+	{[]byte("\x7fELF"), false, mimeExecutable},
+	{[]byte("MZ"), false, mimeWindowsExe},
+}
+
+// the content which must never hide behind a different extension
+var dangerous = map[string]struct{}{
+	mimePHP:        {},
+	mimeExecutable: {},
+	mimeWindowsExe: {},
+	mimeShell:      {},
+}
+
+// the names the system MIME databases use for the same content
+var aliases = map[string]string{
+	"application/x-php":                             mimePHP,
+	"text/x-php":                                    mimePHP,
+	"application/x-sh":                              mimeShell,
+	"text/x-sh":                                     mimeShell,
+	"application/x-shellscript":                     mimeShell,
+	"application/x-elf":                             mimeExecutable,
+	"application/x-sharedlib":                       mimeExecutable,
+	"application/x-msdos-program":                   mimeWindowsExe,
+	"application/vnd.microsoft.portable-executable": mimeWindowsExe,
+}
+
+// mimeRules checks the content type detected from the first bytes of the uploaded file.
+type mimeRules struct {
+	allow          []string
+	forbid         []string
+	rejectMismatch bool
+}
+
+func newMimeRules(cfg *config.Uploads) *mimeRules {
+	if !cfg.DetectMime {
+		return nil
+	}
+
+	return &mimeRules{
+		allow:          cfg.AllowMime,
+		forbid:         cfg.ForbidMime,
+		rejectMismatch: cfg.RejectMismatch,
+	}
+}
+
+// allowed reports whether the file with the detected content type and the extension could be stored.
+func (m *mimeRules) allowed(detected, ext string) bool {
+	if matchMime(m.forbid, detected) {
+		return false
+	}
+
+	// if allow is empty, all types (except forbidden) are allowed
+	if len(m.allow) > 0 && !matchMime(m.allow, detected) {
+		return false
+	}
+
+	return !m.rejectMismatch || !mismatch(detected, ext)
+}
+
+// detectMime returns the media type of the content, without parameters.
+func detectMime(head []byte) string {
+	script := bytes.ToLower(bytes.TrimLeft(head, "\t\n\r "))
+	for _, s := range signatures {
+		if (s.script && bytes.HasPrefix(script, s.prefix)) || (!s.script && bytes.HasPrefix(head, s.prefix)) {
+			return s.mime
+		}
+	}
+
+	return mediaType(http.DetectContentType(head))
+}
+
+// mismatch reports whether the content disagrees with the extension: a different top level type
+// (a .jpg which is a PHP script) or a script/executable behind a different extension.
+func mismatch(detected, ext string) bool {
+	// the content was not recognized, nothing to compare
+	if detected == "application/octet-stream" || detected == "text/plain" {
+		return false
+	}
+
+	expected := mediaType(mime.TypeByExtension(ext))
+	if alias, ok := aliases[expected]; ok {
+		expected = alias
+	}
+
+	// unknown extension, the extension lists decide
+	if expected == "" || expected == detected {
+		return false
+	}
+
+	if _, ok := dangerous[detected]; ok {
+		return true
+	}
+
+	// e.g. image/svg+xml detected as text/xml
+	if (detected == "text/xml" || detected == "application/xml") && strings.HasSuffix(expected, "xml") {
+		return false
+	}
+
+	return topLevel(detected) != topLevel(expected)
+}
+
+// matchMime matches the media type against the list of the types and the type/* wildcards.
+func matchMime(patterns []string, mediaType string) bool {
+	for _, p := range patterns {
+		if p == mediaType || (strings.HasSuffix(p, "/*") && topLevel(p) == topLevel(mediaType)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func mediaType(contentType string) string {
+	mt, _, _ := strings.Cut(contentType, ";")
+	return strings.ToLower(strings.TrimSpace(mt))
+}
+
+func topLevel(mediaType string) string {
+	tl, _, _ := strings.Cut(mediaType, "/")
+	return tl
+}
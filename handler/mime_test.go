@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/roadrunner-server/http/v6/config"
+)
+
+var pngMagic = "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+
+func TestDetectMime(t *testing.T) {
+	tests := map[string]string{
+		"php":               "<?php echo 1;",
+		"php short echo":    "<?= $x ?>",
+		"php after newline": "\n  <?PHP echo 1;",
+		"shell":             "#!/bin/sh\nrm -rf /",
+		"elf":               "\x7fELF\x02\x01\x01",
+		"windows exe":       "MZ\x90\x00\x03",
+		"png":               pngMagic,
+		"pdf":               "%PDF-1.7",
+		"text":              "hello world",
+	}
+
+	want := map[string]string{
+		"php":               mimePHP,
+		"php short echo":    mimePHP,
+		"php after newline": mimePHP,
+		"shell":             mimeShell,
+		"elf":               mimeExecutable,
+		"windows exe":       mimeWindowsExe,
+		"png":               "image/png",
+		"pdf":               "application/pdf",
+		"text":              "text/plain",
+	}
+
+	for name, content := range tests {
+		if got := detectMime([]byte(content)); got != want[name] {
+			t.Errorf("%s: detectMime = %q, want %q", name, got, want[name])
+		}
+	}
+}
+
+func TestMismatch(t *testing.T) {
+	tests := []struct {
+		detected string
+		ext      string
+		want     bool
+	}{
+		{"image/png", ".png", false},
+		// a mislabeled image is harmless
+		{"image/png", ".jpg", false},
+		{mimePHP, ".jpg", true},
+		{mimePHP, ".txt", true},
+		{mimePHP, ".pdf", true},
+		{"application/pdf", ".jpg", true},
+		{"text/xml", ".svg", false},
+		// the content was not recognized
+		{"text/plain", ".jpg", false},
+		{"application/octet-stream", ".png", false},
+		// unknown extensions are left to the extension lists
+		{mimePHP, ".unknown-ext", false},
+	}
+
+	for _, tt := range tests {
+		if got := mismatch(tt.detected, tt.ext); got != tt.want {
+			t.Errorf("mismatch(%q, %q) = %v, want %v", tt.detected, tt.ext, got, tt.want)
+		}
+	}
+}
+
+func TestMimeRulesAllowed(t *testing.T) {
+	m := &mimeRules{
+		allow:  []string{"image/*", "application/pdf"},
+		forbid: []string{"image/svg+xml"},
+	}
+
+	tests := []struct {
+		detected string
+		want     bool
+	}{
+		{"image/png", true},
+		{"application/pdf", true},
+		{"image/svg+xml", false},
+		{"text/plain", false},
+	}
+
+	for _, tt := range tests {
+		if got := m.allowed(tt.detected, ".bin"); got != tt.want {
+			t.Errorf("allowed(%q) = %v, want %v", tt.detected, got, tt.want)
+		}
+	}
+}
+
+func TestFileUploadStore_MimeSniffed(t *testing.T) {
+	cfg := &config.Uploads{RejectMismatch: true, ForbidMime: []string{"application/x-msdownload"}}
+	if err := cfg.InitDefaults(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		filename string
+		content  string
+		errCode  int
+		detected string
+	}{
+		{"image", "logo.png", pngMagic + strings.Repeat("x", 1024), UploadErrorOK, "image/png"},
+		{"php disguised as jpg", "cat.jpg", "<?php system($_GET['c']);", UploadErrorExtension, mimePHP},
+		{"forbidden content", "setup.bin", "MZ\x90\x00", UploadErrorExtension, mimeWindowsExe},
+		{"empty file", "empty.txt", "", UploadErrorOK, "text/plain"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			up := &uploads{dir: t.TempDir(), mime: newMimeRules(cfg)}
+			f := newPartUpload(newFilePart(t, tt.filename), 0, 0)
+
+			if err := f.store(strings.NewReader(tt.content), up, nil, -1); err != nil {
+				t.Fatal(err)
+			}
+			if f.Error != tt.errCode || f.DetectedMime != tt.detected {
+				t.Fatalf("Error = %d, DetectedMime = %q, want %d, %q", f.Error, f.DetectedMime, tt.errCode, tt.detected)
+			}
+			if f.Mime != "application/octet-stream" {
+				t.Errorf("Mime = %q, want the client content type kept", f.Mime)
+			}
+
+			if tt.errCode != UploadErrorOK {
+				if f.TempFilename != "" {
+					t.Errorf("TempFilename = %q, want no temp file for a rejected file", f.TempFilename)
+				}
+				return
+			}
+
+			// the sniffed bytes are written back
+			data, err := os.ReadFile(f.TempFilename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.content {
+				t.Errorf("temp file has %d bytes, want %d", len(data), len(tt.content))
+			}
+		})
+	}
+}
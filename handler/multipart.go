@@ -0,0 +1,220 @@
+package handler
+
+import (
+	stderr "errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+
+	"github.com/roadrunner-server/errors"
+	"github.com/roadrunner-server/http/v6/config"
+)
+
+const (
+	// maxParts is the maximum number of the multipart parts, the same as the net/http default.
+	maxParts = 1000
+	// the PHP form field limiting the size of the next files
+	maxFileSizeField = "MAX_FILE_SIZE"
+	mb               = 1024 * 1024
+)
+
+// uploadLimitError rejects the request exceeding the upload limits with 413.
+type uploadLimitError struct {
+	limit string
+}
+
+func (e *uploadLimitError) Error() string {
+	return "upload limit exceeded: " + e.limit
+}
+
+// parseMultipart streams the multipart body: the values go to the data tree and every file is written straight
+// into its temp file in the uploads dir. The temp files are removed when the body could not be parsed.
+func parseMultipart(r *http.Request, up *uploads, in *inputLimits, uid, gid int) (dataTree, *Uploads, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	u := &Uploads{
+		tree:     make(fileTree),
+		list:     make([]*FileUpload, 0),
+		claimDir: up.claimDir,
+		inflight: up.inflight,
+	}
+
+	values, files, err := readParts(mr, u, up, in, up.limits(r.URL.Path), uid, gid)
+	if err != nil {
+		u.Clear(nil)
+		return nil, nil, err
+	}
+
+	err = up.scan.scan(r.Context(), u.list)
+	if err != nil {
+		u.Clear(nil)
+		return nil, nil, err
+	}
+
+	data := make(dataTree, values.len())
+	for _, k := range values.keys {
+		err = data.push(k, values.m[k])
+		if err != nil {
+			u.Clear(nil)
+			return nil, nil, err
+		}
+	}
+
+	for _, k := range files.keys {
+		err = u.tree.push(k, files.m[k])
+		if err != nil {
+			u.Clear(nil)
+			return nil, nil, err
+		}
+	}
+
+	return data, u, nil
+}
+
+// orderedValues keeps the form keys in the order of the parts.
+type orderedValues[T any] struct {
+	keys []string
+	m    map[string][]T
+}
+
+func (o *orderedValues[T]) add(k string, v T) {
+	if o.m == nil {
+		o.m = make(map[string][]T)
+	}
+
+	if _, ok := o.m[k]; !ok {
+		o.keys = append(o.keys, k)
+	}
+
+	o.m[k] = append(o.m[k], v)
+}
+
+func (o *orderedValues[T]) len() int {
+	return len(o.keys)
+}
+
+func readParts(mr *multipart.Reader, u *Uploads, up *uploads, in *inputLimits, limits *config.UploadLimits, uid, gid int) (*orderedValues[string], *orderedValues[*FileUpload], error) {
+	const op = errors.Op("parse_multipart")
+	values := &orderedValues[string]{}
+	files := &orderedValues[*FileUpload]{}
+
+	// the values are kept in memory, the files go to disk
+	memory := int64(defaultMaxMemory)
+	// the size of the stored files and the MAX_FILE_SIZE form field
+	var total, formMax int64
+	// the number of the values (max_input_vars)
+	var vars int
+
+	for parts := 0; ; parts++ {
+		part, err := mr.NextPart()
+		if stderr.Is(err, io.EOF) {
+			return values, files, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if parts >= maxParts {
+			_ = part.Close()
+			return nil, nil, errors.E(op, multipart.ErrMessageTooLarge)
+		}
+
+		name := part.FormName()
+		if name == "" {
+			_ = part.Close()
+			continue
+		}
+
+		err = in.key(name)
+		if err != nil {
+			_ = part.Close()
+			return nil, nil, err
+		}
+
+		if part.FileName() == "" {
+			vars++
+			err = in.vars(vars)
+			if err != nil {
+				_ = part.Close()
+				return nil, nil, err
+			}
+
+			value, err := io.ReadAll(io.LimitReader(part, memory+1))
+			_ = part.Close()
+			if err != nil {
+				return nil, nil, err
+			}
+
+			memory -= int64(len(value))
+			if memory < 0 {
+				return nil, nil, errors.E(op, multipart.ErrMessageTooLarge)
+			}
+
+			if name == maxFileSizeField {
+				formMax, _ = strconv.ParseInt(string(value), 10, 64)
+			}
+
+			values.add(name, string(value))
+			continue
+		}
+
+		f := newPartUpload(part, uid, gid)
+		// added before storing, so the temp file is removed on error
+		u.list = append(u.list, f)
+		files.add(name, f)
+
+		if limits.MaxFiles > 0 && len(u.list) > limits.MaxFiles {
+			_ = part.Close()
+			if limits.OnLimit == config.OnLimitReject {
+				return nil, nil, &uploadLimitError{limit: "max_files"}
+			}
+
+			f.Error = UploadErrorIniSize
+			continue
+		}
+
+		limit, code, field := fileLimit(limits, total, formMax)
+		err = f.store(part, up, u, limit)
+		_ = part.Close()
+		switch {
+		case stderr.Is(err, errTooLarge):
+			if limits.OnLimit == config.OnLimitReject {
+				return nil, nil, &uploadLimitError{limit: field}
+			}
+
+			f.Error = code
+		case err != nil:
+			return nil, nil, err
+		}
+
+		total += f.Size
+	}
+}
+
+// fileLimit returns the size limit of the next file (negative - unlimited), its PHP error code and the limit name.
+func fileLimit(limits *config.UploadLimits, total, formMax int64) (int64, int, string) {
+	limit, code, field := int64(-1), UploadErrorOK, ""
+	lower := func(n int64, c int, f string) {
+		if limit < 0 || n < limit {
+			limit, code, field = n, c, f
+		}
+	}
+
+	if limits.MaxFileSize > 0 {
+		lower(limits.MaxFileSize*mb, UploadErrorIniSize, "max_file_size")
+	}
+
+	if limits.MaxTotalSize > 0 {
+		lower(max(limits.MaxTotalSize*mb-total, 0), UploadErrorFormSize, "max_total_size")
+	}
+
+	if formMax > 0 {
+		lower(formMax, UploadErrorFormSize, maxFileSizeField)
+	}
+
+	return limit, code, field
+}
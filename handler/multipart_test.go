@@ -0,0 +1,360 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/roadrunner-server/http/v6/config"
+)
+
+func newMultipartRequest(t *testing.T, build func(w *multipart.Writer)) *http.Request {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	build(w)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/", &buf)
+	r.Header.Set("Content-Type", w.FormDataContentType())
+
+	return r
+}
+
+func writeFile(t *testing.T, w *multipart.Writer, field, filename, content string) {
+	t.Helper()
+
+	fw, err := w.CreateFormFile(field, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = fw.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseMultipart_StreamsFilesToUploadsDir(t *testing.T) {
+	up := &uploads{
+		dir:    t.TempDir(),
+		forbid: map[string]struct{}{".php": {}},
+	}
+
+	r := newMultipartRequest(t, func(w *multipart.Writer) {
+		_ = w.WriteField("user[name]", "john")
+		writeFile(t, w, "docs[]", "a.txt", "first")
+		writeFile(t, w, "docs[]", "b.txt", "second")
+		writeFile(t, w, "script", "x.php", "<?php")
+		_ = w.WriteField("user[age]", "42")
+	})
+
+	data, u, err := parseMultipart(r, up, nil, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { u.Clear(nil) })
+
+	user, ok := data["user"].(dataTree)
+	if !ok || user["name"] != "john" || user["age"] != "42" {
+		t.Errorf("data = %v, want the nested user values", data)
+	}
+
+	if len(u.list) != 3 {
+		t.Fatalf("files = %d, want 3", len(u.list))
+	}
+
+	for i, want := range []string{"first", "second"} {
+		f := u.list[i]
+		if f.Error != UploadErrorOK {
+			t.Fatalf("%s: Error = %d, want %d", f.Name, f.Error, UploadErrorOK)
+		}
+
+		content, err := os.ReadFile(f.TempFilename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != want || f.Size != int64(len(want)) {
+			t.Errorf("%s: content = %q (%d), want %q", f.Name, content, f.Size, want)
+		}
+	}
+
+	if f := u.list[2]; f.Error != UploadErrorExtension || f.TempFilename != "" {
+		t.Errorf("x.php: Error = %d, TempFilename = %q, want rejected without a temp file", f.Error, f.TempFilename)
+	}
+
+	docs, ok := u.tree["docs"].([]*FileUpload)
+	if !ok || len(docs) != 2 {
+		t.Errorf("tree = %v, want the docs list", u.tree)
+	}
+}
+
+func TestParseMultipart_TruncatedBody_RemovesTempFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	writeFile(t, w, "file", "a.txt", strings.Repeat("x", 1024))
+	// no closing boundary, the client went away in the middle of the file
+
+	r := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/", &buf)
+	r.Header.Set("Content-Type", w.FormDataContentType())
+
+	_, _, err := parseMultipart(r, &uploads{dir: dir}, nil, 0, 0)
+	if err == nil {
+		t.Fatal("expected an error for the truncated body")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("uploads dir has %d files, want the partial files removed", len(entries))
+	}
+}
+
+func TestParseMultipart_TooManyParts(t *testing.T) {
+	r := newMultipartRequest(t, func(w *multipart.Writer) {
+		for i := range maxParts + 1 {
+			_ = w.WriteField(fmt.Sprintf("f%d", i), "v")
+		}
+	})
+
+	_, _, err := parseMultipart(r, &uploads{dir: t.TempDir()}, nil, 0, 0)
+	if err == nil || !strings.Contains(err.Error(), multipart.ErrMessageTooLarge.Error()) {
+		t.Errorf("error = %v, want %v", err, multipart.ErrMessageTooLarge)
+	}
+}
+
+func TestParseMultipart_NotMultipart(t *testing.T) {
+	r := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/", strings.NewReader("a=b"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	if _, _, err := parseMultipart(r, &uploads{dir: t.TempDir()}, nil, 0, 0); err == nil {
+		t.Error("expected an error for a non multipart body")
+	}
+}
+
+func limitedUploads(t *testing.T, limits config.UploadLimits, routes map[string]*config.UploadLimits) *uploads {
+	t.Helper()
+
+	cfg := &config.Uploads{Dir: t.TempDir(), UploadLimits: limits, Routes: routes}
+	if err := cfg.InitDefaults(); err != nil {
+		t.Fatal(err)
+	}
+
+	return &uploads{dir: cfg.Dir, cfg: cfg}
+}
+
+func TestParseMultipart_Limits_ErrorCodes(t *testing.T) {
+	big := strings.Repeat("x", mb+1)
+	half := strings.Repeat("x", mb/2+1)
+
+	tests := []struct {
+		name   string
+		limits config.UploadLimits
+		build  func(w *multipart.Writer)
+		want   []int
+	}{
+		{
+			name:   "max_file_size",
+			limits: config.UploadLimits{MaxFileSize: 1},
+			build: func(w *multipart.Writer) {
+				writeFile(t, w, "a", "a.txt", big)
+				writeFile(t, w, "b", "b.txt", "small")
+			},
+			want: []int{UploadErrorIniSize, UploadErrorOK},
+		},
+		{
+			name:   "max_total_size",
+			limits: config.UploadLimits{MaxTotalSize: 1},
+			build: func(w *multipart.Writer) {
+				writeFile(t, w, "a", "a.txt", half)
+				writeFile(t, w, "b", "b.txt", half)
+				writeFile(t, w, "c", "c.txt", "small")
+			},
+			want: []int{UploadErrorOK, UploadErrorFormSize, UploadErrorOK},
+		},
+		{
+			name:   "max_files",
+			limits: config.UploadLimits{MaxFiles: 1},
+			build: func(w *multipart.Writer) {
+				writeFile(t, w, "a", "a.txt", "first")
+				writeFile(t, w, "b", "b.txt", "second")
+			},
+			want: []int{UploadErrorOK, UploadErrorIniSize},
+		},
+		{
+			name: "MAX_FILE_SIZE form field",
+			build: func(w *multipart.Writer) {
+				writeFile(t, w, "a", "a.txt", "before the field")
+				_ = w.WriteField(maxFileSizeField, "4")
+				writeFile(t, w, "b", "b.txt", "after the field")
+				writeFile(t, w, "c", "c.txt", "fit")
+			},
+			want: []int{UploadErrorOK, UploadErrorFormSize, UploadErrorOK},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			up := limitedUploads(t, tt.limits, nil)
+
+			_, u, err := parseMultipart(newMultipartRequest(t, tt.build), up, nil, 0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { u.Clear(nil) })
+
+			if len(u.list) != len(tt.want) {
+				t.Fatalf("files = %d, want %d", len(u.list), len(tt.want))
+			}
+
+			for i, f := range u.list {
+				if f.Error != tt.want[i] {
+					t.Errorf("%s: Error = %d, want %d", f.Name, f.Error, tt.want[i])
+				}
+				if f.Error != UploadErrorOK && (f.TempFilename != "" || f.Size != 0) {
+					t.Errorf("%s: TempFilename = %q, Size = %d, want the file dropped", f.Name, f.TempFilename, f.Size)
+				}
+			}
+
+			entries, err := os.ReadDir(up.dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stored := 0
+			for _, c := range tt.want {
+				if c == UploadErrorOK {
+					stored++
+				}
+			}
+			if len(entries) != stored {
+				t.Errorf("uploads dir has %d files, want %d", len(entries), stored)
+			}
+		})
+	}
+}
+
+func TestParseMultipart_Limits_Reject(t *testing.T) {
+	up := limitedUploads(t, config.UploadLimits{MaxFileSize: 1, OnLimit: config.OnLimitReject}, nil)
+
+	r := newMultipartRequest(t, func(w *multipart.Writer) {
+		writeFile(t, w, "a", "a.txt", "small")
+		writeFile(t, w, "b", "b.txt", strings.Repeat("x", mb+1))
+	})
+
+	_, _, err := parseMultipart(r, up, nil, 0, 0)
+
+	var limitErr *uploadLimitError
+	if !errors.As(err, &limitErr) || limitErr.limit != "max_file_size" {
+		t.Fatalf("error = %v, want the max_file_size limit error", err)
+	}
+
+	entries, err := os.ReadDir(up.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("uploads dir has %d files, want the stored files removed", len(entries))
+	}
+}
+
+func TestUploadsConfig_RouteLimitsInherit(t *testing.T) {
+	cfg := &config.Uploads{
+		Dir:          t.TempDir(),
+		UploadLimits: config.UploadLimits{MaxFileSize: 10, MaxTotalSize: 20},
+		Routes: map[string]*config.UploadLimits{
+			"/admin/import": {MaxFileSize: config.NoUploadLimit},
+		},
+	}
+	if err := cfg.InitDefaults(); err != nil {
+		t.Fatal(err)
+	}
+
+	l := cfg.Limits("/admin/import")
+	if l.MaxFileSize != config.NoUploadLimit || l.MaxTotalSize != 20 {
+		t.Errorf("limits = %+v, want max_file_size lifted and max_total_size inherited", l)
+	}
+
+	cfg = &config.Uploads{Dir: t.TempDir(), UploadLimits: config.UploadLimits{MaxTotalSize: -2}}
+	if err := cfg.InitDefaults(); err == nil {
+		t.Error("expected an error for max_total_size less than -1")
+	}
+}
+
+func TestParseMultipart_Limits_RouteOverride(t *testing.T) {
+	up := limitedUploads(t, config.UploadLimits{MaxFiles: 1}, map[string]*config.UploadLimits{
+		"/gallery":         {MaxFiles: 3},
+		"/gallery/avatars": {MaxFileSize: 1},
+		"/import":          {MaxFiles: config.NoUploadLimit},
+	})
+
+	build := func(w *multipart.Writer) {
+		writeFile(t, w, "a", "a.txt", "first")
+		writeFile(t, w, "b", "b.txt", "second")
+	}
+
+	tests := []struct {
+		path   string
+		errors []int
+	}{
+		{"/", []int{UploadErrorOK, UploadErrorIniSize}},
+		{"/gallery", []int{UploadErrorOK, UploadErrorOK}},
+		{"/gallery/2024", []int{UploadErrorOK, UploadErrorOK}},
+		// the routes are matched on the segment boundary
+		{"/gallery-old", []int{UploadErrorOK, UploadErrorIniSize}},
+		// max_files is inherited from the global limits
+		{"/gallery/avatars/1", []int{UploadErrorOK, UploadErrorIniSize}},
+		// the global limit is lifted
+		{"/import", []int{UploadErrorOK, UploadErrorOK}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			r := newMultipartRequest(t, build)
+			r.URL.Path = tt.path
+
+			_, u, err := parseMultipart(r, up, nil, 0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { u.Clear(nil) })
+
+			for i, f := range u.list {
+				if f.Error != tt.errors[i] {
+					t.Errorf("%s: Error = %d, want %d", f.Name, f.Error, tt.errors[i])
+				}
+			}
+		})
+	}
+}
+
+func TestServeHTTP_UploadLimitRejected_Returns413(t *testing.T) {
+	cfg := defaultCfg()
+	cfg.Uploads = &config.Uploads{Dir: t.TempDir(), UploadLimits: config.UploadLimits{MaxFiles: 1, OnLimit: config.OnLimitReject}}
+	if err := cfg.Uploads.InitDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	h := newTestHandler(t, cfg, nil)
+
+	r := newMultipartRequest(t, func(w *multipart.Writer) {
+		writeFile(t, w, "a", "a.txt", "first")
+		writeFile(t, w, "b", "b.txt", "second")
+	})
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want %d", rr.Code, http.StatusRequestEntityTooLarge)
+	}
+}
@@ -3,22 +3,30 @@ package handler
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
+
+	"github.com/roadrunner-server/http/v6/config"
 )
 
 // MaxLevel defines maximum tree depth for incoming request data and files.
-const MaxLevel = 127
+const MaxLevel = config.MaxInputNestingLimit + 1
 
 type dataTree map[string]any
 type fileTree map[string]any
 
 // parsePostForm parses incoming request body into data tree.
-func parsePostForm(r *http.Request) (dataTree, error) {
+func parsePostForm(r *http.Request, in *inputLimits) (dataTree, error) {
 	data := make(dataTree, 2)
 
 	if r.PostForm != nil {
 		for k, v := range r.PostForm {
-			err := data.push(k, v)
+			err := in.key(k)
+			if err != nil {
+				return nil, err
+			}
+
+			err = data.push(k, v)
 			if err != nil {
 				return nil, err
 			}
@@ -28,16 +36,31 @@ func parsePostForm(r *http.Request) (dataTree, error) {
 	return data, nil
 }
 
-// parseMultipartData parses incoming request body into data tree.
-func parseMultipartData(r *http.Request) (dataTree, error) {
-	data := make(dataTree, 2)
+// parseQuery parses the query string into data tree the same way as the form, nil - empty query.
+func parseQuery(rawQuery string, in *inputLimits) (dataTree, error) {
+	if rawQuery == "" {
+		return nil, nil
+	}
 
-	if r.MultipartForm != nil {
-		for k, v := range r.MultipartForm.Value {
-			err := data.push(k, v)
-			if err != nil {
-				return nil, err
-			}
+	// counted before parsing, the same as the urlencoded body
+	err := in.vars(strings.Count(rawQuery, "&") + 1)
+	if err != nil {
+		return nil, err
+	}
+
+	// the pairs with malformed escapes are skipped, the raw query string keeps them
+	values, _ := url.ParseQuery(rawQuery)
+
+	data := make(dataTree, len(values))
+	for k, v := range values {
+		err = in.key(k)
+		if err != nil {
+			return nil, err
+		}
+
+		err = data.push(k, v)
+		if err != nil {
+			return nil, err
 		}
 	}
 
@@ -160,29 +183,6 @@ func isDataEmpty(v any) bool {
 	}
 }
 
-// parse incoming dataTree request into JSON (including contentMultipart form dataTree)
-func parseUploads(r *http.Request, uid, gid int) (*Uploads, error) {
-	u := &Uploads{
-		tree: make(fileTree),
-		list: make([]*FileUpload, 0),
-	}
-
-	for k, v := range r.MultipartForm.File {
-		files := make([]*FileUpload, 0, len(v))
-		for _, f := range v {
-			files = append(files, NewUpload(f, uid, gid))
-		}
-
-		u.list = append(u.list, files...)
-		err := u.tree.push(k, files)
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	return u, nil
-}
-
 // pushes new file upload into its proper place.
 func (ft fileTree) push(k string, v []*FileUpload) error {
 	keys := fetchIndexes(k)
@@ -523,3 +523,58 @@ func TestFileTreePush(t *testing.T) {
 		})
 	}
 }
+
+func TestParseQuery(t *testing.T) {
+	data, err := parseQuery("a[b][]=1&a[b][]=2&c=3&d[x]=y", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := dataTree{
+		"a": dataTree{"b": []string{"1", "2"}},
+		"c": "3",
+		"d": dataTree{"x": "y"},
+	}
+	if diff := cmp.Diff(want, data); diff != "" {
+		t.Errorf("tree mismatch (-want +got):\n%s", diff)
+	}
+
+	if data, err = parseQuery("", nil); err != nil || data != nil {
+		t.Errorf("empty query = %v, %v, want nil", data, err)
+	}
+
+	// the malformed pairs are skipped
+	data, err = parseQuery("a=%zz&c=3&d%zz=1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(dataTree{"c": "3"}, data); diff != "" {
+		t.Errorf("tree mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseQuery_Limits(t *testing.T) {
+	in := &inputLimits{maxVars: 2, maxNesting: 1, maxKeyLength: 8}
+
+	tests := []struct {
+		query string
+		limit bool
+	}{
+		{"a=1&b=2&c=3", true},
+		{"a[b][c]=1", false},
+		{"verylongkey=1", false},
+	}
+
+	for _, tt := range tests {
+		_, err := parseQuery(tt.query, in)
+		if err == nil {
+			t.Errorf("%s: expected an error", tt.query)
+			continue
+		}
+
+		var limitErr *inputLimitError
+		if errors.As(err, &limitErr) != tt.limit {
+			t.Errorf("%s: error = %v, want the 413 limit error = %v", tt.query, err, tt.limit)
+		}
+	}
+}
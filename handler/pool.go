@@ -19,10 +19,22 @@ func (h *Handler) getProtoReq(r *Request) *httpV1proto.Request {
 	req.Method = r.Method
 	req.Uri = r.URI
 	req.Header = convert(r.Header)
-	req.Cookies = convertCookies(r.Cookies)
+	req.Cookies = convert(r.Cookies)
 	req.RawQuery = r.RawQuery
 	req.Parsed = r.Parsed
 	req.Attributes = convert(r.Attributes)
+	if r.query != nil {
+		if req.Attributes == nil {
+			req.Attributes = make(map[string]*httpV1proto.HeaderValue, 1)
+		}
+		req.Attributes[QueryAttribute] = &httpV1proto.HeaderValue{Value: [][]byte{r.query}}
+	}
+	if r.rawCookies != nil {
+		if req.Attributes == nil {
+			req.Attributes = make(map[string]*httpV1proto.HeaderValue, 1)
+		}
+		req.Attributes[RawCookiesAttribute] = &httpV1proto.HeaderValue{Value: [][]byte{r.rawCookies}}
+	}
 
 	return req
 }
@@ -55,8 +67,9 @@ func (h *Handler) getReq(r *http.Request) *Request {
 	req.Method = r.Method
 	req.URI = URI(r)
 	req.Header = r.Header
-	req.Cookies = make(map[string]string)
+	req.Cookies = make(map[string][]string)
 	req.Attributes = attributes.All(r)
+	h.cookies.parse(r, req)
 
 	req.Parsed = false
 	req.body = nil
@@ -75,6 +88,8 @@ func (h *Handler) putReq(req *Request) {
 	req.Uploads = nil
 	req.Attributes = nil
 	req.body = nil
+	req.query = nil
+	req.rawCookies = nil
 
 	h.reqPool.Put(req)
 }
@@ -7,7 +7,6 @@ import (
 	"log/slog"
 	"net"
 	"net/http"
-	"net/url"
 	"strings"
 
 	httpV1proto "github.com/roadrunner-server/api-go/v6/http/v1"
@@ -17,13 +16,18 @@ import (
 )
 
 const (
+	// max size of the multipart values kept in memory, the files are streamed to disk
 	defaultMaxMemory = 32 << 20 // 32 MB
 	contentNone      = iota + 900
 	contentStream
 	contentMultipart
 	contentURLEncoded
+	contentJSON
 )
 
+// QueryAttribute is the attribute the query string tree is sent in as JSON (parse_query).
+const QueryAttribute = "rr:query"
+
 // Request maps net/http requests to PSR7 compatible structure and managed state of temporary uploaded files.
 type Request struct {
 	// RemoteAddr contains ip address of a client, make sure to check X-Real-Ip and X-Forwarded-For for real client address.
@@ -36,8 +40,8 @@ type Request struct {
 	URI string `json:"uri"`
 	// Header contains list of request headers.
 	Header http.Header `json:"headers"`
-	// Cookies contains list of request cookies.
-	Cookies map[string]string `json:"cookies"`
+	// Cookies contains the values of the request cookies by the name, in the order they were sent.
+	Cookies map[string][]string `json:"cookies"`
 	// RawQuery contains non-parsed query string (to be parsed on php end).
 	RawQuery string `json:"rawQuery"`
 	// Parsed indicates that request body has been parsed on RR end.
@@ -48,6 +52,10 @@ type Request struct {
 	Attributes map[string][]string `json:"attributes"`
 	// request body can be parsedData or []byte
 	body any
+	// JSON encoded query string tree, nil - not parsed or empty
+	query []byte
+	// JSON encoded undecoded cookie values, nil - not requested or no cookies
+	rawCookies []byte
 }
 
 func FetchIP(pair string, log *slog.Logger) string {
@@ -69,13 +77,7 @@ func FetchIP(pair string, log *slog.Logger) string {
 	return ip.String()
 }
 
-func request(r *http.Request, req *Request, uid, gid int, sendRawBody bool) error {
-	for _, c := range r.Cookies() {
-		if v, err := url.QueryUnescape(c.Value); err == nil {
-			req.Cookies[c.Name] = v
-		}
-	}
-
+func request(r *http.Request, req *Request, up *uploads, in *inputLimits, js *jsonRules, uid, gid int, sendRawBody bool) error {
 	switch req.contentType() {
 	case contentNone:
 		return nil
@@ -89,8 +91,9 @@ func request(r *http.Request, req *Request, uid, gid int, sendRawBody bool) erro
 
 		return nil
 
-	case contentMultipart:
-		if sendRawBody {
+	case contentJSON:
+		// not parsed unless parse_json is enabled
+		if sendRawBody || js == nil {
 			var err error
 			req.body, err = io.ReadAll(r.Body)
 			if err != nil {
@@ -100,21 +103,35 @@ func request(r *http.Request, req *Request, uid, gid int, sendRawBody bool) erro
 			return nil
 		}
 
-		err := r.ParseMultipartForm(defaultMaxMemory)
+		body, parsed, err := js.parse(r.Body)
 		if err != nil {
 			return err
 		}
 
-		req.Uploads, err = parseUploads(r, uid, gid)
-		if err != nil {
-			return err
+		req.body = body
+		// the scalars and the empty body are sent unparsed
+		req.Parsed = parsed
+
+		return nil
+	case contentMultipart:
+		if sendRawBody {
+			var err error
+			req.body, err = io.ReadAll(r.Body)
+			if err != nil {
+				return err
+			}
+
+			return nil
 		}
 
-		req.body, err = parseMultipartData(r)
+		data, files, err := parseMultipart(r, up, in, uid, gid)
 		if err != nil {
 			return err
 		}
 
+		req.body = data
+		req.Uploads = files
+
 		req.Parsed = true
 	case contentURLEncoded:
 		if sendRawBody {
@@ -127,12 +144,13 @@ func request(r *http.Request, req *Request, uid, gid int, sendRawBody bool) erro
 			return nil
 		}
 
+		r.Body = in.body(r.Body)
 		err := r.ParseForm()
 		if err != nil {
 			return err
 		}
 
-		req.body, err = parsePostForm(r)
+		req.body, err = parsePostForm(r, in)
 		if err != nil {
 			return err
 		}
@@ -143,29 +161,36 @@ func request(r *http.Request, req *Request, uid, gid int, sendRawBody bool) erro
 	return nil
 }
 
-// Open moves all uploaded files to temporary directory so it can be given to php later.
-func (r *Request) Open(log *slog.Logger, dir string, forbid, allow map[string]struct{}) {
+// Report logs the file system errors of the uploaded files.
+func (r *Request) Report(log *slog.Logger) {
 	if r.Uploads == nil {
 		return
 	}
 
-	r.Uploads.Open(log, dir, forbid, allow)
+	r.Uploads.Report(log)
+}
+
+// parseQuery parses the query string into the data tree under the form limits.
+func (r *Request) parseQuery(in *inputLimits) error {
+	data, err := parseQuery(r.RawQuery, in)
+	if err != nil || len(data) == 0 {
+		return err
+	}
+
+	r.query, err = json.Marshal(data)
+	return err
 }
 
 // Close clears all temp file uploads
-func (r *Request) Close(log *slog.Logger, hr *http.Request) {
+func (r *Request) Close(log *slog.Logger) {
 	if r.Uploads == nil {
 		return
 	}
 
 	r.Uploads.Clear(log)
-	if hr.MultipartForm != nil {
-		_ = hr.MultipartForm.RemoveAll()
-	}
 }
 
-// Payload request marshaled RoadRunner payload based on PSR7 data. values encode method is JSON. Make sure to open
-// files prior to calling this method.
+// Payload request marshaled RoadRunner payload based on PSR7 data. values encode method is JSON.
 func (r *Request) Payload(p *payload.Payload, sendRawBody bool, req *httpV1proto.Request) error {
 	const op = errors.Op("marshal_payload")
 
@@ -257,6 +282,10 @@ func (r *Request) contentType() int {
 		return contentMultipart
 	}
 
+	if isJSON(ct) {
+		return contentJSON
+	}
+
 	return contentStream
 }
 
@@ -18,10 +18,16 @@ func newPSRRequest(r *http.Request) *Request {
 	return &Request{
 		Method:  r.Method,
 		Header:  r.Header,
-		Cookies: make(map[string]string),
+		Cookies: make(map[string][]string),
 	}
 }
 
+// testUploads stores the uploaded files in the test temp dir.
+func testUploads(t *testing.T) *uploads {
+	t.Helper()
+	return &uploads{dir: t.TempDir()}
+}
+
 // multipartBody returns an encoded multipart body together with its content type.
 func multipartBody(t *testing.T, field, filename, content string) (string, string) {
 	t.Helper()
@@ -57,7 +63,9 @@ func TestContentType_MethodAndHeaderTable(t *testing.T) {
 		{"OPTIONS ignores the content type", http.MethodOptions, "multipart/form-data; boundary=x", contentNone},
 		{"urlencoded with charset parameter", http.MethodPost, "application/x-www-form-urlencoded; charset=utf-8", contentURLEncoded},
 		{"multipart with boundary", http.MethodPost, "multipart/form-data; boundary=x", contentMultipart},
-		{"json falls back to stream", http.MethodPost, "application/json", contentStream},
+		{"json", http.MethodPost, "application/json; charset=utf-8", contentJSON},
+		{"json structured syntax suffix", http.MethodPost, "application/problem+json", contentJSON},
+		{"text falls back to stream", http.MethodPost, "text/plain", contentStream},
 		{"missing content type falls back to stream", http.MethodPost, "", contentStream},
 	}
 
@@ -81,7 +89,7 @@ func TestRequest_RawBody_URLEncodedStaysUnparsed(t *testing.T) {
 	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
 	req := newPSRRequest(r)
-	if err := request(r, req, 0, 0, true); err != nil {
+	if err := request(r, req, testUploads(t), nil, nil, 0, 0, true); err != nil {
 		t.Fatal(err)
 	}
 
@@ -104,7 +112,7 @@ func TestRequest_RawBody_MultipartKeepsEnvelopeAndSkipsUploads(t *testing.T) {
 	r.Header.Set("Content-Type", ct)
 
 	req := newPSRRequest(r)
-	if err := request(r, req, 0, 0, true); err != nil {
+	if err := request(r, req, testUploads(t), nil, nil, 0, 0, true); err != nil {
 		t.Fatal(err)
 	}
 
@@ -128,7 +136,7 @@ func TestRequest_HeadWithBody_ReadsNothing(t *testing.T) {
 	r.Header.Set("Content-Type", "application/json")
 
 	req := newPSRRequest(r)
-	if err := request(r, req, 0, 0, false); err != nil {
+	if err := request(r, req, testUploads(t), nil, nil, 0, 0, false); err != nil {
 		t.Fatal(err)
 	}
 
@@ -140,32 +148,12 @@ func TestRequest_HeadWithBody_ReadsNothing(t *testing.T) {
 	}
 }
 
-func TestRequest_CookiesUnescapedAndBadEscapeDropped(t *testing.T) {
-	r := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/", nil)
-	r.Header.Add("Cookie", "a=b%20c; d=e; bad=%zz")
-
-	req := newPSRRequest(r)
-	if err := request(r, req, 0, 0, false); err != nil {
-		t.Fatal(err)
-	}
-
-	want := map[string]string{"a": "b c", "d": "e"}
-	if len(req.Cookies) != len(want) {
-		t.Fatalf("Cookies = %v, want %v", req.Cookies, want)
-	}
-	for k, v := range want {
-		if req.Cookies[k] != v {
-			t.Errorf("Cookies[%q] = %q, want %q", k, req.Cookies[k], v)
-		}
-	}
-}
-
 func TestRequest_URLEncodedInvalidEscape_ReturnsParseFormError(t *testing.T) {
 	r := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/", strings.NewReader("%zz=1"))
 	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
 	req := newPSRRequest(r)
-	err := request(r, req, 0, 0, false)
+	err := request(r, req, testUploads(t), nil, nil, 0, 0, false)
 	if err == nil {
 		t.Fatal("expected an error from ParseForm")
 	}
@@ -180,7 +168,7 @@ func TestRequest_URLEncodedConflictingKeys_ReturnsTreeError(t *testing.T) {
 	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
 	req := newPSRRequest(r)
-	err := request(r, req, 0, 0, false)
+	err := request(r, req, testUploads(t), nil, nil, 0, 0, false)
 	if err == nil {
 		t.Fatal("expected an error from parsePostForm")
 	}
@@ -196,7 +184,7 @@ func TestRequest_MultipartParsed_FillsUploadsAndTree(t *testing.T) {
 	r.Header.Set("Content-Type", ct)
 
 	req := newPSRRequest(r)
-	if err := request(r, req, 0, 0, false); err != nil {
+	if err := request(r, req, testUploads(t), nil, nil, 0, 0, false); err != nil {
 		t.Fatal(err)
 	}
 
@@ -16,6 +16,8 @@ import (
 const (
 	Trailer   string = "Trailer"
 	HTTP2Push string = "Http2-Push"
+	// UploadClaim lists the uploaded files kept after the request, the header is not sent to the client.
+	UploadClaim string = "X-Upload-Claim"
 )
 
 // Response handles PSR7 response logic.
@@ -28,9 +30,13 @@ type Response struct {
 
 // Write writes response headers, status and body into ResponseWriter.
 func (h *Handler) Write(pld *payload.Payload, w http.ResponseWriter) error {
+	return h.write(pld, w, nil, nil)
+}
+
+func (h *Handler) write(pld *payload.Payload, w http.ResponseWriter, hints *hintsState, up *Uploads) error {
 	switch pld.Codec {
 	case frame.CodecProto:
-		return h.handlePROTOresponse(pld, w)
+		return h.handlePROTOresponse(pld, w, hints, up)
 	case frame.CodecJSON:
 		return errors.Str("JSON codec is not supported")
 	default:
@@ -38,7 +44,7 @@ func (h *Handler) Write(pld *payload.Payload, w http.ResponseWriter) error {
 	}
 }
 
-func (h *Handler) handlePROTOresponse(pld *payload.Payload, w http.ResponseWriter) error {
+func (h *Handler) handlePROTOresponse(pld *payload.Payload, w http.ResponseWriter, hints *hintsState, up *Uploads) error {
 	rsp := h.getProtoRsp()
 	defer h.putProtoRsp(rsp)
 
@@ -56,20 +62,6 @@ func (h *Handler) handlePROTOresponse(pld *payload.Payload, w http.ResponseWrite
 		}
 		status := int(rsp.Status)
 
-		// handle push headers
-		if rsp.GetHeaders() != nil && rsp.GetHeaders()[HTTP2Push] != nil {
-			push := rsp.GetHeaders()[HTTP2Push].GetValue()
-
-			if pusher, ok := w.(http.Pusher); ok {
-				for _, pushVal := range push {
-					err = pusher.Push(string(pushVal), nil)
-					if err != nil {
-						return err
-					}
-				}
-			}
-		}
-
 		if rsp.GetHeaders() != nil && rsp.GetHeaders()[Trailer] != nil {
 			handleProtoTrailers(rsp.GetHeaders())
 		}
@@ -82,10 +74,24 @@ func (h *Handler) handlePROTOresponse(pld *payload.Payload, w http.ResponseWrite
 			if len(pld.Body) != 0 {
 				h.log.Warn("informational response body was dropped", "status", status)
 			}
+			if status == http.StatusEarlyHints {
+				hints.record(rsp.GetHeaders())
+			}
 			writeInformational(status, rsp.GetHeaders(), w)
 			return nil
 		}
 
+		// the worker keeps the uploaded files instead of copying them before the response
+		for k, hv := range rsp.GetHeaders() {
+			if strings.EqualFold(k, UploadClaim) {
+				up.claim(hv.GetValue())
+				delete(rsp.GetHeaders(), k)
+			}
+		}
+
+		// preload links and Http2-Push targets go out as 103 Early Hints before the final response
+		h.hints.final(w, rsp.GetHeaders(), hints)
+
 		// write all headers from the response to the writer
 		for k, hv := range rsp.GetHeaders() {
 			for _, v := range hv.GetValue() {
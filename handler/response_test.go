@@ -4,28 +4,17 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"strings"
 	"testing"
 
 	httpV1proto "github.com/roadrunner-server/api-go/v6/http/v1"
 	"github.com/roadrunner-server/goridge/v4/pkg/frame"
+	"github.com/roadrunner-server/http/v6/config"
 	"github.com/roadrunner-server/pool/v2/payload"
 	"google.golang.org/protobuf/proto"
 )
 
-// pushRecorder adds http.Pusher to httptest.ResponseRecorder so the HTTP/2 push
-// block in handlePROTOresponse can be driven without a real h2 connection.
-type pushRecorder struct {
-	*httptest.ResponseRecorder
-	pushed  []string
-	pushErr error
-}
-
-func (p *pushRecorder) Push(target string, _ *http.PushOptions) error {
-	p.pushed = append(p.pushed, target)
-	return p.pushErr
-}
-
 func headerValue(values ...string) *httpV1proto.HeaderValue {
 	hv := &httpV1proto.HeaderValue{}
 	for _, v := range values {
@@ -154,69 +143,109 @@ func TestWrite_StatusOutOfRange_Returns500(t *testing.T) {
 	}
 }
 
-func TestWrite_Push_TargetsForwardedToPusher(t *testing.T) {
-	h := newTestHandler(t, defaultCfg(), nil)
+func hintsCfg() *config.Config {
+	cfg := defaultCfg()
+	cfg.EarlyHints = &config.EarlyHints{}
+	return cfg
+}
+
+func TestWrite_EarlyHints_FromPushAndPreloadLinks(t *testing.T) {
+	h := newTestHandler(t, hintsCfg(), nil)
 
 	pld := &payload.Payload{
 		Codec: frame.CodecProto,
 		Context: marshalRsp(t, http.StatusOK, map[string]*httpV1proto.HeaderValue{
-			HTTP2Push: headerValue("/a.css", "/b.js"),
+			HTTP2Push: headerValue("/a.css", "/font.woff2"),
+			"Link":    headerValue("</b.js>; rel=preload; as=script, </next>; rel=next"),
 		}),
 	}
 
-	rr := &pushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	rr := &hintRecorder{}
 	if err := h.Write(pld, rr); err != nil {
 		t.Fatal(err)
 	}
 
-	want := []string{"/a.css", "/b.js"}
-	if len(rr.pushed) != len(want) {
-		t.Fatalf("pushed = %v, want %v", rr.pushed, want)
+	if len(rr.hints) != 1 || rr.hints[0].code != http.StatusEarlyHints {
+		t.Fatalf("hints = %+v, want a single 103", rr.hints)
+	}
+
+	want := []string{
+		"</b.js>; rel=preload; as=script",
+		"</a.css>; rel=preload; as=style",
+		"</font.woff2>; rel=preload; as=font; crossorigin",
+	}
+	if got := rr.hints[0].header.Values("Link"); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("hint Link = %v, want %v", got, want)
+	}
+	if rr.code != http.StatusOK {
+		t.Errorf("status = %d, want %d", rr.code, http.StatusOK)
 	}
-	for i := range want {
-		if rr.pushed[i] != want[i] {
-			t.Errorf("pushed[%d] = %q, want %q", i, rr.pushed[i], want[i])
-		}
+	if got := rr.Header().Get(HTTP2Push); got != "" {
+		t.Errorf("%s = %q, want it removed from the final response", HTTP2Push, got)
+	}
+	if got := rr.Header().Get("Link"); got == "" {
+		t.Error("Link must stay in the final response")
 	}
 }
 
-func TestWrite_PushError_Propagated(t *testing.T) {
-	h := newTestHandler(t, defaultCfg(), nil)
+func TestWrite_EarlyHints_LinksSentByWorkerNotRepeated(t *testing.T) {
+	h := newTestHandler(t, hintsCfg(), nil)
+	rr := &hintRecorder{}
+	st := h.hints.start(rr, httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/", nil))
 
-	pld := &payload.Payload{
+	hint := &payload.Payload{
 		Codec: frame.CodecProto,
-		Context: marshalRsp(t, http.StatusOK, map[string]*httpV1proto.HeaderValue{
-			HTTP2Push: headerValue("/a.css"),
+		Context: marshalRsp(t, http.StatusEarlyHints, map[string]*httpV1proto.HeaderValue{
+			"Link": headerValue("</a.css>; rel=preload"),
 		}),
 	}
+	if err := h.write(hint, rr, st, nil); err != nil {
+		t.Fatal(err)
+	}
 
-	rr := &pushRecorder{ResponseRecorder: httptest.NewRecorder(), pushErr: fmt.Errorf("push refused")}
-
-	err := h.Write(pld, rr)
-	if err == nil {
-		t.Fatal("expected the pusher error to be returned")
+	final := &payload.Payload{
+		Codec: frame.CodecProto,
+		Context: marshalRsp(t, http.StatusOK, map[string]*httpV1proto.HeaderValue{
+			"Link": headerValue("</a.css>; rel=preload"),
+		}),
+	}
+	if err := h.write(final, rr, st, nil); err != nil {
+		t.Fatal(err)
 	}
-	if !strings.Contains(err.Error(), "push refused") {
-		t.Errorf("error = %v, want the pusher error", err)
+
+	if len(rr.hints) != 1 {
+		t.Errorf("hints = %+v, want only the worker 103", rr.hints)
 	}
 }
 
-func TestWrite_PlainWriter_IgnoresPushHeader(t *testing.T) {
+func TestWrite_EarlyHintsDisabled_PushHeaderConvertedToLink(t *testing.T) {
 	h := newTestHandler(t, defaultCfg(), nil)
 
 	pld := &payload.Payload{
 		Codec: frame.CodecProto,
 		Context: marshalRsp(t, http.StatusOK, map[string]*httpV1proto.HeaderValue{
-			HTTP2Push: headerValue("/a.css"),
+			HTTP2Push:  headerValue("/a.css"),
+			linkHeader: headerValue("<https://cdn.example.com>; rel=preconnect"),
 		}),
 	}
 
-	rr := httptest.NewRecorder()
+	rr := &hintRecorder{}
 	if err := h.Write(pld, rr); err != nil {
 		t.Fatal(err)
 	}
-	if rr.Code != http.StatusOK {
-		t.Errorf("status = %d, want %d", rr.Code, http.StatusOK)
+	if rr.code != http.StatusOK {
+		t.Errorf("status = %d, want %d", rr.code, http.StatusOK)
+	}
+	if len(rr.hints) != 0 {
+		t.Errorf("hints = %+v, want none without the early_hints section", rr.hints)
+	}
+	if got := rr.Header().Get(HTTP2Push); got != "" {
+		t.Errorf("%s = %q, want it removed from the final response", HTTP2Push, got)
+	}
+
+	want := []string{"<https://cdn.example.com>; rel=preconnect", "</a.css>; rel=preload; as=style"}
+	if got := rr.Header().Values(linkHeader); !slices.Equal(got, want) {
+		t.Errorf("Link = %q, want %q", got, want)
 	}
 }
 
@@ -472,3 +501,30 @@ func TestWrite_Trailers_RenamedOnTheWire(t *testing.T) {
 		t.Errorf("X-Checksum = %q, want it to be renamed away", got)
 	}
 }
+
+func TestWrite_UploadClaim_MarksFilesAndIsNotSent(t *testing.T) {
+	h := newTestHandler(t, defaultCfg(), nil)
+
+	a := &FileUpload{Name: "a.txt", TempFilename: "/tmp/upload1"}
+	b := &FileUpload{Name: "b.txt", TempFilename: "/tmp/upload2"}
+	up := &Uploads{list: []*FileUpload{a, b}}
+
+	pld := &payload.Payload{
+		Codec: frame.CodecProto,
+		Context: marshalRsp(t, http.StatusOK, map[string]*httpV1proto.HeaderValue{
+			"x-upload-claim": headerValue("upload2"),
+		}),
+	}
+
+	rr := httptest.NewRecorder()
+	if err := h.write(pld, rr, nil, up); err != nil {
+		t.Fatal(err)
+	}
+
+	if a.claimed || !b.claimed {
+		t.Errorf("claimed = %v, %v, want only b.txt", a.claimed, b.claimed)
+	}
+	if got := rr.Header().Get(UploadClaim); got != "" {
+		t.Errorf("%s = %q, want the header not sent to the client", UploadClaim, got)
+	}
+}
@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/roadrunner-server/errors"
+	"github.com/roadrunner-server/http/v6/config"
+	"github.com/roadrunner-server/http/v6/scanner"
+)
+
+// the number of the files of a request scanned at the same time
+const scanConcurrency = 4
+
+// scanError rejects the request with 503 when the files could not be scanned and the policy is fail closed.
+type scanError struct {
+	err error
+}
+
+func (e *scanError) Error() string {
+	return "upload scan failed: " + e.err.Error()
+}
+
+func (e *scanError) Unwrap() error {
+	return e.err
+}
+
+// scanPolicy streams the stored files to the malware scanner before the worker sees them.
+type scanPolicy struct {
+	scanner  scanner.Scanner
+	timeout  time.Duration
+	failOpen bool
+	log      *slog.Logger
+}
+
+func newScanPolicy(cfg *config.UploadScan, log *slog.Logger) (*scanPolicy, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+
+	s, err := scanner.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &scanPolicy{
+		scanner:  s,
+		timeout:  cfg.Timeout,
+		failOpen: cfg.FailOpen,
+		log:      log,
+	}, nil
+}
+
+// scan checks the stored files, the infected files are removed and marked with UploadErrorInfected. The
+// files which could not be scanned are passed to the worker (fail open) or a *scanError is returned.
+func (s *scanPolicy) scan(ctx context.Context, files []*FileUpload) error {
+	const op = errors.Op("upload_scan")
+	if s == nil {
+		return nil
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	sem := make(chan struct{}, scanConcurrency)
+
+	for _, f := range files {
+		if f.Error != UploadErrorOK || f.TempFilename == "" {
+			continue
+		}
+
+		sem <- struct{}{}
+		wg.Go(func() {
+			defer func() { <-sem }()
+
+			err := s.file(ctx, f)
+			if err == nil {
+				return
+			}
+
+			if s.failOpen {
+				s.log.Warn("the uploaded file was not scanned", "name", f.Name, "error", err)
+				return
+			}
+
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+		})
+	}
+
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return &scanError{err: errors.E(op, errs[0])}
+	}
+
+	return nil
+}
+
+func (s *scanPolicy) file(ctx context.Context, f *FileUpload) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	tmp, err := os.Open(f.TempFilename)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.scanner.Scan(ctx, tmp)
+	_ = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	if !res.Infected {
+		return nil
+	}
+
+	s.log.Warn("the uploaded file is infected", "name", f.Name, "threat", res.Threat)
+
+	err = os.Remove(f.TempFilename)
+	if err != nil {
+		// the worker never sees the file, the leftover is reported
+		f.err = err
+	}
+
+	f.TempFilename = ""
+	f.Size = 0
+	f.Error = UploadErrorInfected
+	f.Threat = res.Threat
+
+	return nil
+}
@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/roadrunner-server/http/v6/config"
+	"github.com/roadrunner-server/http/v6/scanner"
+)
+
+// fakeScanner stands in for clamd/ICAP: the content containing "virus" is infected, "broken" fails the scan.
+type fakeScanner struct{}
+
+func (fakeScanner) Scan(_ context.Context, r io.Reader) (*scanner.Result, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case strings.Contains(string(data), "broken"):
+		return nil, errors.New("scanner is unavailable")
+	case strings.Contains(string(data), "virus"):
+		return &scanner.Result{Infected: true, Threat: "Test-Virus"}, nil
+	default:
+		return &scanner.Result{}, nil
+	}
+}
+
+func scannedUploads(t *testing.T, failOpen bool) *uploads {
+	t.Helper()
+
+	return &uploads{
+		dir: t.TempDir(),
+		scan: &scanPolicy{
+			scanner:  fakeScanner{},
+			timeout:  time.Second,
+			failOpen: failOpen,
+			log:      slog.New(slog.DiscardHandler),
+		},
+	}
+}
+
+func TestParseMultipart_Scan_InfectedRemoved(t *testing.T) {
+	up := scannedUploads(t, false)
+
+	r := newMultipartRequest(t, func(w *multipart.Writer) {
+		writeFile(t, w, "a", "clean.txt", "hello")
+		writeFile(t, w, "b", "eicar.txt", "a virus inside")
+	})
+
+	_, u, err := parseMultipart(r, up, nil, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { u.Clear(nil) })
+
+	if f := u.list[0]; f.Error != UploadErrorOK || f.TempFilename == "" || f.Threat != "" {
+		t.Errorf("clean.txt: Error = %d, Threat = %q, want stored", f.Error, f.Threat)
+	}
+
+	f := u.list[1]
+	if f.Error != UploadErrorInfected || f.Threat != "Test-Virus" {
+		t.Errorf("eicar.txt: Error = %d, Threat = %q, want %d, Test-Virus", f.Error, f.Threat, UploadErrorInfected)
+	}
+	if f.TempFilename != "" || f.Size != 0 {
+		t.Errorf("eicar.txt: TempFilename = %q, Size = %d, want the file dropped", f.TempFilename, f.Size)
+	}
+
+	entries, err := os.ReadDir(up.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("uploads dir has %d files, want only the clean file", len(entries))
+	}
+}
+
+func TestParseMultipart_Scan_FailPolicy(t *testing.T) {
+	build := func(w *multipart.Writer) {
+		writeFile(t, w, "a", "clean.txt", "hello")
+		writeFile(t, w, "b", "b.txt", "broken")
+	}
+
+	t.Run("fail closed", func(t *testing.T) {
+		up := scannedUploads(t, false)
+
+		_, _, err := parseMultipart(newMultipartRequest(t, build), up, nil, 0, 0)
+
+		var scanErr *scanError
+		if !errors.As(err, &scanErr) {
+			t.Fatalf("error = %v, want the scan error", err)
+		}
+
+		entries, err := os.ReadDir(up.dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 0 {
+			t.Errorf("uploads dir has %d files, want the stored files removed", len(entries))
+		}
+	})
+
+	t.Run("fail open", func(t *testing.T) {
+		_, u, err := parseMultipart(newMultipartRequest(t, build), scannedUploads(t, true), nil, 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { u.Clear(nil) })
+
+		for _, f := range u.list {
+			if f.Error != UploadErrorOK || f.TempFilename == "" {
+				t.Errorf("%s: Error = %d, want the unscanned file passed", f.Name, f.Error)
+			}
+		}
+	})
+}
+
+func TestServeHTTP_ScannerUnavailable_Returns503(t *testing.T) {
+	// nothing listens on the address
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+
+	cfg := defaultCfg()
+	cfg.Uploads = &config.Uploads{
+		Dir:  t.TempDir(),
+		Scan: &config.UploadScan{Driver: config.ScanDriverClamd, Address: "tcp://" + addr},
+	}
+	if err = cfg.Uploads.InitDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	h := newTestHandler(t, cfg, nil)
+
+	r := newMultipartRequest(t, func(w *multipart.Writer) {
+		writeFile(t, w, "a", "a.txt", "hello")
+	})
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", rr.Code, http.StatusServiceUnavailable)
+	}
+}
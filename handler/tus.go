@@ -0,0 +1,549 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	stderr "errors"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/roadrunner-server/http/v6/config"
+)
+
+var errTusFull = stderr.New("too many incomplete uploads")
+
+const (
+	tusVersion     = "1.0.0"
+	tusExtensions  = "creation,termination,expiration"
+	tusContentType = "application/offset+octet-stream"
+	// the upload files in the uploads dir: tus-<id> with the content and tus-<id>.info with the upload state
+	tusPrefix     = "tus-"
+	tusInfoSuffix = ".info"
+	// the field of the completed file in the uploads tree
+	tusField = "file"
+	// the expired uploads are removed at most once per interval
+	tusCleanupInterval = time.Minute
+)
+
+// tusInfo is the state of the upload stored next to its content, the offset is the size of the content.
+type tusInfo struct {
+	Length int64 `json:"length"`
+	// Metadata is the decoded Upload-Metadata, filename and filetype describe the file.
+	Metadata map[string]string `json:"metadata"`
+	// RawMetadata is the Upload-Metadata header returned by HEAD.
+	RawMetadata string    `json:"raw_metadata"`
+	Expires     time.Time `json:"expires"`
+}
+
+// tus implements the tus 1.0 resumable uploads (creation, termination and expiration extensions). The chunks
+// are appended to the file in the uploads dir, the completed file is sent to the worker as a regular upload.
+type tus struct {
+	path       string
+	dir        string
+	maxSize    int64
+	maxUploads int
+	expiration time.Duration
+	uid        int
+	gid        int
+
+	mu sync.Mutex
+	// the uploads being patched
+	busy map[string]struct{}
+	// the last removal of the expired uploads
+	cleaned time.Time
+}
+
+func newTus(cfg *config.Uploads, uid, gid int) *tus {
+	if cfg.Tus == nil {
+		return nil
+	}
+
+	return &tus{
+		path:       cfg.Tus.Path,
+		dir:        cfg.Dir,
+		maxSize:    int64(cfg.Tus.MaxSize * mb), //nolint:gosec
+		maxUploads: cfg.Tus.MaxUploads,
+		expiration: cfg.Tus.Expiration,
+		uid:        uid,
+		gid:        gid,
+		busy:       make(map[string]struct{}),
+	}
+}
+
+// match reports whether the path belongs to the tus endpoint.
+func (t *tus) match(p string) bool {
+	return t != nil && (strings.HasPrefix(p, t.path) || p+"/" == t.path)
+}
+
+// serveTus handles the tus requests, the request completing the upload goes to the worker.
+func (h *Handler) serveTus(w http.ResponseWriter, r *http.Request, start time.Time) {
+	t := h.tus
+	t.cleanup()
+
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Tus-Version", tusVersion)
+		w.Header().Set("Tus-Extension", tusExtensions)
+		if limit := t.limit(h.uploads, r.URL.Path); limit > 0 {
+			w.Header().Set("Tus-Max-Size", strconv.FormatInt(limit, 10))
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, strings.TrimSuffix(t.path, "/")), "/")
+	switch {
+	case id == "" && r.Method == http.MethodPost:
+		h.tusCreate(w, r, start)
+	case id == "":
+		w.Header().Set("Allow", "OPTIONS, POST")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	case !validTusID(id):
+		w.WriteHeader(http.StatusNotFound)
+	case r.Method == http.MethodHead:
+		t.head(w, id)
+	case r.Method == http.MethodPatch:
+		h.tusPatch(w, r, id, start)
+	case r.Method == http.MethodDelete:
+		t.terminate(w, id)
+	default:
+		w.Header().Set("Allow", "OPTIONS, HEAD, PATCH, DELETE")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// tusCreate creates the upload, the file extension rules and the size limits are checked upfront.
+func (h *Handler) tusCreate(w http.ResponseWriter, r *http.Request, start time.Time) {
+	t := h.tus
+
+	if r.Header.Get("Upload-Defer-Length") != "" {
+		http.Error(w, "Upload-Defer-Length is not supported", http.StatusBadRequest)
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		http.Error(w, "invalid Upload-Length", http.StatusBadRequest)
+		return
+	}
+
+	if limit := t.limit(h.uploads, r.URL.Path); limit > 0 && length > limit {
+		http.Error(w, "upload limit exceeded: max_size", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	metadata, err := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !h.uploads.allowedExt(strings.ToLower(path.Ext(metadata["filename"]))) {
+		http.Error(w, "forbidden file extension", http.StatusForbidden)
+		return
+	}
+
+	info := &tusInfo{
+		Length:      length,
+		Metadata:    metadata,
+		RawMetadata: r.Header.Get("Upload-Metadata"),
+		Expires:     time.Now().Add(t.expiration).UTC(),
+	}
+
+	id, err := t.create(info)
+	if stderr.Is(err, errTusFull) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(tusCleanupInterval.Seconds())))
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		h.log.Error("tus upload creation error", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", t.path+id)
+	w.Header().Set("Upload-Expires", info.Expires.Format(http.TimeFormat))
+
+	// an empty upload is completed by the creation, the worker responds instead of 201
+	if length == 0 {
+		h.tusComplete(w, r, id, info, start)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+// tusPatch appends the chunk at the Upload-Offset, the last chunk sends the completed file to the worker.
+func (h *Handler) tusPatch(w http.ResponseWriter, r *http.Request, id string, start time.Time) {
+	t := h.tus
+
+	if r.Header.Get("Content-Type") != tusContentType {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	if !t.lock(id) {
+		http.Error(w, "the upload is being patched", http.StatusLocked)
+		return
+	}
+	defer t.unlock(id)
+
+	info, ok := t.info(id)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset != t.offset(id) {
+		http.Error(w, "Upload-Offset does not match the upload", http.StatusConflict)
+		return
+	}
+
+	if r.ContentLength > info.Length-offset {
+		http.Error(w, "the chunk exceeds Upload-Length", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	file, err := os.OpenFile(t.file(id), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		h.log.Error("tus upload open error", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	dst := &fileWriter{file: file}
+	_, err = io.Copy(dst, io.LimitReader(r.Body, info.Length-offset))
+	errC := file.Close()
+
+	// the received part of the chunk is kept, the client resumes from the new offset
+	offset = t.offset(id)
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	w.Header().Set("Upload-Expires", info.Expires.Format(http.TimeFormat))
+
+	switch {
+	case dst.err != nil || errC != nil:
+		h.log.Error("tus upload write error", "error", stderr.Join(dst.err, errC))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	case err != nil:
+		status := http.StatusBadRequest
+		if _, ok := stderr.AsType[*http.MaxBytesError](err); ok {
+			status = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	if offset < info.Length {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	h.tusComplete(w, r, id, info, start)
+}
+
+// tusComplete sends the completed file to the worker as the "file" field of the uploads tree, the decoded
+// metadata is the parsed body. The file is removed after the worker request as any other upload.
+func (h *Handler) tusComplete(w http.ResponseWriter, r *http.Request, id string, info *tusInfo, start time.Time) {
+	t := h.tus
+
+	req := h.getReq(r)
+	// checked while the upload could still be completed again with a valid query
+	if h.parseQuery {
+		err := req.parseQuery(h.input)
+		if err != nil {
+			h.putReq(req)
+			status := http.StatusBadRequest
+			if _, ok := stderr.AsType[*inputLimitError](err); ok {
+				status = http.StatusRequestEntityTooLarge
+			}
+			http.Error(w, err.Error(), status)
+			h.log.Error("tus upload completion error", "error", err)
+			return
+		}
+	}
+
+	// the completed upload could not be resumed anymore
+	err := os.Remove(t.file(id) + tusInfoSuffix)
+	if err != nil {
+		h.log.Error("tus upload info removal error", "error", err)
+	}
+
+	f := &FileUpload{
+		Name:         info.Metadata["filename"],
+		Mime:         info.Metadata["filetype"],
+		Size:         info.Length,
+		Error:        UploadErrorOK,
+		TempFilename: t.file(id),
+		uid:          t.uid,
+		gid:          t.gid,
+	}
+
+	u := &Uploads{
+		tree:     fileTree{tusField: f},
+		list:     []*FileUpload{f},
+		claimDir: h.uploads.claimDir,
+		inflight: h.uploads.inflight,
+	}
+	u.track(f.TempFilename)
+
+	err = h.uploads.adopt(r.Context(), f)
+	if err != nil {
+		u.Clear(h.log)
+		h.putReq(req)
+		status := http.StatusInternalServerError
+		if _, ok := stderr.AsType[*scanError](err); ok {
+			status = http.StatusServiceUnavailable
+		}
+		http.Error(w, err.Error(), status)
+		h.log.Error("tus upload completion error", "error", err)
+		return
+	}
+
+	req.Uploads = u
+	if !h.sendRawBody {
+		data := make(dataTree, len(info.Metadata))
+		for k, v := range info.Metadata {
+			data[k] = v
+		}
+
+		req.body = data
+		req.Parsed = true
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(info.Length, 10))
+	h.exec(w, r, req, start)
+}
+
+// head reports the offset of the upload.
+func (t *tus) head(w http.ResponseWriter, id string) {
+	info, ok := t.info(id)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(t.offset(id), 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(info.Length, 10))
+	w.Header().Set("Upload-Expires", info.Expires.Format(http.TimeFormat))
+	if info.RawMetadata != "" {
+		w.Header().Set("Upload-Metadata", info.RawMetadata)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// terminate removes the upload.
+func (t *tus) terminate(w http.ResponseWriter, id string) {
+	if !t.lock(id) {
+		http.Error(w, "the upload is being patched", http.StatusLocked)
+		return
+	}
+	defer t.unlock(id)
+
+	if _, ok := t.info(id); !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	t.remove(id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// create stores the upload info and the empty content file, errTusFull is returned when max_uploads are
+// incomplete.
+func (t *tus) create(info *tusInfo) (string, error) {
+	// counting and creating is serialized, the concurrent requests could not exceed the limit
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.maxUploads > 0 {
+		matches, err := filepath.Glob(filepath.Join(t.dir, tusPrefix+"*"+tusInfoSuffix))
+		if err != nil {
+			return "", err
+		}
+
+		if len(matches) >= t.maxUploads {
+			return "", errTusFull
+		}
+	}
+
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	name := hex.EncodeToString(id)
+
+	file, err := os.OpenFile(t.file(name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return "", err
+	}
+
+	// set permissions, 0 means root or error
+	if t.uid != 0 && t.gid != 0 {
+		err = file.Chown(t.uid, t.gid)
+	}
+
+	errC := file.Close()
+	if err = stderr.Join(err, errC); err != nil {
+		_ = os.Remove(t.file(name))
+		return "", err
+	}
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		_ = os.Remove(t.file(name))
+		return "", err
+	}
+
+	err = os.WriteFile(t.file(name)+tusInfoSuffix, data, 0o600)
+	if err != nil {
+		t.remove(name)
+		return "", err
+	}
+
+	return name, nil
+}
+
+// info returns the state of the upload, the expired upload is removed.
+func (t *tus) info(id string) (*tusInfo, bool) {
+	data, err := os.ReadFile(t.file(id) + tusInfoSuffix)
+	if err != nil {
+		return nil, false
+	}
+
+	info := &tusInfo{}
+	err = json.Unmarshal(data, info)
+	if err != nil {
+		return nil, false
+	}
+
+	if time.Now().After(info.Expires) {
+		t.remove(id)
+		return nil, false
+	}
+
+	return info, true
+}
+
+// offset is the size of the received content.
+func (t *tus) offset(id string) int64 {
+	fi, err := os.Stat(t.file(id))
+	if err != nil {
+		return 0
+	}
+
+	return fi.Size()
+}
+
+// limit returns the maximum upload size in bytes, 0 - unlimited.
+func (t *tus) limit(up *uploads, p string) int64 {
+	limit := t.maxSize
+	if fs := up.limits(p).MaxFileSize * mb; fs > 0 && (limit == 0 || fs < limit) {
+		limit = fs
+	}
+
+	return limit
+}
+
+func (t *tus) file(id string) string {
+	return filepath.Join(t.dir, tusPrefix+id)
+}
+
+func (t *tus) remove(id string) {
+	_ = os.Remove(t.file(id) + tusInfoSuffix)
+	_ = os.Remove(t.file(id))
+}
+
+func (t *tus) lock(id string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.busy[id]; ok {
+		return false
+	}
+
+	t.busy[id] = struct{}{}
+	return true
+}
+
+func (t *tus) unlock(id string) {
+	t.mu.Lock()
+	delete(t.busy, id)
+	t.mu.Unlock()
+}
+
+// cleanup removes the expired uploads, at most once per tusCleanupInterval.
+func (t *tus) cleanup() {
+	t.mu.Lock()
+	if time.Since(t.cleaned) < tusCleanupInterval {
+		t.mu.Unlock()
+		return
+	}
+	t.cleaned = time.Now()
+	t.mu.Unlock()
+
+	matches, err := filepath.Glob(filepath.Join(t.dir, tusPrefix+"*"+tusInfoSuffix))
+	if err != nil {
+		return
+	}
+
+	for _, m := range matches {
+		id := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(m), tusPrefix), tusInfoSuffix)
+		if !t.lock(id) {
+			continue
+		}
+		// removes the expired upload
+		_, _ = t.info(id)
+		t.unlock(id)
+	}
+}
+
+func validTusID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// parseTusMetadata decodes the Upload-Metadata header: comma separated keys with the optional base64 values.
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for pair := range strings.SplitSeq(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, stderr.New("invalid Upload-Metadata: empty key")
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, stderr.New("invalid Upload-Metadata: the value of " + key + " is not base64")
+		}
+
+		metadata[key] = string(decoded)
+	}
+
+	return metadata, nil
+}
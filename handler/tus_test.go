@@ -0,0 +1,365 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	httpV1proto "github.com/roadrunner-server/api-go/v6/http/v1"
+	"github.com/roadrunner-server/http/v6/config"
+	"github.com/roadrunner-server/pool/v2/payload"
+	staticPool "github.com/roadrunner-server/pool/v2/pool/static_pool"
+	"google.golang.org/protobuf/proto"
+)
+
+// capturePool records the request sent to the worker and the temp files present at that moment.
+type capturePool struct {
+	mockPool
+	req    *httpV1proto.Request
+	body   string
+	stored map[string]bool
+}
+
+func (c *capturePool) Exec(_ context.Context, pld *payload.Payload, _ chan struct{}) (chan *staticPool.PExec, error) {
+	c.req = &httpV1proto.Request{}
+	if err := proto.Unmarshal(pld.Context, c.req); err != nil {
+		return nil, err
+	}
+	c.body = string(pld.Body)
+
+	var files map[string]*FileUpload
+	if err := json.Unmarshal(c.req.GetUploads(), &files); err != nil {
+		return nil, err
+	}
+	c.stored = make(map[string]bool)
+	for k, f := range files {
+		_, err := os.Stat(f.TempFilename)
+		c.stored[k] = err == nil
+	}
+
+	return nil, errors.New("captured")
+}
+
+func tusHandler(t *testing.T, tusCfg *config.Tus, p *capturePool) *Handler {
+	t.Helper()
+
+	cfg := defaultCfg()
+	cfg.Uploads = &config.Uploads{Dir: t.TempDir(), Forbid: []string{".php"}, Tus: tusCfg}
+	if err := cfg.Uploads.InitDefaults(); err != nil {
+		t.Fatal(err)
+	}
+
+	if p == nil {
+		return newTestHandler(t, cfg, nil)
+	}
+
+	return newTestHandler(t, cfg, p)
+}
+
+func tusRequest(t *testing.T, h *Handler, method, target string, headers map[string]string, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	r := httptest.NewRequestWithContext(t.Context(), method, target, strings.NewReader(body))
+	r.Header.Set("Tus-Resumable", tusVersion)
+	for k, v := range headers {
+		r.Header.Set(k, v)
+	}
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, r)
+
+	return rr
+}
+
+func tusCreated(t *testing.T, h *Handler, length int, metadata string) string {
+	t.Helper()
+
+	rr := tusRequest(t, h, http.MethodPost, "/files/", map[string]string{
+		"Upload-Length":   strconv.Itoa(length),
+		"Upload-Metadata": metadata,
+	}, "")
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d, want %d", rr.Code, http.StatusCreated)
+	}
+
+	return rr.Header().Get("Location")
+}
+
+func tusPatch(t *testing.T, h *Handler, location string, offset int, chunk string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	return tusRequest(t, h, http.MethodPatch, location, map[string]string{
+		"Upload-Offset": strconv.Itoa(offset),
+		"Content-Type":  tusContentType,
+	}, chunk)
+}
+
+func TestTus_Options(t *testing.T) {
+	h := tusHandler(t, &config.Tus{MaxSize: 10}, nil)
+
+	r := httptest.NewRequestWithContext(t.Context(), http.MethodOptions, "/files/", nil)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusNoContent)
+	}
+	if rr.Header().Get("Tus-Extension") != tusExtensions || rr.Header().Get("Tus-Max-Size") != strconv.Itoa(10*mb) {
+		t.Errorf("headers = %v, want the extensions and the max size", rr.Header())
+	}
+}
+
+func TestTus_ResumeFromOffset(t *testing.T) {
+	h := tusHandler(t, &config.Tus{MaxSize: 1}, nil)
+	// filename a.txt
+	location := tusCreated(t, h, 10, "filename YS50eHQ=")
+
+	if !strings.HasPrefix(location, "/files/") {
+		t.Fatalf("Location = %q, want the upload URL", location)
+	}
+
+	if rr := tusPatch(t, h, location, 0, "hello"); rr.Code != http.StatusNoContent || rr.Header().Get("Upload-Offset") != "5" {
+		t.Fatalf("patch: status = %d, offset = %q, want 204, 5", rr.Code, rr.Header().Get("Upload-Offset"))
+	}
+
+	// the connection was lost, the client asks for the offset
+	rr := tusRequest(t, h, http.MethodHead, location, nil, "")
+	if rr.Code != http.StatusOK || rr.Header().Get("Upload-Offset") != "5" || rr.Header().Get("Upload-Length") != "10" {
+		t.Fatalf("head: status = %d, headers = %v", rr.Code, rr.Header())
+	}
+	if rr.Header().Get("Upload-Metadata") != "filename YS50eHQ=" {
+		t.Errorf("Upload-Metadata = %q, want the creation metadata", rr.Header().Get("Upload-Metadata"))
+	}
+
+	if rr = tusPatch(t, h, location, 0, "hello"); rr.Code != http.StatusConflict {
+		t.Errorf("stale offset: status = %d, want %d", rr.Code, http.StatusConflict)
+	}
+
+	if rr = tusPatch(t, h, location, 5, "too long chunk"); rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized chunk: status = %d, want %d", rr.Code, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestTus_Complete_SendsFileToWorker(t *testing.T) {
+	p := &capturePool{}
+	h := tusHandler(t, &config.Tus{MaxSize: 1}, p)
+	// filename a.txt, filetype text/plain
+	location := tusCreated(t, h, 11, "filename YS50eHQ=,filetype dGV4dC9wbGFpbg==")
+
+	tusPatch(t, h, location, 0, "hello ")
+	tusPatch(t, h, location, 6, "world")
+
+	if p.req == nil {
+		t.Fatal("the completed upload was not sent to the worker")
+	}
+	if p.req.GetMethod() != http.MethodPatch || !p.req.GetParsed() {
+		t.Errorf("method = %s, parsed = %v", p.req.GetMethod(), p.req.GetParsed())
+	}
+	if !p.stored[tusField] {
+		t.Errorf("uploads = %s, want the stored file", p.req.GetUploads())
+	}
+	if !strings.Contains(string(p.req.GetUploads()), `"name":"a.txt","mime":"text/plain","size":11`) {
+		t.Errorf("uploads = %s, want the file from the metadata", p.req.GetUploads())
+	}
+	if !strings.Contains(p.body, `"filename":"a.txt"`) {
+		t.Errorf("body = %s, want the metadata", p.body)
+	}
+
+	// the upload is gone after the worker request
+	entries, err := os.ReadDir(h.tus.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("uploads dir has %d files, want none", len(entries))
+	}
+	if rr := tusRequest(t, h, http.MethodHead, location, nil, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("head: status = %d, want %d", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestTus_Complete_SmallFileWithMimeRules(t *testing.T) {
+	p := &capturePool{}
+	cfg := defaultCfg()
+	cfg.Uploads = &config.Uploads{Dir: t.TempDir(), AllowMime: []string{"text/*"}, Tus: &config.Tus{MaxSize: 1}}
+	if err := cfg.Uploads.InitDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	h := newTestHandler(t, cfg, p)
+
+	// filename a.txt, shorter than the sniffed head
+	location := tusCreated(t, h, 5, "filename YS50eHQ=")
+	if rr := tusPatch(t, h, location, 0, "hello"); rr.Code == http.StatusInternalServerError {
+		t.Fatalf("patch: status = %d, body = %s", rr.Code, rr.Body)
+	}
+
+	if p.req == nil {
+		t.Fatal("the completed upload was not sent to the worker")
+	}
+	if !p.stored[tusField] {
+		t.Errorf("uploads = %s, want the stored file", p.req.GetUploads())
+	}
+}
+
+// The query is parsed into rr:query the same as for the other requests, checked before the upload is completed.
+func TestTus_Complete_ParsesQuery(t *testing.T) {
+	p := &capturePool{}
+	h := tusHandler(t, &config.Tus{MaxSize: 1}, p)
+	h.parseQuery = true
+	h.input = &inputLimits{maxVars: 2}
+
+	location := tusCreated(t, h, 5, "filename YS50eHQ=")
+	if rr := tusPatch(t, h, location+"?a=1&b=2&c=3", 0, "hello"); rr.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("patch: status = %d, want %d", rr.Code, http.StatusRequestEntityTooLarge)
+	}
+	if p.req != nil {
+		t.Fatal("the upload was completed with the rejected query")
+	}
+
+	// the upload is still there, completed again with the valid query
+	tusPatch(t, h, location+"?a[]=1&b=%zz", 5, "")
+	if p.req == nil {
+		t.Fatal("the completed upload was not sent to the worker")
+	}
+
+	attr := p.req.GetAttributes()[QueryAttribute]
+	if attr == nil || string(attr.GetValue()[0]) != `{"a":["1"]}` {
+		t.Errorf("%s attribute = %v, want the query tree", QueryAttribute, attr)
+	}
+}
+
+func TestTus_CreateRejected(t *testing.T) {
+	h := tusHandler(t, &config.Tus{MaxSize: 1}, nil)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		status  int
+	}{
+		{"no length", map[string]string{}, http.StatusBadRequest},
+		{"too large", map[string]string{"Upload-Length": strconv.Itoa(mb + 1)}, http.StatusRequestEntityTooLarge},
+		// filename x.php
+		{"forbidden extension", map[string]string{"Upload-Length": "1", "Upload-Metadata": "filename eC5waHA="}, http.StatusForbidden},
+		{"malformed metadata", map[string]string{"Upload-Length": "1", "Upload-Metadata": "filename !!"}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rr := tusRequest(t, h, http.MethodPost, "/files/", tt.headers, ""); rr.Code != tt.status {
+				t.Errorf("status = %d, want %d", rr.Code, tt.status)
+			}
+		})
+	}
+}
+
+func TestTus_ProtocolErrors(t *testing.T) {
+	h := tusHandler(t, &config.Tus{MaxSize: 1}, nil)
+	location := tusCreated(t, h, 10, "")
+
+	r := httptest.NewRequestWithContext(t.Context(), http.MethodHead, location, nil)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, r)
+	if rr.Code != http.StatusPreconditionFailed || rr.Header().Get("Tus-Version") != tusVersion {
+		t.Errorf("no Tus-Resumable: status = %d, want %d", rr.Code, http.StatusPreconditionFailed)
+	}
+
+	rr = tusRequest(t, h, http.MethodPatch, location, map[string]string{"Upload-Offset": "0"}, "data")
+	if rr.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("wrong content type: status = %d, want %d", rr.Code, http.StatusUnsupportedMediaType)
+	}
+
+	if rr = tusRequest(t, h, http.MethodHead, "/files/../../etc/passwd", nil, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("invalid id: status = %d, want %d", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestTus_Terminate(t *testing.T) {
+	h := tusHandler(t, &config.Tus{MaxSize: 1}, nil)
+	location := tusCreated(t, h, 10, "")
+	tusPatch(t, h, location, 0, "hello")
+
+	if rr := tusRequest(t, h, http.MethodDelete, location, nil, ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("delete: status = %d, want %d", rr.Code, http.StatusNoContent)
+	}
+
+	entries, err := os.ReadDir(h.tus.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("uploads dir has %d files, want none", len(entries))
+	}
+
+	if rr := tusRequest(t, h, http.MethodDelete, location, nil, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("second delete: status = %d, want %d", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestTus_Expiration(t *testing.T) {
+	h := tusHandler(t, &config.Tus{MaxSize: 1, Expiration: time.Millisecond}, nil)
+	location := tusCreated(t, h, 10, "")
+	stale := tusCreated(t, h, 10, "")
+	time.Sleep(time.Millisecond * 5)
+
+	if rr := tusPatch(t, h, location, 0, "hello"); rr.Code != http.StatusNotFound {
+		t.Errorf("expired patch: status = %d, want %d", rr.Code, http.StatusNotFound)
+	}
+
+	// the expired uploads nobody asks about are removed by the cleanup
+	h.tus.cleaned = time.Time{}
+	h.tus.cleanup()
+
+	id := strings.TrimPrefix(stale, "/files/")
+	if _, err := os.Stat(filepath.Join(h.tus.dir, tusPrefix+id)); !os.IsNotExist(err) {
+		t.Errorf("stat = %v, want the expired upload removed", err)
+	}
+}
+
+func TestTus_MaxUploads(t *testing.T) {
+	h := tusHandler(t, &config.Tus{MaxSize: 1, MaxUploads: 2}, nil)
+	first := tusCreated(t, h, 10, "")
+	tusCreated(t, h, 10, "")
+
+	rr := tusRequest(t, h, http.MethodPost, "/files/", map[string]string{"Upload-Length": "10"}, "")
+	if rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Retry-After") == "" {
+		t.Fatalf("create over the limit: status = %d, want %d", rr.Code, http.StatusServiceUnavailable)
+	}
+
+	// the completed or terminated upload frees the slot
+	tusRequest(t, h, http.MethodDelete, first, nil, "")
+	tusCreated(t, h, 10, "")
+}
+
+func TestTus_RequiresSizeLimit(t *testing.T) {
+	cfg := &config.Uploads{Dir: t.TempDir(), Tus: &config.Tus{}}
+	if err := cfg.InitDefaults(); err == nil {
+		t.Fatal("expected an error for tus without max_size and max_file_size")
+	}
+
+	cfg = &config.Uploads{Dir: t.TempDir(), Tus: &config.Tus{}, UploadLimits: config.UploadLimits{MaxFileSize: 10}}
+	if err := cfg.InitDefaults(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseTusMetadata(t *testing.T) {
+	m, err := parseTusMetadata("filename d29ybGRfZG9taW5hdGlvbl9wbGFuLnBkZg==,is_confidential")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m["filename"] != "world_domination_plan.pdf" || len(m) != 2 {
+		t.Errorf("metadata = %v", m)
+	}
+	if v, ok := m["is_confidential"]; !ok || v != "" {
+		t.Errorf("is_confidential = %q, %v, want the key without a value", v, ok)
+	}
+}
@@ -1,12 +1,16 @@
 package handler
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"log/slog"
 	"mime/multipart"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
 	"sync"
 )
@@ -14,6 +18,10 @@ import (
 const (
 	// UploadErrorOK - no error, the file uploaded with success.
 	UploadErrorOK = 0
+	// UploadErrorIniSize - the file exceeds max_file_size or max_files.
+	UploadErrorIniSize = 1
+	// UploadErrorFormSize - the file exceeds max_total_size or the MAX_FILE_SIZE form field.
+	UploadErrorFormSize = 2
 	// UploadErrorNoFile - no file was uploaded.
 	UploadErrorNoFile = 4
 	// UploadErrorNoTmpDir - missing a temporary folder.
@@ -22,9 +30,13 @@ const (
 	UploadErrorCantWrite = 7
 	// UploadErrorExtension - forbidden file extension.
 	UploadErrorExtension = 8
-	pattern              = "upload"
+	// UploadErrorInfected - the malware scanner found a threat, the file was removed (not a PHP code).
+	UploadErrorInfected = 9
+	pattern             = "upload"
 )
 
+var errTooLarge = errors.New("the file exceeds the upload limit")
+
 // Uploads tree manages uploaded files tree and temporary files.
 type Uploads struct {
 	// pre processed data tree for Uploads.
@@ -32,6 +44,13 @@ type Uploads struct {
 
 	// flat list of all file Uploads.
 	list []*FileUpload
+
+	// the claimed files are moved to, empty - kept in place
+	claimDir string
+
+	// the temp files are kept from the janitor until Clear
+	inflight *inflight
+	tracked  []string
 }
 
 // MarshalJSON marshal tree into JSON.
@@ -39,8 +58,8 @@ func (u *Uploads) MarshalJSON() ([]byte, error) {
 	return json.Marshal(u.tree)
 }
 
-// Open moves all uploaded files to temp directory, return error in case of issue with temp directory. File errors
-// will be handled individually.
+// Open stores the files added with NewUpload into the temp dir, the file errors are handled individually.
+// The multipart requests served by the handler are stored while the body is read, their files are skipped.
 func (u *Uploads) Open(log *slog.Logger, dir string, forbid, allow map[string]struct{}) {
 	var wg sync.WaitGroup
 	for _, f := range u.list {
@@ -55,13 +74,75 @@ func (u *Uploads) Open(log *slog.Logger, dir string, forbid, allow map[string]st
 	wg.Wait()
 }
 
-// Clear deletes all temporary files.
+// Report logs the file system errors of the uploaded files.
+func (u *Uploads) Report(log *slog.Logger) {
+	for _, f := range u.list {
+		if f.err != nil {
+			log.Error("error storing the uploaded file", "name", f.Name, "error", f.err)
+		}
+	}
+}
+
+// Clear deletes all temporary files except the ones claimed by the worker, the claimed files are moved
+// to the claim dir (if set).
 func (u *Uploads) Clear(log *slog.Logger) {
 	for _, f := range u.list {
-		if f.TempFilename != "" && exists(f.TempFilename) {
-			err := os.Remove(f.TempFilename)
+		if f.TempFilename == "" || !exists(f.TempFilename) {
+			continue
+		}
+
+		if f.claimed {
+			if u.claimDir == "" {
+				continue
+			}
+
+			err := moveFile(f.TempFilename, filepath.Join(u.claimDir, filepath.Base(f.TempFilename)))
 			if err != nil && log != nil {
-				log.Error("error removing the file", "error", err)
+				log.Error("error moving the claimed file", "error", err)
+			}
+			continue
+		}
+
+		err := os.Remove(f.TempFilename)
+		if err != nil && log != nil {
+			log.Error("error removing the file", "error", err)
+		}
+	}
+
+	for _, name := range u.tracked {
+		u.inflight.remove(name)
+	}
+	u.tracked = nil
+}
+
+// track keeps the temp file from the janitor until the request is done.
+func (u *Uploads) track(name string) {
+	if u == nil || u.inflight == nil || name == "" {
+		return
+	}
+
+	u.inflight.add(name)
+	u.tracked = append(u.tracked, name)
+}
+
+// claim keeps the files listed by the worker (the temp file paths or their base names, comma separated)
+// after the request.
+func (u *Uploads) claim(values [][]byte) {
+	if u == nil {
+		return
+	}
+
+	for _, v := range values {
+		for name := range strings.SplitSeq(string(v), ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+
+			for _, f := range u.list {
+				if f.TempFilename != "" && (f.TempFilename == name || filepath.Base(f.TempFilename) == name) {
+					f.claimed = true
+				}
 			}
 		}
 	}
@@ -79,15 +160,30 @@ type FileUpload struct {
 	Error int `json:"error"`
 	// TempFilename points to temporary file location.
 	TempFilename string `json:"tmpName"`
-	// associated file header
+	// DetectedMime contains mime-type detected from the file content (uploads.detect_mime).
+	DetectedMime string `json:"detectedMime,omitempty"`
+	// Checksums contains the hex encoded digests of the file content by the algorithm (uploads.checksums).
+	Checksums map[string]string `json:"checksums,omitempty"`
+	// Width of the uploaded image in pixels (uploads.image_size).
+	Width int `json:"width,omitempty"`
+	// Height of the uploaded image in pixels (uploads.image_size).
+	Height int `json:"height,omitempty"`
+	// Threat contains the name of the threat found by the malware scanner (uploads.scan).
+	Threat string `json:"threat,omitempty"`
+
+	// associated file header, nil - streamed from the multipart part
 	header *multipart.FileHeader
 
 	// private
 	uid int
 	gid int
+	// file system error behind the Error code
+	err error
+	// kept after the request (X-Upload-Claim)
+	claimed bool
 }
 
-// NewUpload wraps net/http upload into PRS-7 compatible structure.
+// NewUpload wraps net/http upload into PSR-7 compatible structure, the file is stored by Open.
 func NewUpload(f *multipart.FileHeader, uid, gid int) *FileUpload {
 	return &FileUpload{
 		Name:   f.Filename,
@@ -99,27 +195,21 @@ func NewUpload(f *multipart.FileHeader, uid, gid int) *FileUpload {
 	}
 }
 
-// Open moves file content into temporary file available for PHP.
-// NOTE:
-// There is 2 deferred functions, and in case of getting 2 errors from both functions
-// error from close of temp file would be overwritten by error from the main file
-// STACK
-// DEFER FILE CLOSE (2)
-// DEFER TMP CLOSE  (1)
-func (f *FileUpload) Open(dir string, forbid, allow map[string]struct{}) error {
-	ext := strings.ToLower(path.Ext(f.Name))
-
-	if _, ok := forbid[ext]; ok {
-		f.Error = UploadErrorExtension
-		return nil
+// newPartUpload wraps the multipart file part into PSR-7 compatible structure, the part is stored by store.
+func newPartUpload(part *multipart.Part, uid, gid int) *FileUpload {
+	return &FileUpload{
+		Name:  part.FileName(),
+		Mime:  part.Header.Get("Content-Type"),
+		Error: UploadErrorOK,
+		uid:   uid,
+		gid:   gid,
 	}
+}
 
-	// if allow is empty, all extensions (except forbidden) are allowed
-	if len(allow) > 0 {
-		if _, ok := allow[ext]; !ok {
-			f.Error = UploadErrorExtension
-			return nil
-		}
+// Open moves the content of the file added with NewUpload into temporary file available for PHP.
+func (f *FileUpload) Open(dir string, forbid, allow map[string]struct{}) error {
+	if f.header == nil {
+		return nil
 	}
 
 	file, err := f.header.Open()
@@ -129,36 +219,209 @@ func (f *FileUpload) Open(dir string, forbid, allow map[string]struct{}) error {
 	}
 
 	defer func() {
-		// close the main file
-		err = file.Close()
+		_ = file.Close()
 	}()
 
-	tmp, err := os.CreateTemp(dir, pattern)
+	err = f.store(file, &uploads{dir: dir, forbid: forbid, allow: allow}, nil, -1)
+	if err != nil {
+		return err
+	}
+
+	return f.err
+}
+
+// store streams the file content straight into the temporary file available for PHP, computing the configured
+// checksums on the way. A forbidden file is rejected before its content is read, the file with the forbidden
+// content - after the first bytes are sniffed. The file larger than the limit (negative - unlimited) is removed
+// as soon as the limit is exceeded and errTooLarge is returned. Other returned errors are the errors reading src
+// (the request body), the file system errors are reported via the Error code. The temp file is tracked by u
+// (nil - not tracked) from its creation, so the janitor does not remove the file of a stalled upload.
+func (f *FileUpload) store(src io.Reader, up *uploads, u *Uploads, limit int64) error {
+	ext := strings.ToLower(path.Ext(f.Name))
+
+	if !up.allowedExt(ext) {
+		f.Error = UploadErrorExtension
+		return nil
+	}
+
+	if up.mime != nil {
+		head := make([]byte, sniffLen)
+		n, err := io.ReadFull(src, head)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return err
+		}
+
+		f.DetectedMime = detectMime(head[:n])
+		if !up.mime.allowed(f.DetectedMime, ext) {
+			f.Error = UploadErrorExtension
+			return nil
+		}
+
+		src = io.MultiReader(bytes.NewReader(head[:n]), src)
+	}
+
+	tmp, err := os.CreateTemp(up.dir, pattern)
 	if err != nil {
 		// most likely cause of this issue is missing tmp dir
 		f.Error = UploadErrorNoTmpDir
-		return err
+		f.err = err
+		return nil
 	}
 
+	f.TempFilename = tmp.Name()
+	u.track(f.TempFilename)
+
 	// set permissions, 0 means root or error
 	if f.uid != 0 && f.gid != 0 {
 		err = tmp.Chown(f.uid, f.gid)
 		if err != nil {
+			_ = tmp.Close()
+			f.Error = UploadErrorCantWrite
+			f.err = err
+			return nil
+		}
+	}
+
+	if limit >= 0 {
+		// one more byte tells the file exceeding the limit
+		src = io.LimitReader(src, limit+1)
+	}
+
+	dst := &fileWriter{file: tmp}
+	w, hashes := up.digests.writer(dst)
+	f.Size, err = io.Copy(w, src)
+
+	errC := tmp.Close()
+	switch {
+	case limit >= 0 && f.Size > limit && dst.err == nil:
+		_ = os.Remove(f.TempFilename)
+		f.TempFilename = ""
+		f.Size = 0
+		return errTooLarge
+	case dst.err != nil:
+		f.Error = UploadErrorCantWrite
+		f.err = dst.err
+	case err != nil:
+		return err
+	case errC != nil:
+		f.Error = UploadErrorCantWrite
+		f.err = errC
+	default:
+		up.digests.apply(f, hashes)
+	}
+
+	return nil
+}
+
+// adopt applies the content rules, the digests and the scanner to the file assembled outside of store
+// (the tus uploads). The file with the forbidden content is removed and marked with the Error code.
+func (u *uploads) adopt(ctx context.Context, f *FileUpload) error {
+	if u.mime != nil || u.digests != nil {
+		file, err := os.Open(f.TempFilename)
+		if err != nil {
+			return err
+		}
+
+		head := make([]byte, sniffLen)
+		n, err := io.ReadFull(file, head)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			_ = file.Close()
 			return err
 		}
+
+		if u.mime != nil {
+			f.DetectedMime = detectMime(head[:n])
+			if !u.mime.allowed(f.DetectedMime, strings.ToLower(path.Ext(f.Name))) {
+				_ = file.Close()
+				err = os.Remove(f.TempFilename)
+				f.TempFilename = ""
+				f.Size = 0
+				f.Error = UploadErrorExtension
+				return err
+			}
+		}
+
+		w, hashes := u.digests.writer(io.Discard)
+		if len(hashes) > 0 {
+			_, _ = w.Write(head[:n])
+			_, err = io.Copy(w, file)
+			if err != nil {
+				_ = file.Close()
+				return err
+			}
+		}
+
+		_ = file.Close()
+		u.digests.apply(f, hashes)
 	}
 
-	f.TempFilename = tmp.Name()
+	return u.scan.scan(ctx, []*FileUpload{f})
+}
+
+// allowedExt reports whether the files with the lowercase extension could be stored.
+func (u *uploads) allowedExt(ext string) bool {
+	if _, ok := u.forbid[ext]; ok {
+		return false
+	}
+
+	// if allow is empty, all extensions (except forbidden) are allowed
+	if len(u.allow) > 0 {
+		if _, ok := u.allow[ext]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// fileWriter tells the file system errors from the request body errors during io.Copy.
+type fileWriter struct {
+	file *os.File
+	err  error
+}
+
+func (w *fileWriter) Write(p []byte) (int, error) {
+	n, err := w.file.Write(p)
+	if err != nil {
+		w.err = err
+	}
+
+	return n, err
+}
+
+// moveFile renames the file, the file is copied when the rename fails (e.g. across the file systems).
+func moveFile(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
 	defer func() {
-		// close the temp file
-		err = tmp.Close()
+		_ = in.Close()
 	}()
 
-	if f.Size, err = io.Copy(tmp, file); err != nil {
-		f.Error = UploadErrorCantWrite
+	fi, err := in.Stat()
+	if err != nil {
+		return err
 	}
 
-	return nil
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	errC := out.Close()
+	if err = errors.Join(err, errC); err != nil {
+		_ = os.Remove(dst)
+		return err
+	}
+
+	return os.Remove(src)
 }
 
 // exists if file exists.
@@ -2,18 +2,48 @@ package handler
 
 import (
 	"bytes"
+	"errors"
+	"io"
 	"log/slog"
 	"mime/multipart"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 // uploadContent is the payload every fixture file carries.
 const uploadContent = "content"
 
+// newFilePart returns the single file part of an encoded multipart body, the same as a served request.
+func newFilePart(t *testing.T, filename string) *multipart.Part {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	fw, err := w.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = fw.Write([]byte(uploadContent)); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	part, err := multipart.NewReader(&buf, w.Boundary()).NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return part
+}
+
 // newFileHeader round-trips a single part through the multipart reader so the
-// resulting header carries a real backing store, the same as a served request.
+// resulting header carries a real backing store, the same as a parsed form.
 func newFileHeader(t *testing.T, filename string) *multipart.FileHeader {
 	t.Helper()
 
@@ -40,10 +70,18 @@ func newFileHeader(t *testing.T, filename string) *multipart.FileHeader {
 	return form.File["file"][0]
 }
 
-func TestFileUploadOpen_ForbiddenExtension_IsCaseInsensitive(t *testing.T) {
-	f := NewUpload(newFileHeader(t, "x.PHP"), 0, 0)
+// unreadable fails the test when the upload content is read.
+type unreadable struct{ t *testing.T }
 
-	err := f.Open(t.TempDir(), map[string]struct{}{".php": {}}, nil)
+func (u unreadable) Read([]byte) (int, error) {
+	u.t.Error("the rejected file content was read")
+	return 0, io.EOF
+}
+
+func TestFileUploadStore_ForbiddenExtension_IsCaseInsensitive(t *testing.T) {
+	f := newPartUpload(newFilePart(t, "x.PHP"), 0, 0)
+
+	err := f.store(unreadable{t}, &uploads{dir: t.TempDir(), forbid: map[string]struct{}{".php": {}}}, nil, -1)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -55,10 +93,10 @@ func TestFileUploadOpen_ForbiddenExtension_IsCaseInsensitive(t *testing.T) {
 	}
 }
 
-func TestFileUploadOpen_NotInAllowList_Rejected(t *testing.T) {
-	f := NewUpload(newFileHeader(t, "x.png"), 0, 0)
+func TestFileUploadStore_NotInAllowList_Rejected(t *testing.T) {
+	f := newPartUpload(newFilePart(t, "x.png"), 0, 0)
 
-	err := f.Open(t.TempDir(), nil, map[string]struct{}{".jpg": {}})
+	err := f.store(unreadable{t}, &uploads{dir: t.TempDir(), allow: map[string]struct{}{".jpg": {}}}, nil, -1)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -70,11 +108,16 @@ func TestFileUploadOpen_NotInAllowList_Rejected(t *testing.T) {
 	}
 }
 
-func TestFileUploadOpen_InAllowList_CopiedToTempDir(t *testing.T) {
+func TestFileUploadStore_InAllowList_StreamedToTempDir(t *testing.T) {
 	dir := t.TempDir()
-	f := NewUpload(newFileHeader(t, "x.JPG"), 0, 0)
+	part := newFilePart(t, "x.JPG")
+	f := newPartUpload(part, 0, 0)
 
-	err := f.Open(dir, nil, map[string]struct{}{".jpg": {}})
+	if f.Name != "x.JPG" || f.Mime != "application/octet-stream" {
+		t.Errorf("Name = %q, Mime = %q, want the client values", f.Name, f.Mime)
+	}
+
+	err := f.store(part, &uploads{dir: dir, allow: map[string]struct{}{".jpg": {}}}, nil, -1)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -84,6 +127,9 @@ func TestFileUploadOpen_InAllowList_CopiedToTempDir(t *testing.T) {
 	if f.Size != int64(len(uploadContent)) {
 		t.Errorf("Size = %d, want %d", f.Size, len(uploadContent))
 	}
+	if filepath.Dir(f.TempFilename) != dir {
+		t.Errorf("TempFilename = %q, want a file in %q", f.TempFilename, dir)
+	}
 
 	data, err := os.ReadFile(f.TempFilename)
 	if err != nil {
@@ -94,38 +140,90 @@ func TestFileUploadOpen_InAllowList_CopiedToTempDir(t *testing.T) {
 	}
 }
 
-func TestFileUploadOpen_MissingTempDir_ReportsNoTmpDir(t *testing.T) {
-	f := NewUpload(newFileHeader(t, "x.txt"), 0, 0)
+func TestFileUploadStore_MissingTempDir_ReportsNoTmpDir(t *testing.T) {
+	f := newPartUpload(newFilePart(t, "x.txt"), 0, 0)
 
-	err := f.Open(filepath.Join(t.TempDir(), "does-not-exist"), nil, nil)
-	if err == nil {
-		t.Fatal("expected an error from os.CreateTemp")
+	err := f.store(strings.NewReader(uploadContent), &uploads{dir: filepath.Join(t.TempDir(), "does-not-exist")}, nil, -1)
+	if err != nil {
+		t.Fatal(err)
 	}
 	if f.Error != UploadErrorNoTmpDir {
 		t.Errorf("Error = %d, want %d", f.Error, UploadErrorNoTmpDir)
 	}
+	if f.err == nil {
+		t.Error("the os.CreateTemp error must be kept for the report")
+	}
 }
 
-func TestFileUploadOpen_ChownDenied_ReturnsError(t *testing.T) {
+func TestFileUploadStore_ChownDenied_ReportsCantWrite(t *testing.T) {
 	if os.Geteuid() == 0 {
 		t.Skip("root may chown to any uid, the failure arm is unreachable")
 	}
 
 	// uid/gid 1 is a system account; chowning to it requires privileges.
-	f := NewUpload(newFileHeader(t, "x.txt"), 1, 1)
+	f := newPartUpload(newFilePart(t, "x.txt"), 1, 1)
 
-	if err := f.Open(t.TempDir(), nil, nil); err == nil {
-		t.Fatal("expected an error from Chown")
+	if err := f.store(strings.NewReader(uploadContent), &uploads{dir: t.TempDir()}, nil, -1); err != nil {
+		t.Fatal(err)
+	}
+	if f.Error != UploadErrorCantWrite || f.err == nil {
+		t.Errorf("Error = %d (%v), want %d with the Chown error", f.Error, f.err, UploadErrorCantWrite)
 	}
 }
 
-func TestUploadsOpen_LogsPerFileErrors(t *testing.T) {
-	u := &Uploads{list: []*FileUpload{NewUpload(newFileHeader(t, "x.txt"), 0, 0)}}
+func TestFileUploadStore_BodyError_Returned(t *testing.T) {
+	f := newPartUpload(newFilePart(t, "x.txt"), 0, 0)
 
-	u.Open(slog.New(slog.DiscardHandler), filepath.Join(t.TempDir(), "does-not-exist"), nil, nil)
+	src := io.MultiReader(strings.NewReader("par"), iotest.ErrReader(io.ErrUnexpectedEOF))
+	err := f.store(src, &uploads{dir: t.TempDir()}, nil, -1)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("error = %v, want the body error", err)
+	}
+	if f.Error != UploadErrorOK {
+		t.Errorf("Error = %d, want %d, the body error is not a file system error", f.Error, UploadErrorOK)
+	}
+	if f.TempFilename == "" {
+		t.Error("TempFilename is empty, the partial file must be known to be removed")
+	}
+}
+
+func TestFileUploadStore_Limit(t *testing.T) {
+	dir := t.TempDir()
+
+	f := newPartUpload(newFilePart(t, "x.txt"), 0, 0)
+	if err := f.store(strings.NewReader(uploadContent), &uploads{dir: dir}, nil, int64(len(uploadContent))); err != nil {
+		t.Fatalf("a file of exactly the limit size must be stored, got %v", err)
+	}
+
+	f = newPartUpload(newFilePart(t, "y.txt"), 0, 0)
+	err := f.store(strings.NewReader(uploadContent), &uploads{dir: dir}, nil, int64(len(uploadContent))-1)
+	if !errors.Is(err, errTooLarge) {
+		t.Fatalf("error = %v, want errTooLarge", err)
+	}
+	if f.TempFilename != "" || f.Size != 0 {
+		t.Errorf("TempFilename = %q, Size = %d, want the file removed", f.TempFilename, f.Size)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("dir has %d files, want only the file within the limit", len(entries))
+	}
+}
+
+func TestUploadsReport_LogsFileSystemErrors(t *testing.T) {
+	var buf bytes.Buffer
+	u := &Uploads{list: []*FileUpload{
+		{Name: "ok.txt"},
+		{Name: "broken.txt", Error: UploadErrorNoTmpDir, err: os.ErrNotExist},
+	}}
+
+	u.Report(slog.New(slog.NewTextHandler(&buf, nil)))
 
-	if u.list[0].Error != UploadErrorNoTmpDir {
-		t.Errorf("Error = %d, want %d", u.list[0].Error, UploadErrorNoTmpDir)
+	if !strings.Contains(buf.String(), "broken.txt") || strings.Contains(buf.String(), "ok.txt") {
+		t.Errorf("log = %q, want only the failed file", buf.String())
 	}
 }
 
@@ -180,3 +278,113 @@ func TestExists_ReportsPresence(t *testing.T) {
 		t.Error("exists() reported an existing directory as missing")
 	}
 }
+
+func storedUploads(t *testing.T, claimDir string, names ...string) *Uploads {
+	t.Helper()
+
+	up := &uploads{dir: t.TempDir()}
+	u := &Uploads{tree: make(fileTree), claimDir: claimDir}
+	for _, name := range names {
+		f := newPartUpload(newFilePart(t, name), 0, 0)
+		if err := f.store(strings.NewReader(uploadContent), up, nil, -1); err != nil {
+			t.Fatal(err)
+		}
+		u.list = append(u.list, f)
+	}
+
+	return u
+}
+
+func TestUploadsClear_ClaimedKept(t *testing.T) {
+	u := storedUploads(t, "", "a.txt", "b.txt", "c.txt")
+	a, b, c := u.list[0], u.list[1], u.list[2]
+
+	// the full path, the base name and an unknown file
+	u.claim([][]byte{[]byte(a.TempFilename), []byte(" " + filepath.Base(b.TempFilename) + ", upload-unknown")})
+	u.Clear(nil)
+
+	for _, f := range []*FileUpload{a, b} {
+		if !exists(f.TempFilename) {
+			t.Errorf("%s: the claimed file was removed", f.Name)
+		}
+	}
+	if exists(c.TempFilename) {
+		t.Errorf("%s: the file was not removed", c.Name)
+	}
+}
+
+func TestUploadsClear_ClaimedMoved(t *testing.T) {
+	claimDir := t.TempDir()
+	u := storedUploads(t, claimDir, "a.txt", "b.txt")
+	a, b := u.list[0], u.list[1]
+
+	u.claim([][]byte{[]byte(a.TempFilename)})
+	u.Clear(nil)
+
+	if exists(a.TempFilename) || exists(b.TempFilename) {
+		t.Error("the uploads dir still has the files")
+	}
+
+	content, err := os.ReadFile(filepath.Join(claimDir, filepath.Base(a.TempFilename)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != uploadContent {
+		t.Errorf("content = %q, want %q", content, uploadContent)
+	}
+}
+
+func TestMoveFile_FailureKeepsSource(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	if err := os.WriteFile(src, []byte(uploadContent), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// the destination exists, the rename of a file over a directory fails and so does the copy
+	dst := t.TempDir()
+	if err := moveFile(src, dst); err == nil {
+		t.Fatal("expected an error moving over a directory")
+	}
+	if !exists(src) {
+		t.Error("the source was removed after the failed move")
+	}
+}
+
+func TestFileUploadOpen_FileHeader(t *testing.T) {
+	dir := t.TempDir()
+	f := NewUpload(newFileHeader(t, "x.JPG"), 0, 0)
+
+	err := f.Open(dir, nil, map[string]struct{}{".jpg": {}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Error != UploadErrorOK || f.Size != int64(len(uploadContent)) {
+		t.Fatalf("Error = %d, Size = %d, want the stored file", f.Error, f.Size)
+	}
+
+	data, err := os.ReadFile(f.TempFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != uploadContent {
+		t.Errorf("temp file = %q, want %q", data, uploadContent)
+	}
+
+	f = NewUpload(newFileHeader(t, "x.PHP"), 0, 0)
+	if err = f.Open(dir, map[string]struct{}{".php": {}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if f.Error != UploadErrorExtension || f.TempFilename != "" {
+		t.Errorf("Error = %d, TempFilename = %q, want the forbidden file dropped", f.Error, f.TempFilename)
+	}
+}
+
+func TestUploadsOpen_MissingTempDir_ReportsNoTmpDir(t *testing.T) {
+	f := NewUpload(newFileHeader(t, "x.txt"), 0, 0)
+	u := &Uploads{list: []*FileUpload{f}}
+
+	u.Open(slog.New(slog.DiscardHandler), filepath.Join(t.TempDir(), "does-not-exist"), nil, nil)
+	if f.Error != UploadErrorNoTmpDir {
+		t.Errorf("Error = %d, want %d", f.Error, UploadErrorNoTmpDir)
+	}
+}
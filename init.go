@@ -6,7 +6,6 @@ import (
 	"github.com/quic-go/quic-go/http3"
 	"github.com/roadrunner-server/http/v6/acme"
 	"github.com/roadrunner-server/http/v6/api"
-	"github.com/roadrunner-server/http/v6/config"
 	bundledMw "github.com/roadrunner-server/http/v6/middleware"
 	"github.com/roadrunner-server/http/v6/servers/fcgi"
 	httpServer "github.com/roadrunner-server/http/v6/servers/http11"
@@ -17,8 +16,18 @@ import (
 // ------- PRIVATE ---------
 
 func (p *Plugin) initServers() error {
-	if p.cfg.EnableHTTP3() && p.experimentalFeatures {
-		http3Srv, err := http3Server.NewHTTP3server(p, nilOr(p.cfg), p.cfg.HTTP3Config, p.log)
+	// the certificates, the storage client and the on-demand limits are shared by the https and http3 servers
+	if p.cfg.SSLConfig.EnableACME() {
+		certs, err := acme.IssueCertificates(p.cfg.SSLConfig.Acme, p, p.log)
+		if err != nil {
+			return err
+		}
+
+		p.certs = certs
+	}
+
+	if p.cfg.EnableHTTP3() {
+		http3Srv, err := http3Server.NewHTTP3server(p, p.certs, p.cfg.HTTP3Config, p.log)
 		if err != nil {
 			return err
 		}
@@ -31,7 +40,7 @@ func (p *Plugin) initServers() error {
 	}
 
 	if p.cfg.EnableTLS() {
-		https, err := httpsServer.NewHTTPSServer(p, p.cfg.SSLConfig, p.cfg.HTTP2Config, p.stdLog, p.log)
+		https, err := httpsServer.NewHTTPSServer(p, p.cfg.SSLConfig, p.cfg.HTTP2Config, p.certs, p.stdLog, p.log)
 		if err != nil {
 			return err
 		}
@@ -46,23 +55,30 @@ func (p *Plugin) initServers() error {
 	return nil
 }
 
-func nilOr(cfg *config.Config) *acme.Config {
-	if cfg.SSLConfig == nil || cfg.SSLConfig.Acme == nil {
-		return nil
+func (p *Plugin) applyBundledMiddleware() {
+	// advertise HTTP/3 on the http and https responses
+	var altSvc string
+	if p.cfg.EnableHTTP3() {
+		altSvc = p.cfg.HTTP3Config.AltSvc()
 	}
 
-	return cfg.SSLConfig.Acme
-}
-
-func (p *Plugin) applyBundledMiddleware() {
-	// apply max_req_size and logger middleware
+	// apply max_req_size, decompression and logger middleware
 	for _, s := range p.servers {
 		switch srv := s.Server().(type) {
 		case *http.Server:
 			srv.Handler = bundledMw.MaxRequestSize(srv.Handler, p.cfg.MaxRequestSize*MB)
+			if len(p.cfg.Decompress) > 0 {
+				srv.Handler = bundledMw.Decompress(srv.Handler, p.cfg.Decompress, p.cfg.MaxRequestSize*MB)
+			}
+			if altSvc != "" {
+				srv.Handler = bundledMw.AltSvc(srv.Handler, altSvc)
+			}
 			srv.Handler = bundledMw.NewLogMiddleware(srv.Handler, p.cfg.AccessLogs, p.log)
 		case *http3.Server:
 			srv.Handler = bundledMw.MaxRequestSize(srv.Handler, p.cfg.MaxRequestSize*MB)
+			if len(p.cfg.Decompress) > 0 {
+				srv.Handler = bundledMw.Decompress(srv.Handler, p.cfg.Decompress, p.cfg.MaxRequestSize*MB)
+			}
 			srv.Handler = bundledMw.NewLogMiddleware(srv.Handler, p.cfg.AccessLogs, p.log)
 		default:
 			p.log.Error("unknown server type", "server", s.Server())
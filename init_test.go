@@ -1,9 +1,14 @@
 package http
 
 import (
+	"bytes"
+	"compress/gzip"
+	"io"
 	"log/slog"
 	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	quicHTTP3 "github.com/quic-go/quic-go/http3"
 	"github.com/roadrunner-server/http/v6/acme"
@@ -23,33 +28,54 @@ func (s *stubInternalServer) Serve(map[string]api.Middleware, []string) error {
 func (s *stubInternalServer) Server() any                                     { return s.inner }
 func (s *stubInternalServer) Stop()                                           {}
 
-func TestNilOr(t *testing.T) {
-	acmeCfg := &acme.Config{Email: "a@b.c"}
+func TestInitServers_SharesACMECertificates(t *testing.T) {
+	p := &Plugin{
+		log:     slog.New(slog.DiscardHandler),
+		servers: make([]servers.InternalServer[any], 0, 2),
+		cfg: &config.Config{
+			SSLConfig:   &https.SSL{Address: "127.0.0.1:8443", Acme: &acme.Config{CacheDir: t.TempDir(), Email: "a@b.c"}},
+			HTTP3Config: &http3.Config{Address: "127.0.0.1:8444"},
+		},
+	}
 
-	tests := []struct {
-		name string
-		cfg  *config.Config
-		want *acme.Config
-	}{
-		{"no ssl section", &config.Config{}, nil},
-		{"ssl section without acme", &config.Config{SSLConfig: &https.SSL{}}, nil},
-		{"ssl section with acme", &config.Config{SSLConfig: &https.SSL{Acme: acmeCfg}}, acmeCfg},
+	if err := p.initServers(); err != nil {
+		t.Fatal(err)
+	}
+	if p.certs == nil {
+		t.Fatal("the acme certificates were not issued")
 	}
+	t.Cleanup(func() { _ = p.certs.Close() })
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if got := nilOr(tt.cfg); got != tt.want {
-				t.Errorf("nilOr() = %v, want %v", got, tt.want)
+	stats := p.TLSStats()
+	if len(stats) != 2 {
+		t.Fatalf("tls stats = %d, want 2 (http3, https)", len(stats))
+	}
+
+	// every issuance has its own stats, the same pointer means the certificates were issued once
+	for _, s := range stats {
+		if s.ACME() != p.certs.Stats {
+			t.Error("the server does not use the shared acme certificates")
+		}
+	}
+
+	for _, srv := range p.servers {
+		switch s := srv.Server().(type) {
+		case *http.Server:
+			if s.TLSConfig.GetCertificate == nil {
+				t.Error("the https server does not get the acme certificates")
+			}
+		case *quicHTTP3.Server:
+			if s.TLSConfig.GetCertificate == nil {
+				t.Error("the http3 server does not get the acme certificates")
 			}
-		})
+		}
 	}
 }
 
 func TestInitServers_OneServerPerEnabledSection(t *testing.T) {
 	p := &Plugin{
-		log:                  slog.New(slog.DiscardHandler),
-		experimentalFeatures: true,
-		servers:              make([]servers.InternalServer[any], 0, 4),
+		log:     slog.New(slog.DiscardHandler),
+		servers: make([]servers.InternalServer[any], 0, 4),
 		cfg: &config.Config{
 			Address:     "127.0.0.1:8080",
 			SSLConfig:   &https.SSL{Address: "127.0.0.1:8443", Key: "server.key", Cert: "server.crt"},
@@ -66,7 +92,7 @@ func TestInitServers_OneServerPerEnabledSection(t *testing.T) {
 	}
 }
 
-func TestInitServers_HTTP3NeedsExperimentalMode(t *testing.T) {
+func TestInitServers_HTTP3WithoutExperimentalMode(t *testing.T) {
 	p := &Plugin{
 		log:     slog.New(slog.DiscardHandler),
 		servers: make([]servers.InternalServer[any], 0, 4),
@@ -79,8 +105,8 @@ func TestInitServers_HTTP3NeedsExperimentalMode(t *testing.T) {
 	if err := p.initServers(); err != nil {
 		t.Fatal(err)
 	}
-	if len(p.servers) != 1 {
-		t.Fatalf("servers = %d, want only the plain http server", len(p.servers))
+	if len(p.servers) != 2 {
+		t.Fatalf("servers = %d, want 2 (http3, http)", len(p.servers))
 	}
 }
 
@@ -113,3 +139,63 @@ func TestApplyBundledMiddleware_WrapsKnownServerTypes(t *testing.T) {
 		t.Error("the http3 server handler was not wrapped")
 	}
 }
+
+func TestApplyBundledMiddleware_AdvertisesHTTP3(t *testing.T) {
+	httpSrv := &http.Server{Handler: http.NotFoundHandler()} //nolint:gosec
+	http3Srv := &quicHTTP3.Server{Handler: http.NotFoundHandler()}
+
+	p := &Plugin{
+		log: slog.New(slog.DiscardHandler),
+		cfg: &config.Config{
+			MaxRequestSize: 1,
+			HTTP3Config:    &http3.Config{Address: "127.0.0.1:8444", AltSvcMaxAge: time.Hour},
+		},
+		servers: []servers.InternalServer[any]{
+			&stubInternalServer{inner: httpSrv},
+			&stubInternalServer{inner: http3Srv},
+		},
+	}
+
+	p.applyBundledMiddleware()
+
+	rec := httptest.NewRecorder()
+	httpSrv.Handler.ServeHTTP(rec, httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/", nil))
+	if got := rec.Header().Get("Alt-Svc"); got != `h3=":8444"; ma=3600` {
+		t.Errorf("http Alt-Svc = %q", got)
+	}
+
+	rec = httptest.NewRecorder()
+	http3Srv.Handler.ServeHTTP(rec, httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/", nil))
+	if got := rec.Header().Get("Alt-Svc"); got != "" {
+		t.Errorf("http3 Alt-Svc = %q, want none", got)
+	}
+}
+
+func TestApplyBundledMiddleware_Decompress(t *testing.T) {
+	var got string
+	httpSrv := &http.Server{Handler: http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) { //nolint:gosec
+		b, _ := io.ReadAll(r.Body)
+		got = string(b)
+	})}
+
+	p := &Plugin{
+		log:     slog.New(slog.DiscardHandler),
+		cfg:     &config.Config{MaxRequestSize: 1, Decompress: []string{config.EncodingGzip}},
+		servers: []servers.InternalServer[any]{&stubInternalServer{inner: httpSrv}},
+	}
+
+	p.applyBundledMiddleware()
+
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	_, _ = zw.Write([]byte("a=1"))
+	_ = zw.Close()
+
+	r := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/", &body)
+	r.Header.Set("Content-Encoding", "gzip")
+	httpSrv.Handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	if got != "a=1" {
+		t.Errorf("body = %q, want the decompressed body", got)
+	}
+}
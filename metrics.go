@@ -2,8 +2,12 @@ package http
 
 import (
 	"strconv"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/roadrunner-server/http/v6/acme"
+	http3Server "github.com/roadrunner-server/http/v6/servers/http3"
+	httpsServer "github.com/roadrunner-server/http/v6/servers/https"
 	"github.com/roadrunner-server/pool/v2/fsm"
 	"github.com/roadrunner-server/pool/v2/state/process"
 )
@@ -12,8 +16,51 @@ type Informer interface {
 	Workers() []*process.State
 }
 
+// TLSInformer provides TLS handshake counters and certificates of the running https and HTTP/3 servers.
+type TLSInformer interface {
+	TLSStats() []*httpsServer.Stats
+}
+
+// QUICInformer provides QUIC connection and stream counters of the running HTTP/3 servers.
+type QUICInformer interface {
+	QUICStats() []*http3Server.Stats
+}
+
 func (p *Plugin) MetricsCollector() []prometheus.Collector {
-	return []prometheus.Collector{p.statsExporter}
+	return []prometheus.Collector{p.statsExporter, p.tlsExporter, p.quicExporter}
+}
+
+// TLSStats returns handshake counters of the https and HTTP/3 servers
+func (p *Plugin) TLSStats() []*httpsServer.Stats {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	stats := make([]*httpsServer.Stats, 0, 2)
+	for _, srv := range p.servers {
+		switch s := srv.(type) {
+		case *httpsServer.Server:
+			stats = append(stats, s.Stats())
+		case *http3Server.Server:
+			stats = append(stats, s.TLSStats())
+		}
+	}
+
+	return stats
+}
+
+// QUICStats returns connection and stream counters of the HTTP/3 servers
+func (p *Plugin) QUICStats() []*http3Server.Stats {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	stats := make([]*http3Server.Stats, 0, 1)
+	for _, srv := range p.servers {
+		if s, ok := srv.(*http3Server.Server); ok {
+			stats = append(stats, s.Stats())
+		}
+	}
+
+	return stats
 }
 
 func newWorkersExporter(stats Informer) *StatsExporter {
@@ -93,3 +140,196 @@ func (s *StatsExporter) Collect(ch chan<- prometheus.Metric) {
 	ch <- prometheus.MustNewConstMetric(s.TotalWorkersDesc, prometheus.GaugeValue, float64(len(workerStates)))
 	ch <- prometheus.MustNewConstMetric(s.TotalMemoryDesc, prometheus.GaugeValue, cum)
 }
+
+func newTLSExporter(stats TLSInformer) *TLSExporter {
+	return &TLSExporter{
+		HandshakesDesc: prometheus.NewDesc("rr_http_tls_handshakes_total", "Total number of completed TLS handshakes", []string{"version", "cipher", "alpn"}, nil),
+		ResumedDesc:    prometheus.NewDesc("rr_http_tls_session_resumptions_total", "Total number of TLS handshakes resumed from a session ticket", nil, nil),
+		FailuresDesc:   prometheus.NewDesc("rr_http_tls_handshake_failures_total", "Total number of failed TLS handshakes", []string{"reason"}, nil),
+		CertExpiryDesc: prometheus.NewDesc("rr_http_tls_certificate_expiry_timestamp_seconds", "Expiration time of the server certificate", []string{"name", "source"}, nil),
+		ACMEDesc:       prometheus.NewDesc("rr_http_acme_certificates_total", "Total number of ACME certificate issuance attempts", []string{"operation", "result"}, nil),
+
+		Servers: stats,
+	}
+}
+
+// certKey identifies the certificate expiry series
+type certKey struct {
+	name   string
+	source string
+}
+
+type TLSExporter struct {
+	HandshakesDesc *prometheus.Desc
+	ResumedDesc    *prometheus.Desc
+	FailuresDesc   *prometheus.Desc
+	CertExpiryDesc *prometheus.Desc
+	ACMEDesc       *prometheus.Desc
+
+	Servers TLSInformer
+}
+
+func (t *TLSExporter) Describe(d chan<- *prometheus.Desc) {
+	d <- t.HandshakesDesc
+	d <- t.ResumedDesc
+	d <- t.FailuresDesc
+	d <- t.CertExpiryDesc
+	d <- t.ACMEDesc
+}
+
+func (t *TLSExporter) Collect(ch chan<- prometheus.Metric) {
+	var resumed float64
+	handshakes := make(map[httpsServer.Handshake]uint64)
+	failures := make(map[string]uint64)
+	outcomes := make(map[acme.Outcome]uint64)
+	// the https and HTTP/3 servers share the ACME certificates, the issuance is counted once
+	seen := make(map[*acme.Stats]struct{})
+	// the latest certificate of every name is the one in use
+	expiry := make(map[certKey]time.Time)
+
+	for _, st := range t.Servers.TLSStats() {
+		resumed += float64(st.Resumed.Load())
+
+		for hs, n := range st.HandshakesBy() {
+			handshakes[hs] += n
+		}
+
+		for reason, n := range st.Failures() {
+			failures[reason] += n
+		}
+
+		for _, cert := range st.Certificates() {
+			key := certKey{name: cert.Name, source: cert.Source}
+			if cert.NotAfter.After(expiry[key]) {
+				expiry[key] = cert.NotAfter
+			}
+		}
+
+		if as := st.ACME(); as != nil {
+			if _, ok := seen[as]; !ok {
+				seen[as] = struct{}{}
+				for o, n := range as.Outcomes() {
+					outcomes[o] += n
+				}
+			}
+		}
+	}
+
+	for hs, n := range handshakes {
+		ch <- prometheus.MustNewConstMetric(t.HandshakesDesc, prometheus.CounterValue, float64(n), hs.Version, hs.Cipher, hs.ALPN)
+	}
+
+	// resumption rate = resumptions / handshakes
+	ch <- prometheus.MustNewConstMetric(t.ResumedDesc, prometheus.CounterValue, resumed)
+
+	for reason, n := range failures {
+		ch <- prometheus.MustNewConstMetric(t.FailuresDesc, prometheus.CounterValue, float64(n), reason)
+	}
+
+	for key, notAfter := range expiry {
+		ch <- prometheus.MustNewConstMetric(t.CertExpiryDesc, prometheus.GaugeValue, float64(notAfter.Unix()), key.name, key.source)
+	}
+
+	for o, n := range outcomes {
+		ch <- prometheus.MustNewConstMetric(t.ACMEDesc, prometheus.CounterValue, float64(n), o.Operation, o.Result)
+	}
+}
+
+func newQUICExporter(stats QUICInformer) *QUICExporter {
+	return &QUICExporter{
+		ConnectionsDesc:       prometheus.NewDesc("rr_http_quic_connections_total", "Total number of accepted QUIC connections", nil, nil),
+		ActiveConnectionsDesc: prometheus.NewDesc("rr_http_quic_active_connections", "QUIC connections currently open", nil, nil),
+		StreamsDesc:           prometheus.NewDesc("rr_http_quic_streams_total", "Total number of HTTP/3 request streams", nil, nil),
+		ActiveStreamsDesc:     prometheus.NewDesc("rr_http_quic_active_streams", "HTTP/3 request streams currently in progress", nil, nil),
+		EarlyDataDesc:         prometheus.NewDesc("rr_http_quic_0rtt_requests_total", "Total number of requests received in 0-RTT data", []string{"result"}, nil),
+		RetriesDesc:           prometheus.NewDesc("rr_http_quic_retries_total", "Total number of connection attempts asked to validate the address with a Retry", nil, nil),
+		PacketsDesc:           prometheus.NewDesc("rr_http_quic_packets_total", "Total number of packets of the closed QUIC connections", []string{"direction"}, nil),
+		BytesDesc:             prometheus.NewDesc("rr_http_quic_bytes_total", "Total number of bytes of the closed QUIC connections", []string{"direction"}, nil),
+		RTTDesc:               prometheus.NewDesc("rr_http_quic_smoothed_rtt_seconds", "Smoothed RTT of the closed QUIC connections", nil, nil),
+
+		Servers: stats,
+	}
+}
+
+type QUICExporter struct {
+	ConnectionsDesc       *prometheus.Desc
+	ActiveConnectionsDesc *prometheus.Desc
+	StreamsDesc           *prometheus.Desc
+	ActiveStreamsDesc     *prometheus.Desc
+	EarlyDataDesc         *prometheus.Desc
+	RetriesDesc           *prometheus.Desc
+	PacketsDesc           *prometheus.Desc
+	BytesDesc             *prometheus.Desc
+	RTTDesc               *prometheus.Desc
+
+	Servers QUICInformer
+}
+
+func (q *QUICExporter) Describe(d chan<- *prometheus.Desc) {
+	d <- q.ConnectionsDesc
+	d <- q.ActiveConnectionsDesc
+	d <- q.StreamsDesc
+	d <- q.ActiveStreamsDesc
+	d <- q.EarlyDataDesc
+	d <- q.RetriesDesc
+	d <- q.PacketsDesc
+	d <- q.BytesDesc
+	d <- q.RTTDesc
+}
+
+func (q *QUICExporter) Collect(ch chan<- prometheus.Metric) {
+	stats := q.Servers.QUICStats()
+	// no HTTP/3 server, no series
+	if len(stats) == 0 {
+		return
+	}
+
+	var conns, activeConns, streams, activeStreams, earlyAccepted, earlyRejected, retries float64
+	var transfer http3Server.Transfer
+	var rttCount uint64
+	var rttSum float64
+	rttBuckets := make(map[float64]uint64, len(http3Server.RTTBuckets))
+
+	for _, st := range stats {
+		conns += float64(st.Connections.Load())
+		activeConns += float64(st.ActiveConnections.Load())
+		streams += float64(st.Streams.Load())
+		activeStreams += float64(st.ActiveStreams.Load())
+		earlyAccepted += float64(st.EarlyAccepted.Load())
+		earlyRejected += float64(st.EarlyRejected.Load())
+		retries += float64(st.Retries.Load())
+
+		tr := st.Transfer()
+		transfer.PacketsSent += tr.PacketsSent
+		transfer.PacketsReceived += tr.PacketsReceived
+		transfer.PacketsLost += tr.PacketsLost
+		transfer.BytesSent += tr.BytesSent
+		transfer.BytesReceived += tr.BytesReceived
+		transfer.BytesLost += tr.BytesLost
+
+		count, sum, buckets := st.RTT()
+		rttCount += count
+		rttSum += sum
+		for le, n := range buckets {
+			rttBuckets[le] += n
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(q.ConnectionsDesc, prometheus.CounterValue, conns)
+	ch <- prometheus.MustNewConstMetric(q.ActiveConnectionsDesc, prometheus.GaugeValue, activeConns)
+	ch <- prometheus.MustNewConstMetric(q.StreamsDesc, prometheus.CounterValue, streams)
+	ch <- prometheus.MustNewConstMetric(q.ActiveStreamsDesc, prometheus.GaugeValue, activeStreams)
+	ch <- prometheus.MustNewConstMetric(q.EarlyDataDesc, prometheus.CounterValue, earlyAccepted, "accepted")
+	ch <- prometheus.MustNewConstMetric(q.EarlyDataDesc, prometheus.CounterValue, earlyRejected, "rejected")
+	ch <- prometheus.MustNewConstMetric(q.RetriesDesc, prometheus.CounterValue, retries)
+
+	// loss rate = lost / sent
+	ch <- prometheus.MustNewConstMetric(q.PacketsDesc, prometheus.CounterValue, float64(transfer.PacketsSent), "sent")
+	ch <- prometheus.MustNewConstMetric(q.PacketsDesc, prometheus.CounterValue, float64(transfer.PacketsReceived), "received")
+	ch <- prometheus.MustNewConstMetric(q.PacketsDesc, prometheus.CounterValue, float64(transfer.PacketsLost), "lost")
+	ch <- prometheus.MustNewConstMetric(q.BytesDesc, prometheus.CounterValue, float64(transfer.BytesSent), "sent")
+	ch <- prometheus.MustNewConstMetric(q.BytesDesc, prometheus.CounterValue, float64(transfer.BytesReceived), "received")
+	ch <- prometheus.MustNewConstMetric(q.BytesDesc, prometheus.CounterValue, float64(transfer.BytesLost), "lost")
+
+	ch <- prometheus.MustNewConstHistogram(q.RTTDesc, rttCount, rttSum, rttBuckets)
+}
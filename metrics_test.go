@@ -1,11 +1,18 @@
 package http
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/quic-go/quic-go"
+	http3Server "github.com/roadrunner-server/http/v6/servers/http3"
+	httpsServer "github.com/roadrunner-server/http/v6/servers/https"
 	"github.com/roadrunner-server/pool/v2/fsm"
 	"github.com/roadrunner-server/pool/v2/state/process"
 	"github.com/stretchr/testify/assert"
@@ -104,9 +111,137 @@ rr_http_worker_state{pid="3",state="errored"} 0
 func TestPluginMetricsCollector(t *testing.T) {
 	p := &Plugin{}
 	p.statsExporter = newWorkersExporter(p)
+	p.tlsExporter = newTLSExporter(p)
+	p.quicExporter = newQUICExporter(p)
 
 	collectors := p.MetricsCollector()
 
-	require.Len(t, collectors, 1)
+	require.Len(t, collectors, 3)
 	assert.Same(t, p.statsExporter, collectors[0])
+	assert.Same(t, p.tlsExporter, collectors[1])
+	assert.Same(t, p.quicExporter, collectors[2])
+}
+
+// fakeTLSInformer serves fixed handshake counters to the exporter.
+type fakeTLSInformer struct{ stats []*httpsServer.Stats }
+
+func (f *fakeTLSInformer) TLSStats() []*httpsServer.Stats { return f.stats }
+
+func TestTLSExporterCollect(t *testing.T) {
+	h2 := &tls.ConnectionState{Version: tls.VersionTLS13, CipherSuite: tls.TLS_AES_128_GCM_SHA256, NegotiatedProtocol: "h2"}
+	h1 := &tls.ConnectionState{Version: tls.VersionTLS12, CipherSuite: tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, NegotiatedProtocol: "http/1.1", DidResume: true}
+
+	first, second := httpsServer.NewStats(), httpsServer.NewStats()
+	first.AddHandshake(h2)
+	first.AddHandshake(h2)
+	first.AddHandshake(h1)
+	second.AddHandshake(h2)
+	second.AddHandshake(h1)
+
+	first.AddFailure("client_certificate")
+	second.AddFailure("client_certificate")
+	second.AddFailure("timeout")
+
+	// both servers load a certificate for the same name, the latest one is reported
+	first.AddCertificate(&tls.Certificate{Leaf: &x509.Certificate{DNSNames: []string{"example.com"}, NotAfter: time.Unix(1800000000, 0)}})
+	second.AddCertificate(&tls.Certificate{Leaf: &x509.Certificate{DNSNames: []string{"example.com"}, NotAfter: time.Unix(1900000000, 0)}})
+	second.AddCertificate(&tls.Certificate{Leaf: &x509.Certificate{Subject: pkix.Name{CommonName: "internal"}, NotAfter: time.Unix(1700000000, 0)}})
+
+	exporter := newTLSExporter(&fakeTLSInformer{stats: []*httpsServer.Stats{first, second}})
+
+	expected := `
+# HELP rr_http_tls_certificate_expiry_timestamp_seconds Expiration time of the server certificate
+# TYPE rr_http_tls_certificate_expiry_timestamp_seconds gauge
+rr_http_tls_certificate_expiry_timestamp_seconds{name="example.com",source="file"} 1.9e+09
+rr_http_tls_certificate_expiry_timestamp_seconds{name="internal",source="file"} 1.7e+09
+# HELP rr_http_tls_handshake_failures_total Total number of failed TLS handshakes
+# TYPE rr_http_tls_handshake_failures_total counter
+rr_http_tls_handshake_failures_total{reason="client_certificate"} 2
+rr_http_tls_handshake_failures_total{reason="timeout"} 1
+# HELP rr_http_tls_handshakes_total Total number of completed TLS handshakes
+# TYPE rr_http_tls_handshakes_total counter
+rr_http_tls_handshakes_total{alpn="h2",cipher="TLS_AES_128_GCM_SHA256",version="TLS 1.3"} 3
+rr_http_tls_handshakes_total{alpn="http/1.1",cipher="TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",version="TLS 1.2"} 2
+# HELP rr_http_tls_session_resumptions_total Total number of TLS handshakes resumed from a session ticket
+# TYPE rr_http_tls_session_resumptions_total counter
+rr_http_tls_session_resumptions_total 2
+`
+
+	require.NoError(t, testutil.CollectAndCompare(exporter, strings.NewReader(expected)))
+}
+
+// fakeQUICInformer serves fixed QUIC counters to the exporter.
+type fakeQUICInformer struct{ stats []*http3Server.Stats }
+
+func (f *fakeQUICInformer) QUICStats() []*http3Server.Stats { return f.stats }
+
+func TestQUICExporterCollect(t *testing.T) {
+	assert.Equal(t, 0, testutil.CollectAndCount(newQUICExporter(&fakeQUICInformer{})))
+
+	st := http3Server.NewStats()
+	st.OpenConnection()
+	st.OpenConnection()
+	st.Streams.Add(5)
+	st.EarlyAccepted.Add(2)
+	st.EarlyRejected.Add(1)
+	st.Retries.Add(3)
+	st.CloseConnection(&quic.ConnectionStats{
+		SmoothedRTT:     40 * time.Millisecond,
+		PacketsSent:     100,
+		PacketsReceived: 80,
+		PacketsLost:     4,
+		BytesSent:       120000,
+		BytesReceived:   9000,
+		BytesLost:       4800,
+	})
+
+	exporter := newQUICExporter(&fakeQUICInformer{stats: []*http3Server.Stats{st}})
+
+	expected := `
+# HELP rr_http_quic_0rtt_requests_total Total number of requests received in 0-RTT data
+# TYPE rr_http_quic_0rtt_requests_total counter
+rr_http_quic_0rtt_requests_total{result="accepted"} 2
+rr_http_quic_0rtt_requests_total{result="rejected"} 1
+# HELP rr_http_quic_active_connections QUIC connections currently open
+# TYPE rr_http_quic_active_connections gauge
+rr_http_quic_active_connections 1
+# HELP rr_http_quic_active_streams HTTP/3 request streams currently in progress
+# TYPE rr_http_quic_active_streams gauge
+rr_http_quic_active_streams 0
+# HELP rr_http_quic_bytes_total Total number of bytes of the closed QUIC connections
+# TYPE rr_http_quic_bytes_total counter
+rr_http_quic_bytes_total{direction="lost"} 4800
+rr_http_quic_bytes_total{direction="received"} 9000
+rr_http_quic_bytes_total{direction="sent"} 120000
+# HELP rr_http_quic_connections_total Total number of accepted QUIC connections
+# TYPE rr_http_quic_connections_total counter
+rr_http_quic_connections_total 2
+# HELP rr_http_quic_packets_total Total number of packets of the closed QUIC connections
+# TYPE rr_http_quic_packets_total counter
+rr_http_quic_packets_total{direction="lost"} 4
+rr_http_quic_packets_total{direction="received"} 80
+rr_http_quic_packets_total{direction="sent"} 100
+# HELP rr_http_quic_retries_total Total number of connection attempts asked to validate the address with a Retry
+# TYPE rr_http_quic_retries_total counter
+rr_http_quic_retries_total 3
+# HELP rr_http_quic_smoothed_rtt_seconds Smoothed RTT of the closed QUIC connections
+# TYPE rr_http_quic_smoothed_rtt_seconds histogram
+rr_http_quic_smoothed_rtt_seconds_bucket{le="0.005"} 0
+rr_http_quic_smoothed_rtt_seconds_bucket{le="0.01"} 0
+rr_http_quic_smoothed_rtt_seconds_bucket{le="0.025"} 0
+rr_http_quic_smoothed_rtt_seconds_bucket{le="0.05"} 1
+rr_http_quic_smoothed_rtt_seconds_bucket{le="0.1"} 1
+rr_http_quic_smoothed_rtt_seconds_bucket{le="0.25"} 1
+rr_http_quic_smoothed_rtt_seconds_bucket{le="0.5"} 1
+rr_http_quic_smoothed_rtt_seconds_bucket{le="1"} 1
+rr_http_quic_smoothed_rtt_seconds_bucket{le="2.5"} 1
+rr_http_quic_smoothed_rtt_seconds_bucket{le="+Inf"} 1
+rr_http_quic_smoothed_rtt_seconds_sum 0.04
+rr_http_quic_smoothed_rtt_seconds_count 1
+# HELP rr_http_quic_streams_total Total number of HTTP/3 request streams
+# TYPE rr_http_quic_streams_total counter
+rr_http_quic_streams_total 5
+`
+
+	require.NoError(t, testutil.CollectAndCompare(exporter, strings.NewReader(expected)))
 }
@@ -0,0 +1,13 @@
+package middleware
+
+import (
+	"net/http"
+)
+
+// AltSvc advertises an alternative service (e.g. HTTP/3) on every response.
+func AltSvc(next http.Handler, value string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Alt-Svc", value)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,159 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// zstd window limit recommended for HTTP by RFC 8878, larger windows are rejected instead of allocated
+const zstdMaxWindow = 8 << 20
+
+// Decompress decodes the request bodies sent with the allowed Content-Encoding (gzip, deflate, br or zstd, stacked
+// encodings are decoded in reverse order) and strips the header, the other encodings are rejected with 415.
+// The encoded body is limited by maxReqSize, the decoded one - by MaxRequestSize applied after this middleware.
+func Decompress(next http.Handler, allow []string, maxReqSize uint64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encodings := contentEncodings(r.Header)
+		if len(encodings) == 0 || r.Body == nil || r.Body == http.NoBody {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		for _, enc := range encodings {
+			if !slices.Contains(allow, enc) {
+				// RFC 7694, the client could retry with the supported encoding
+				w.Header().Set("Accept-Encoding", strings.Join(allow, ", "))
+				http.Error(w, "unsupported content encoding: "+enc, http.StatusUnsupportedMediaType)
+				return
+			}
+		}
+
+		body := &decoded{
+			Reader:  http.MaxBytesReader(w, r.Body, int64(maxReqSize)), //nolint:gosec
+			closers: []io.Closer{r.Body},
+		}
+
+		for _, enc := range slices.Backward(encodings) {
+			err := body.decode(enc, maxReqSize)
+			if err != nil {
+				_ = body.Close()
+				http.Error(w, "malformed "+enc+" request body", http.StatusBadRequest)
+				return
+			}
+		}
+
+		r.Body = body
+		r.Header.Del("Content-Encoding")
+		r.Header.Del("Content-Length")
+		r.ContentLength = -1
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// contentEncodings returns the lowercase encodings applied to the body in order, identity is skipped.
+func contentEncodings(h http.Header) []string {
+	var encodings []string
+	for _, v := range h.Values("Content-Encoding") {
+		for enc := range strings.SplitSeq(v, ",") {
+			enc = strings.ToLower(strings.TrimSpace(enc))
+			if enc == "" || enc == "identity" {
+				continue
+			}
+
+			// RFC 9110, x-gzip is an alias
+			if enc == "x-gzip" {
+				enc = "gzip"
+			}
+
+			encodings = append(encodings, enc)
+		}
+	}
+
+	return encodings
+}
+
+// decoded reads the decoded body and closes the decoders together with the original body.
+type decoded struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (d *decoded) decode(enc string, maxReqSize uint64) error {
+	switch enc {
+	case "gzip":
+		zr, err := gzip.NewReader(d.Reader)
+		if err != nil {
+			return err
+		}
+
+		d.Reader = zr
+		d.closers = append(d.closers, zr)
+	case "deflate":
+		// the deflate encoding is zlib wrapped, but some clients send the raw deflate stream
+		br := bufio.NewReader(d.Reader)
+		if isZlib(br) {
+			zr, err := zlib.NewReader(br)
+			if err != nil {
+				return err
+			}
+
+			d.Reader = zr
+			d.closers = append(d.closers, zr)
+			return nil
+		}
+
+		fr := flate.NewReader(br)
+		d.Reader = fr
+		d.closers = append(d.closers, fr)
+	case "br":
+		d.Reader = brotli.NewReader(d.Reader)
+	case "zstd":
+		zr, err := zstd.NewReader(d.Reader,
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderLowmem(true),
+			zstd.WithDecoderMaxWindow(zstdMaxWindow),
+			zstd.WithDecoderMaxMemory(maxReqSize),
+		)
+		if err != nil {
+			return err
+		}
+
+		d.Reader = zr
+		d.closers = append(d.closers, zr.IOReadCloser())
+	default:
+		return http.ErrNotSupported
+	}
+
+	return nil
+}
+
+func (d *decoded) Close() error {
+	var err error
+	for _, c := range slices.Backward(d.closers) {
+		if errC := c.Close(); errC != nil && err == nil {
+			err = errC
+		}
+	}
+
+	return err
+}
+
+// isZlib checks the zlib header: the deflate method and the header checksum.
+func isZlib(br *bufio.Reader) bool {
+	h, err := br.Peek(2)
+	if err != nil {
+		return false
+	}
+
+	return h[0]&0x0f == 8 && (uint16(h[0])<<8|uint16(h[1]))%31 == 0
+}
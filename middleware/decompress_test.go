@@ -0,0 +1,162 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var allEncodings = []string{"gzip", "deflate", "br", "zstd"} //nolint:gochecknoglobals
+
+func encode(t *testing.T, enc string, data []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch enc {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "raw-deflate":
+		fw, err := flate.NewWriter(&buf, flate.DefaultCompression)
+		require.NoError(t, err)
+		w = fw
+	case "br":
+		w = brotli.NewWriter(&buf)
+	case "zstd":
+		zw, err := zstd.NewWriter(&buf)
+		require.NoError(t, err)
+		w = zw
+	default:
+		t.Fatalf("unknown encoding %s", enc)
+	}
+
+	_, err := w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	return buf.Bytes()
+}
+
+// echo replies with the body and the Content-Encoding the next handler got, the read error is replied with 413 or 400.
+func echo(t *testing.T) http.Handler {
+	t.Helper()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Content-Encoding", r.Header.Get("Content-Encoding"))
+
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			if _, ok := errors.AsType[*http.MaxBytesError](err); ok {
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+				return
+			}
+
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		_, _ = w.Write(b)
+	})
+}
+
+func decompressRequest(t *testing.T, h http.Handler, encoding string, body []byte) *httptest.ResponseRecorder {
+	t.Helper()
+
+	r := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/", bytes.NewReader(body))
+	r.Header.Set("Content-Encoding", encoding)
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, r)
+
+	return rr
+}
+
+func TestDecompress(t *testing.T) {
+	data := []byte(strings.Repeat("a=1&b=2&", 1000))
+	h := Decompress(echo(t), allEncodings, 1<<20)
+
+	for _, enc := range []string{"gzip", "deflate", "raw-deflate", "br", "zstd"} {
+		t.Run(enc, func(t *testing.T) {
+			header := strings.TrimPrefix(enc, "raw-")
+			rr := decompressRequest(t, h, header, encode(t, enc, data))
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, data, rr.Body.Bytes())
+			assert.Empty(t, rr.Header().Get("X-Content-Encoding"))
+		})
+	}
+}
+
+func TestDecompress_Stacked(t *testing.T) {
+	data := []byte("hello world")
+	h := Decompress(echo(t), allEncodings, 1<<20)
+
+	// gzip applied first, then br
+	rr := decompressRequest(t, h, "gzip, br", encode(t, "br", encode(t, "gzip", data)))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, data, rr.Body.Bytes())
+}
+
+func TestDecompress_NotAllowed(t *testing.T) {
+	h := Decompress(echo(t), []string{"gzip"}, 1<<20)
+
+	rr := decompressRequest(t, h, "br", encode(t, "br", []byte("hello")))
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, rr.Code)
+	assert.Equal(t, "gzip", rr.Header().Get("Accept-Encoding"))
+}
+
+func TestDecompress_Malformed(t *testing.T) {
+	h := Decompress(echo(t), allEncodings, 1<<20)
+
+	rr := decompressRequest(t, h, "gzip", []byte("not gzip"))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = decompressRequest(t, h, "zstd", []byte("not zstd at all"))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestDecompress_ZipBomb(t *testing.T) {
+	// 10 MB of zeros compress to a few KB
+	bomb := bytes.Repeat([]byte{0}, 10<<20)
+	h := Decompress(MaxRequestSize(echo(t), 1<<20), allEncodings, 1<<20)
+
+	for _, enc := range allEncodings {
+		t.Run(enc, func(t *testing.T) {
+			body := encode(t, enc, bomb)
+			require.Less(t, len(body), 1<<20)
+
+			rr := decompressRequest(t, h, enc, body)
+			assert.Contains(t, []int{http.StatusRequestEntityTooLarge, http.StatusBadRequest}, rr.Code)
+			assert.Less(t, rr.Body.Len(), 1<<20)
+		})
+	}
+}
+
+func TestDecompress_PassThrough(t *testing.T) {
+	h := Decompress(echo(t), allEncodings, 1<<20)
+
+	r := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/", strings.NewReader("plain"))
+	r.Header.Set("Content-Encoding", "identity")
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, r)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "plain", rr.Body.String())
+}
@@ -1,3 +1,3 @@
 // Package middleware provides built-in HTTP middleware for request size
-// limiting, HTTP-to-HTTPS redirection, and access logging.
+// limiting, request body decompression, HTTP-to-HTTPS redirection, and access logging.
 package middleware
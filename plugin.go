@@ -12,10 +12,12 @@ import (
 	rrcontext "github.com/roadrunner-server/context"
 	"github.com/roadrunner-server/endure/v2/dep"
 	"github.com/roadrunner-server/errors"
+	"github.com/roadrunner-server/http/v6/acme"
 	"github.com/roadrunner-server/http/v6/api"
 	"github.com/roadrunner-server/http/v6/config"
 	"github.com/roadrunner-server/http/v6/handler"
 	"github.com/roadrunner-server/http/v6/servers"
+	http3Server "github.com/roadrunner-server/http/v6/servers/http3"
 	"github.com/roadrunner-server/pool/v2/pool/static_pool"
 	"github.com/roadrunner-server/pool/v2/state/process"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
@@ -52,8 +54,7 @@ type Plugin struct {
 	server api.Server
 	log    *slog.Logger
 	// stdlog passed to the http/https/fcgi servers to log their internal messages
-	stdLog               *stdlog.Logger
-	experimentalFeatures bool
+	stdLog *stdlog.Logger
 
 	// http configuration
 	cfg *config.Config
@@ -66,8 +67,12 @@ type Plugin struct {
 	handler *handler.Handler
 	// metrics
 	statsExporter *StatsExporter
+	tlsExporter   *TLSExporter
+	quicExporter  *QUICExporter
 	// servers
 	servers []servers.InternalServer[any]
+	// ACME certificates shared by the https and http3 servers (nil without ACME)
+	certs *acme.Certificates
 }
 
 // Init must return configure svc and return true if svc hasStatus enabled. Must return error in case of
@@ -88,9 +93,6 @@ func (p *Plugin) Init(cfg api.Configurer, log api.Logger, srv api.Server) error
 		return errors.E(op, err)
 	}
 
-	// check if we have experimental features enabled
-	p.experimentalFeatures = cfg.Experimental()
-
 	// get permissions
 	p.cfg.UID = srv.UID()
 	p.cfg.GID = srv.GID()
@@ -106,8 +108,18 @@ func (p *Plugin) Init(cfg api.Configurer, log api.Logger, srv api.Server) error
 		return errors.E(op, errors.Disabled)
 	}
 
+	// the quic-go toggles live in the process environment, set once before any server starts
+	if p.cfg.EnableHTTP3() {
+		err = http3Server.SetProcessOptions(p.cfg.HTTP3Config)
+		if err != nil {
+			return errors.E(op, err)
+		}
+	}
+
 	// initialize statsExporter
 	p.statsExporter = newWorkersExporter(p)
+	p.tlsExporter = newTLSExporter(p)
+	p.quicExporter = newQUICExporter(p)
 	p.server = srv
 	p.servers = make([]servers.InternalServer[any], 0, 4)
 	p.prop = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}, jprop.Jaeger{})
@@ -177,6 +189,17 @@ func (p *Plugin) Stop(ctx context.Context) error {
 			}
 		}
 
+		if p.certs != nil {
+			err := p.certs.Close()
+			if err != nil {
+				p.log.Error("error closing the acme storage", "error", err)
+			}
+		}
+
+		if p.handler != nil {
+			p.handler.Stop()
+		}
+
 		if p.pool != nil {
 			switch pp := p.pool.(type) {
 			case *static_pool.Pool:
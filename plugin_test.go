@@ -126,9 +126,6 @@ func TestInit_PopulatesPluginState(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if !p.experimentalFeatures {
-		t.Error("experimentalFeatures is false")
-	}
 	if p.cfg.UID != 501 || p.cfg.GID != 20 {
 		t.Errorf("uid/gid = %d/%d, want 501/20", p.cfg.UID, p.cfg.GID)
 	}
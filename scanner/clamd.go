@@ -0,0 +1,126 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/roadrunner-server/errors"
+)
+
+const (
+	// chunkSize is the size of the INSTREAM chunks, must be below the clamd StreamMaxLength
+	chunkSize = 64 * 1024
+	// the clamd replies are short, a longer reply is a protocol error
+	maxReply = 4096
+)
+
+// Clamd scans the content with the clamd INSTREAM command.
+type Clamd struct {
+	network string
+	address string
+}
+
+// NewClamd creates the clamd scanner, the address is tcp://host:port or unix:///path/to/clamd.sock.
+func NewClamd(address string) (*Clamd, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "tcp":
+		if u.Host == "" {
+			return nil, errors.Errorf("clamd address has no host: %s", address)
+		}
+		return &Clamd{network: "tcp", address: u.Host}, nil
+	case "unix":
+		if u.Path == "" {
+			return nil, errors.Errorf("clamd address has no socket path: %s", address)
+		}
+		return &Clamd{network: "unix", address: u.Path}, nil
+	default:
+		return nil, errors.Errorf("clamd address should start with tcp:// or unix://, got: %s", address)
+	}
+}
+
+// Scan streams the content to clamd: the null-terminated zINSTREAM command, the chunks prefixed with
+// their 4-byte big-endian length and the zero-length chunk marking the end of the stream.
+func (c *Clamd) Scan(ctx context.Context, r io.Reader) (*Result, error) {
+	const op = errors.Op("clamd_scan")
+
+	conn, err := dial(ctx, c.network, c.address)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	w := bufio.NewWriterSize(conn, chunkSize+4)
+	_, err = w.WriteString("zINSTREAM\x00")
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	buf := make([]byte, chunkSize)
+	size := make([]byte, 4)
+	for {
+		n, rerr := io.ReadFull(r, buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n)) //nolint:gosec
+			_, _ = w.Write(size)
+			_, err = w.Write(buf[:n])
+			if err != nil {
+				// clamd closes the connection when the stream exceeds StreamMaxLength, the reply explains why
+				return c.reply(conn, op, err)
+			}
+		}
+
+		if rerr == io.EOF || rerr == io.ErrUnexpectedEOF {
+			break
+		}
+		if rerr != nil {
+			return nil, errors.E(op, rerr)
+		}
+	}
+
+	binary.BigEndian.PutUint32(size, 0)
+	_, _ = w.Write(size)
+	err = w.Flush()
+	if err != nil {
+		return c.reply(conn, op, err)
+	}
+
+	return c.reply(conn, op, nil)
+}
+
+// reply reads the null-terminated clamd reply: "stream: OK", "stream: <threat> FOUND" or "<message> ERROR".
+func (c *Clamd) reply(conn io.Reader, op errors.Op, writeErr error) (*Result, error) {
+	line, err := bufio.NewReader(io.LimitReader(conn, maxReply)).ReadBytes(0)
+	if err != nil && (err != io.EOF || len(line) == 0) {
+		if writeErr != nil {
+			return nil, errors.E(op, writeErr)
+		}
+		return nil, errors.E(op, err)
+	}
+
+	reply := strings.TrimSpace(string(bytes.TrimSuffix(line, []byte{0})))
+	reply = strings.TrimPrefix(reply, "stream: ")
+
+	switch {
+	case reply == "OK":
+		if writeErr != nil {
+			return nil, errors.E(op, writeErr)
+		}
+		return &Result{}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return &Result{Infected: true, Threat: strings.TrimSuffix(reply, " FOUND")}, nil
+	default:
+		return nil, errors.E(op, errors.Errorf("clamd: %s", reply))
+	}
+}
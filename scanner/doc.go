@@ -0,0 +1,3 @@
+// Package scanner streams the uploaded files to an external malware scanner:
+// a clamd daemon (INSTREAM) or an ICAP server (RESPMOD).
+package scanner
@@ -0,0 +1,149 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http/httputil"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/roadrunner-server/errors"
+)
+
+const (
+	icapDefaultPort = "1344"
+	// the encapsulated HTTP response header sent ahead of the file
+	icapResHdr = "HTTP/1.1 200 OK\r\nContent-Type: application/octet-stream\r\n\r\n"
+)
+
+// ICAP scans the content with the RESPMOD request to an ICAP (RFC 3507) service.
+type ICAP struct {
+	host string
+	uri  string
+}
+
+// NewICAP creates the ICAP scanner, the address is icap://host[:port]/service.
+func NewICAP(address string) (*ICAP, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "icap" || u.Host == "" {
+		return nil, errors.Errorf("icap address should be icap://host[:port]/service, got: %s", address)
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), icapDefaultPort)
+	}
+
+	return &ICAP{host: host, uri: "icap://" + host + u.EscapedPath()}, nil
+}
+
+// Scan sends the content as the chunked body of the encapsulated HTTP response. 204 No Content means the
+// content is clean, 200 OK with a modified response means the service blocked the content.
+func (i *ICAP) Scan(ctx context.Context, r io.Reader) (*Result, error) {
+	const op = errors.Op("icap_scan")
+
+	conn, err := dial(ctx, "tcp", i.host)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	w := bufio.NewWriter(conn)
+	_, _ = w.WriteString("RESPMOD " + i.uri + " ICAP/1.0\r\n")
+	_, _ = w.WriteString("Host: " + i.host + "\r\n")
+	_, _ = w.WriteString("Allow: 204\r\n")
+	_, _ = w.WriteString("Connection: close\r\n")
+	_, _ = w.WriteString("Encapsulated: res-hdr=0, res-body=" + strconv.Itoa(len(icapResHdr)) + "\r\n\r\n")
+	_, _ = w.WriteString(icapResHdr)
+
+	cw := httputil.NewChunkedWriter(w)
+	_, err = io.Copy(cw, r)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	// the last chunk, the chunked writer does not write the final CRLF
+	_ = cw.Close()
+	_, _ = w.WriteString("\r\n")
+	err = w.Flush()
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	res, err := i.response(bufio.NewReader(conn))
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	return res, nil
+}
+
+func (i *ICAP) response(br *bufio.Reader) (*Result, error) {
+	tp := textproto.NewReader(br)
+	line, err := tp.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+
+	proto, status, _ := strings.Cut(line, " ")
+	if !strings.HasPrefix(proto, "ICAP/") {
+		return nil, errors.Errorf("malformed icap status line: %s", line)
+	}
+	code, _, _ := strings.Cut(status, " ")
+
+	header, err := tp.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	switch code {
+	case "204":
+		return &Result{}, nil
+	case "200":
+	default:
+		return nil, errors.Errorf("icap: %s", status)
+	}
+
+	threat := threatName(header)
+	if threat != "" {
+		return &Result{Infected: true, Threat: threat}, nil
+	}
+
+	// no threat headers, the service replaced the response (e.g. with a 403 page) or returned it unmodified
+	if !strings.Contains(header.Get("Encapsulated"), "res-hdr") {
+		return &Result{}, nil
+	}
+
+	line, err = tp.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+	_, status, _ = strings.Cut(line, " ")
+	if strings.HasPrefix(status, "200") {
+		return &Result{}, nil
+	}
+
+	return &Result{Infected: true, Threat: "unknown"}, nil
+}
+
+// threatName returns the threat from the X-Infection-Found (Type=0; Resolution=2; Threat=name;)
+// or X-Virus-ID headers.
+func threatName(header textproto.MIMEHeader) string {
+	for field := range strings.SplitSeq(header.Get("X-Infection-Found"), ";") {
+		k, v, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if ok && strings.EqualFold(k, "Threat") && v != "" {
+			return v
+		}
+	}
+
+	return strings.TrimSpace(header.Get("X-Virus-ID"))
+}
@@ -0,0 +1,80 @@
+package scanner
+
+import (
+	"context"
+	"io"
+	"net"
+	"time"
+
+	"github.com/roadrunner-server/errors"
+	"github.com/roadrunner-server/http/v6/config"
+)
+
+// Result of a single scan.
+type Result struct {
+	// Infected is true when the scanner found a threat.
+	Infected bool
+	// Threat is the name of the threat reported by the scanner, e.g. Eicar-Signature.
+	Threat string
+}
+
+// Scanner checks the content for malware. The returned error means the content was not scanned.
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (*Result, error)
+}
+
+// New creates the scanner configured by the uploads.scan section.
+func New(cfg *config.UploadScan) (Scanner, error) {
+	const op = errors.Op("scanner_new")
+
+	switch cfg.Driver {
+	case config.ScanDriverClamd:
+		c, err := NewClamd(cfg.Address)
+		if err != nil {
+			return nil, errors.E(op, err)
+		}
+		return c, nil
+	case config.ScanDriverICAP:
+		c, err := NewICAP(cfg.Address)
+		if err != nil {
+			return nil, errors.E(op, err)
+		}
+		return c, nil
+	default:
+		return nil, errors.E(op, errors.Errorf("unknown upload scan driver: %s", cfg.Driver))
+	}
+}
+
+// dial connects to the scanner, the connection deadline follows the context deadline.
+func dial(ctx context.Context, network, address string) (net.Conn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		err = conn.SetDeadline(deadline)
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+
+	// unblock the reads and writes when the context is canceled without a deadline
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Unix(1, 0))
+	})
+
+	return &ctxConn{Conn: conn, stop: stop}, nil
+}
+
+type ctxConn struct {
+	net.Conn
+	stop func() bool
+}
+
+func (c *ctxConn) Close() error {
+	c.stop()
+	return c.Conn.Close()
+}
@@ -0,0 +1,285 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http/httputil"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/roadrunner-server/http/v6/config"
+)
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// serve runs the handler for every connection accepted by the listener.
+func serve(t *testing.T, ln net.Listener, handle func(conn net.Conn)) {
+	t.Helper()
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				handle(conn)
+			}()
+		}
+	}()
+}
+
+// fakeClamd reads the INSTREAM chunks and replies FOUND for the EICAR test string.
+func fakeClamd(t *testing.T, network string) string {
+	t.Helper()
+
+	address := "127.0.0.1:0"
+	if network == "unix" {
+		address = filepath.Join(t.TempDir(), "clamd.sock")
+	}
+
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve(t, ln, func(conn net.Conn) {
+		br := bufio.NewReader(conn)
+		cmd, err := br.ReadString(0)
+		if err != nil || cmd != "zINSTREAM\x00" {
+			_, _ = conn.Write([]byte("UNKNOWN COMMAND\x00"))
+			return
+		}
+
+		var data bytes.Buffer
+		size := make([]byte, 4)
+		for {
+			if _, err = io.ReadFull(br, size); err != nil {
+				return
+			}
+			n := binary.BigEndian.Uint32(size)
+			if n == 0 {
+				break
+			}
+			if _, err = io.CopyN(&data, br, int64(n)); err != nil {
+				return
+			}
+		}
+
+		reply := "stream: OK\x00"
+		if strings.Contains(data.String(), eicar) {
+			reply = "stream: Eicar-Signature FOUND\x00"
+		}
+		_, _ = conn.Write([]byte(reply))
+	})
+
+	if network == "unix" {
+		return "unix://" + address
+	}
+
+	return "tcp://" + ln.Addr().String()
+}
+
+// fakeICAP reads the RESPMOD request and replies 204 for the clean content and the given response otherwise.
+func fakeICAP(t *testing.T, infected string) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve(t, ln, func(conn net.Conn) {
+		br := bufio.NewReader(conn)
+		tp := textproto.NewReader(br)
+		line, err := tp.ReadLine()
+		if err != nil || !strings.HasPrefix(line, "RESPMOD icap://") {
+			_, _ = conn.Write([]byte("ICAP/1.0 400 Bad Request\r\n\r\n"))
+			return
+		}
+		if _, err = tp.ReadMIMEHeader(); err != nil {
+			return
+		}
+		// the encapsulated response header
+		if _, err = tp.ReadLine(); err != nil {
+			return
+		}
+		if _, err = tp.ReadMIMEHeader(); err != nil {
+			return
+		}
+
+		body, err := io.ReadAll(httputil.NewChunkedReader(br))
+		if err != nil {
+			_, _ = conn.Write([]byte("ICAP/1.0 400 Bad Request\r\n\r\n"))
+			return
+		}
+
+		if !strings.Contains(string(body), eicar) {
+			_, _ = conn.Write([]byte("ICAP/1.0 204 No Content\r\n\r\n"))
+			return
+		}
+		_, _ = conn.Write([]byte(infected))
+	})
+
+	return "icap://" + ln.Addr().String() + "/avscan"
+}
+
+func scan(t *testing.T, s Scanner, content string) *Result {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(t.Context(), time.Second*5)
+	defer cancel()
+
+	res, err := s.Scan(ctx, strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return res
+}
+
+func TestClamd(t *testing.T) {
+	for _, network := range []string{"tcp", "unix"} {
+		t.Run(network, func(t *testing.T) {
+			s, err := New(&config.UploadScan{Driver: config.ScanDriverClamd, Address: fakeClamd(t, network)})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// larger than a single chunk
+			if res := scan(t, s, strings.Repeat("x", chunkSize*2+1)); res.Infected {
+				t.Errorf("clean content reported as %q", res.Threat)
+			}
+
+			res := scan(t, s, strings.Repeat("x", chunkSize-10)+eicar)
+			if !res.Infected || res.Threat != "Eicar-Signature" {
+				t.Errorf("result = %+v, want Eicar-Signature", res)
+			}
+		})
+	}
+}
+
+func TestClamd_Error(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serve(t, ln, func(conn net.Conn) {
+		_, _ = io.Copy(io.Discard, io.LimitReader(conn, 14))
+		_, _ = conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+	})
+
+	s, err := NewClamd("tcp://" + ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.Scan(t.Context(), strings.NewReader("data"))
+	if err == nil || !strings.Contains(err.Error(), "size limit exceeded") {
+		t.Errorf("error = %v, want the clamd error", err)
+	}
+}
+
+func TestICAP(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		threat   string
+	}{
+		{
+			name:     "X-Infection-Found",
+			response: "ICAP/1.0 200 OK\r\nX-Infection-Found: Type=0; Resolution=2; Threat=Eicar-Test-Signature;\r\nEncapsulated: null-body=0\r\n\r\n",
+			threat:   "Eicar-Test-Signature",
+		},
+		{
+			name:     "X-Virus-ID",
+			response: "ICAP/1.0 200 OK\r\nX-Virus-ID: EICAR\r\nEncapsulated: null-body=0\r\n\r\n",
+			threat:   "EICAR",
+		},
+		{
+			name:     "blocked page",
+			response: "ICAP/1.0 200 OK\r\nEncapsulated: res-hdr=0, null-body=19\r\n\r\nHTTP/1.1 403 Forbidden\r\n\r\n",
+			threat:   "unknown",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := New(&config.UploadScan{Driver: config.ScanDriverICAP, Address: fakeICAP(t, tt.response)})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if res := scan(t, s, "hello"); res.Infected {
+				t.Errorf("clean content reported as %q", res.Threat)
+			}
+
+			res := scan(t, s, eicar)
+			if !res.Infected || res.Threat != tt.threat {
+				t.Errorf("result = %+v, want %s", res, tt.threat)
+			}
+		})
+	}
+}
+
+func TestICAP_Error(t *testing.T) {
+	s, err := NewICAP(fakeICAP(t, "ICAP/1.0 500 Server Error\r\n\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = s.Scan(t.Context(), strings.NewReader(eicar)); err == nil {
+		t.Error("expected an error for the 500 status")
+	}
+}
+
+func TestScan_Timeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// never replies
+	serve(t, ln, func(conn net.Conn) {
+		_, _ = io.Copy(io.Discard, conn)
+	})
+
+	s, err := NewClamd("tcp://" + ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), time.Millisecond*100)
+	defer cancel()
+
+	start := time.Now()
+	if _, err = s.Scan(ctx, strings.NewReader("data")); err == nil {
+		t.Fatal("expected a timeout error")
+	}
+	if time.Since(start) > time.Second*2 {
+		t.Errorf("scan took %s, want it to stop at the deadline", time.Since(start))
+	}
+}
+
+func TestNew_InvalidAddress(t *testing.T) {
+	tests := []*config.UploadScan{
+		{Driver: config.ScanDriverClamd, Address: "127.0.0.1:3310"},
+		{Driver: config.ScanDriverClamd, Address: "unix://"},
+		{Driver: config.ScanDriverICAP, Address: "http://127.0.0.1/avscan"},
+		{Driver: "sophos", Address: "tcp://127.0.0.1:3310"},
+	}
+
+	for _, cfg := range tests {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("%s %s: expected an error", cfg.Driver, cfg.Address)
+		}
+	}
+}
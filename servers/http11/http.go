@@ -16,6 +16,7 @@ import (
 	"github.com/roadrunner-server/errors"
 	"github.com/roadrunner-server/http/v6/config"
 	"github.com/roadrunner-server/http/v6/middleware"
+	"github.com/roadrunner-server/http/v6/servers/https"
 )
 
 type Server struct {
@@ -39,21 +40,24 @@ func NewHTTPServer(handler http.Handler, cfg *config.Config, errLog *log.Logger,
 		protocols := new(http.Protocols)
 		protocols.SetHTTP1(true)
 		protocols.SetUnencryptedHTTP2(true)
+		srv := &http.Server{
+			Handler:           handler,
+			Protocols:         protocols,
+			HTTP2:             cfg.HTTP2Config.NetHTTPConfig(),
+			ReadTimeout:       time.Minute * 5,
+			WriteTimeout:      time.Minute * 5,
+			IdleTimeout:       time.Hour,
+			ReadHeaderTimeout: time.Minute * 5,
+			ErrorLog:          errLog,
+		}
+		https.GuardStreams(srv, cfg.HTTP2Config, log)
+
 		return &Server{
 			log:          log,
 			redirect:     redirect,
 			redirectPort: redirectPort,
 			address:      cfg.Address,
-			http: &http.Server{
-				Handler:           handler,
-				Protocols:         protocols,
-				HTTP2:             &http.HTTP2Config{MaxConcurrentStreams: int(cfg.HTTP2Config.MaxConcurrentStreams)},
-				ReadTimeout:       time.Minute * 5,
-				WriteTimeout:      time.Minute * 5,
-				IdleTimeout:       time.Hour,
-				ReadHeaderTimeout: time.Minute * 5,
-				ErrorLog:          errLog,
-			},
+			http:         srv,
 		}
 	}
 	return &Server{
@@ -1,10 +1,199 @@
 package http3
 
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/roadrunner-server/errors"
+	"github.com/roadrunner-server/http/v6/servers/https"
+	"github.com/roadrunner-server/http/v6/tlsconf"
+)
+
 type Config struct {
-	// Address is the address to listen on.
+	// Address is the UDP address to listen on, defaults to the https server address.
 	Address string `mapstructure:"address"`
 	// Key defined private server key.
 	Key string `mapstructure:"key"`
 	// Cert is https certificate.
 	Cert string `mapstructure:"cert"`
+	// Root CA file to verify the client certificates
+	RootCA string `mapstructure:"root_ca"`
+	// mTLS auth
+	AuthType https.ClientAuthType `mapstructure:"client_auth_type"`
+	// TLS versions, cipher suites, curves and ALPN
+	tlsconf.Policy `mapstructure:",squash"`
+	// AltSvcMaxAge is the max-age of the Alt-Svc header advertising HTTP/3 on the http and https responses, defaults to 24h.
+	AltSvcMaxAge time.Duration `mapstructure:"alt_svc_max_age"`
+
+	// QUIC transport settings, zero values keep the quic-go defaults.
+
+	// MaxIdleTimeout closes the connection after this period without network activity.
+	MaxIdleTimeout time.Duration `mapstructure:"max_idle_timeout"`
+	// KeepAlivePeriod sends keep-alive packets to keep the idle connection (and the NAT bindings) open.
+	KeepAlivePeriod time.Duration `mapstructure:"keep_alive_period"`
+	// MaxIncomingStreams is the maximum number of concurrent request streams per connection.
+	MaxIncomingStreams int64 `mapstructure:"max_incoming_streams"`
+	// InitialStreamReceiveWindow is the initial flow control window of a stream, in bytes.
+	InitialStreamReceiveWindow uint64 `mapstructure:"initial_stream_receive_window"`
+	// MaxStreamReceiveWindow is the maximum the stream flow control window grows to, in bytes.
+	MaxStreamReceiveWindow uint64 `mapstructure:"max_stream_receive_window"`
+	// InitialConnectionReceiveWindow is the initial flow control window of a connection, in bytes.
+	InitialConnectionReceiveWindow uint64 `mapstructure:"initial_connection_receive_window"`
+	// MaxConnectionReceiveWindow is the maximum the connection flow control window grows to, in bytes.
+	MaxConnectionReceiveWindow uint64 `mapstructure:"max_connection_receive_window"`
+	// Allow0RTT accepts requests in the 0-RTT data of resumed connections. 0-RTT data could be replayed,
+	// so only the safe methods (GET, HEAD, OPTIONS, TRACE) are served, others get 425 Too Early.
+	Allow0RTT bool `mapstructure:"allow_0rtt"`
+	// AddressValidation defines when the client address is validated with a Retry: off (default), always,
+	// or auto, when the new connection attempts per second exceed AddressValidationThreshold.
+	AddressValidation string `mapstructure:"address_validation"`
+	// AddressValidationThreshold is the connection attempts per second starting the Retry in the auto mode, defaults to 100.
+	AddressValidationThreshold int `mapstructure:"address_validation_threshold"`
+
+	// ShutdownTimeout is the time given to the in-flight requests after GOAWAY on stop, defaults to 5s.
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+
+	// UDP socket settings
+
+	// ReadBufferSize is the receive buffer of the UDP socket in bytes, quic-go raises it to 7MB when the OS allows.
+	ReadBufferSize int `mapstructure:"read_buffer_size"`
+	// WriteBufferSize is the send buffer of the UDP socket in bytes, quic-go raises it to 7MB when the OS allows.
+	WriteBufferSize int `mapstructure:"write_buffer_size"`
+	// DisableGSO turns off the generic segmentation offload (Linux), e.g. for the NICs failing with GSO.
+	// Process-wide, see SetProcessOptions.
+	DisableGSO bool `mapstructure:"disable_gso"`
+	// DisableECN turns off the explicit congestion notification. Process-wide, see SetProcessOptions.
+	DisableECN bool `mapstructure:"disable_ecn"`
+}
+
+func (c *Config) InitDefaults() {
+	if c.AltSvcMaxAge == 0 {
+		c.AltSvcMaxAge = 24 * time.Hour
+	}
+
+	if c.AddressValidation == "" {
+		c.AddressValidation = AddressValidationOff
+	}
+
+	if c.AddressValidationThreshold == 0 {
+		c.AddressValidationThreshold = 100
+	}
+
+	if c.ShutdownTimeout == 0 {
+		c.ShutdownTimeout = 5 * time.Second
+	}
+}
+
+// InheritSSL fills the address, certificate, client authentication and TLS policy settings missing in the HTTP/3
+// configuration from the https server, so both listeners share one TLS setup.
+func (c *Config) InheritSSL(ssl *https.SSL) {
+	// QUIC runs over UDP, so the https port is free for it
+	if c.Address == "" {
+		c.Address = ssl.Address
+	}
+
+	if c.Key == "" && c.Cert == "" {
+		c.Key = ssl.Key
+		c.Cert = ssl.Cert
+	}
+
+	if c.RootCA == "" {
+		c.RootCA = ssl.RootCA
+		if c.AuthType == "" {
+			c.AuthType = ssl.AuthType
+		}
+	}
+
+	if c.MinVersion == "" {
+		c.MinVersion = ssl.MinVersion
+	}
+
+	// QUIC runs only over TLS 1.3, a 1.2 ceiling applies to the https server only
+	if c.MaxVersion == "" && ssl.MaxVersion != "1.2" {
+		c.MaxVersion = ssl.MaxVersion
+	}
+
+	if len(c.CurvePreferences) == 0 {
+		c.CurvePreferences = slices.Clone(ssl.CurvePreferences)
+	}
+}
+
+// AltSvc returns the Alt-Svc header value advertising the HTTP/3 listener, empty if the address has no port.
+func (c *Config) AltSvc() string {
+	_, portStr, err := net.SplitHostPort(c.Address)
+	if err != nil {
+		return ""
+	}
+
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil || port == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf(`h3=":%d"; ma=%d`, port, int64(c.AltSvcMaxAge/time.Second))
+}
+
+// Valid validates the HTTP/3 configuration. QUIC always runs over TLS 1.3.
+func (c *Config) Valid() error {
+	const op = errors.Op("http3_config_valid")
+
+	if c.MaxVersion == "1.2" {
+		return errors.E(op, errors.Str("http3 requires TLS 1.3, max_version could not be 1.2"))
+	}
+
+	if len(c.CipherSuites) > 0 {
+		return errors.E(op, errors.Str("cipher_suites are not configurable for http3, TLS 1.3 suites are selected automatically"))
+	}
+
+	if slices.ContainsFunc(c.ALPN, func(proto string) bool { return proto != "h3" }) {
+		return errors.E(op, errors.Str("http3 negotiates only the h3 protocol, alpn could contain only h3"))
+	}
+
+	err := c.Policy.Valid()
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	if c.MaxIdleTimeout < 0 || c.KeepAlivePeriod < 0 {
+		return errors.E(op, errors.Str("max_idle_timeout and keep_alive_period could not be negative"))
+	}
+
+	if c.KeepAlivePeriod > 0 && c.MaxIdleTimeout > 0 && c.KeepAlivePeriod >= c.MaxIdleTimeout {
+		return errors.E(op, errors.Str("keep_alive_period should be less than max_idle_timeout"))
+	}
+
+	if c.MaxIncomingStreams < 0 {
+		return errors.E(op, errors.Str("max_incoming_streams could not be negative"))
+	}
+
+	if c.MaxStreamReceiveWindow > 0 && c.InitialStreamReceiveWindow > c.MaxStreamReceiveWindow {
+		return errors.E(op, errors.Str("initial_stream_receive_window is greater than max_stream_receive_window"))
+	}
+
+	if c.MaxConnectionReceiveWindow > 0 && c.InitialConnectionReceiveWindow > c.MaxConnectionReceiveWindow {
+		return errors.E(op, errors.Str("initial_connection_receive_window is greater than max_connection_receive_window"))
+	}
+
+	switch c.AddressValidation {
+	case "", AddressValidationOff, AddressValidationAlways, AddressValidationAuto:
+	default:
+		return errors.E(op, errors.Errorf("unknown address_validation '%s', supported: off, always, auto", c.AddressValidation))
+	}
+
+	if c.AddressValidationThreshold < 0 {
+		return errors.E(op, errors.Str("address_validation_threshold could not be negative"))
+	}
+
+	if c.ShutdownTimeout < 0 {
+		return errors.E(op, errors.Str("shutdown_timeout could not be negative"))
+	}
+
+	if c.ReadBufferSize < 0 || c.WriteBufferSize < 0 {
+		return errors.E(op, errors.Str("read_buffer_size and write_buffer_size could not be negative"))
+	}
+
+	return nil
 }
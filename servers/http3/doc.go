@@ -1,3 +1,3 @@
-// Package http3 implements an experimental HTTP/3 server using QUIC with
+// Package http3 implements an HTTP/3 server using QUIC with
 // TLS and optional ACME certificate support.
 package http3
@@ -1,15 +1,21 @@
 package http3
 
 import (
+	"context"
+	"crypto/tls"
+	stderr "errors"
 	"log/slog"
+	"net"
 	"net/http"
 	"slices"
+	"sync"
+	"time"
 
 	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/http3"
 	"github.com/roadrunner-server/errors"
 	"github.com/roadrunner-server/http/v6/acme"
-	"github.com/roadrunner-server/http/v6/tlsconf"
+	"github.com/roadrunner-server/http/v6/servers/https"
 
 	"github.com/roadrunner-server/http/v6/api"
 	"github.com/roadrunner-server/http/v6/servers"
@@ -21,40 +27,63 @@ type Server struct {
 	server *http3.Server
 	log    *slog.Logger
 	cfg    *Config
+	stats  *Stats
+	// handshakes, certificates and ACME issuance, the same metrics as the https server
+	tls *https.Stats
+
+	mu sync.Mutex
+	// transport owns the UDP socket, created in Serve
+	transport *quic.Transport
 }
 
-func NewHTTP3server(handler http.Handler, acmeCfg *acme.Config, cfg *Config, log *slog.Logger) (servers.InternalServer[any], error) {
+// NewHTTP3server creates the http3 server, certs are the ACME certificates shared with the https server (nil without ACME).
+func NewHTTP3server(handler http.Handler, certs *acme.Certificates, cfg *Config, log *slog.Logger) (servers.InternalServer[any], error) {
+	tlsCfg, err := cfg.Policy.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	stats := NewStats()
 	http3Srv := &Server{
-		log: log,
-		cfg: cfg,
+		log:   log,
+		cfg:   cfg,
+		stats: stats,
+		tls:   https.NewStats(),
 		server: &http3.Server{
 			Addr:       cfg.Address,
 			Handler:    handler,
-			QUICConfig: &quic.Config{},
-			TLSConfig:  tlsconf.DefaultTLSConfig(),
+			QUICConfig: quicConfig(cfg),
+			TLSConfig:  tlsCfg,
+			ConnContext: func(ctx context.Context, c *quic.Conn) context.Context {
+				stats.OpenConnection()
+				go func() {
+					<-c.Context().Done()
+					cs := c.ConnectionStats()
+					stats.CloseConnection(&cs)
+				}()
+
+				return ctx
+			},
 		},
 	}
 
-	if acmeCfg != nil {
-		tlsCfg, err := acme.IssueCertificates(
-			acmeCfg.CacheDir,
-			acmeCfg.Email,
-			acmeCfg.ChallengeType,
-			acmeCfg.Domains,
-			acmeCfg.UseProductionEndpoint,
-			acmeCfg.AltHTTPPort,
-			acmeCfg.AltTLSALPNPort,
-			log,
-		)
-
+	if cfg.RootCA != "" {
+		err = https.ApplyClientAuth(http3Srv.server.TLSConfig, cfg.RootCA, cfg.AuthType)
 		if err != nil {
 			return nil, err
 		}
+	}
 
-		http3Srv.server.TLSConfig.GetCertificate = tlsCfg.GetCertificate
+	if certs != nil {
+		http3Srv.tls.SetACME(certs.Stats)
+
+		http3Srv.server.TLSConfig.GetCertificate = certs.TLSConfig.GetCertificate
 		http3Srv.server.TLSConfig.NextProtos = append(http3Srv.server.TLSConfig.NextProtos, ACMETLS1Protocol)
 	}
 
+	// quic-go does not report the failed handshakes, only the completed ones are counted
+	https.CountHandshakes(http3Srv.server.TLSConfig, http3Srv.tls)
+
 	return http3Srv, nil
 }
 
@@ -65,24 +94,97 @@ func (s *Server) Serve(mdwr map[string]api.Middleware, order []string) error {
 		applyMiddleware(s.server, mdwr, order, s.log)
 	}
 
-	s.log.Debug("http3 server was started", "address", s.server.Addr)
-	err := s.server.ListenAndServeTLS(s.cfg.Cert, s.cfg.Key)
+	// the configured cert/key pair is served next to the ACME certificates from GetCertificate
+	if s.cfg.Cert != "" || s.cfg.Key != "" {
+		cert, err := tls.LoadX509KeyPair(s.cfg.Cert, s.cfg.Key)
+		if err != nil {
+			return errors.E(op, err)
+		}
+
+		s.server.TLSConfig.Certificates = append(s.server.TLSConfig.Certificates, cert)
+		s.tls.AddCertificate(&cert)
+	}
+
+	if s.cfg.Allow0RTT {
+		s.server.Handler = earlyData(s.server.Handler, s.stats)
+	}
+	s.server.Handler = countStreams(s.server.Handler, s.stats)
+
+	udpAddr, err := net.ResolveUDPAddr("udp", s.cfg.Address)
 	if err != nil {
 		return errors.E(op, err)
 	}
 
+	conn, err := listenUDP(udpAddr, s.cfg)
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	validator := &addressValidator{
+		mode:      s.cfg.AddressValidation,
+		threshold: s.cfg.AddressValidationThreshold,
+		stats:     s.stats,
+		now:       time.Now,
+	}
+
+	tr := &quic.Transport{Conn: conn}
+	if validator.mode != "" && validator.mode != AddressValidationOff {
+		tr.VerifySourceAddress = validator.verify
+	}
+
+	ln, err := tr.ListenEarly(http3.ConfigureTLSConfig(s.server.TLSConfig), s.server.QUICConfig)
+	if err != nil {
+		_ = conn.Close()
+		return errors.E(op, err)
+	}
+
+	s.mu.Lock()
+	s.transport = tr
+	s.mu.Unlock()
+
+	s.log.Debug("http3 server was started", "address", s.server.Addr)
+	err = s.server.ServeListener(ln)
+	if err != nil && !stderr.Is(err, http.ErrServerClosed) {
+		return errors.E(op, err)
+	}
+
 	return nil
 }
 
+// Stats returns the QUIC connection and stream counters.
+func (s *Server) Stats() *Stats {
+	return s.stats
+}
+
+// TLSStats returns the TLS handshake counters and the certificates of the HTTP/3 server.
+func (s *Server) TLSStats() *https.Stats {
+	return s.tls
+}
+
 func (s *Server) Server() any {
 	return s.server
 }
 
+// Stop sends GOAWAY and waits for the in-flight requests up to the shutdown timeout, then closes the connections.
 func (s *Server) Stop() {
-	err := s.server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
+	defer cancel()
+
+	err := s.server.Shutdown(ctx)
 	if err != nil {
 		s.log.Error("http3 server shutdown", "error", err)
 	}
+
+	s.mu.Lock()
+	tr := s.transport
+	s.transport = nil
+	s.mu.Unlock()
+
+	// the server does not close the listeners it did not create
+	if tr != nil {
+		_ = tr.Close()
+		_ = tr.Conn.Close()
+	}
 }
 
 func applyMiddleware(server *http3.Server, middleware map[string]api.Middleware, order []string, log *slog.Logger) {
@@ -1,14 +1,21 @@
 package http3
 
 import (
+	"crypto/tls"
 	"log/slog"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	quicHTTP3 "github.com/quic-go/quic-go/http3"
 	"github.com/roadrunner-server/http/v6/api"
+	"github.com/roadrunner-server/http/v6/servers/https"
+	"github.com/roadrunner-server/http/v6/tlsconf"
 )
 
 // recordingMiddleware appends its name to trace when the wrapped chain runs.
@@ -52,6 +59,23 @@ func TestNewHTTP3server_WithoutACME_UsesDefaultTLSConfig(t *testing.T) {
 	}
 }
 
+func TestNewHTTP3server_CountsHandshakes(t *testing.T) {
+	srv := testServer(t, &Config{Address: "127.0.0.1:8443"})
+
+	err := srv.server.TLSConfig.VerifyConnection(tls.ConnectionState{Version: tls.VersionTLS13, CipherSuite: tls.TLS_AES_128_GCM_SHA256, NegotiatedProtocol: "h3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st := srv.TLSStats()
+	if st.Handshakes.Load() != 1 || st.HandshakesBy()[https.Handshake{Version: "TLS 1.3", Cipher: "TLS_AES_128_GCM_SHA256", ALPN: "h3"}] != 1 {
+		t.Errorf("handshakes = %v", st.HandshakesBy())
+	}
+	if st.ACME() != nil {
+		t.Error("ACME stats without an acme config")
+	}
+}
+
 func TestServe_MissingCertificate_ReturnsError(t *testing.T) {
 	dir := t.TempDir()
 	srv := testServer(t, &Config{
@@ -117,3 +141,238 @@ func TestStop_IsIdempotent(t *testing.T) {
 	srv.Stop()
 	srv.Stop()
 }
+
+func TestConfigValid_TLSPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     *Config
+		wantErr string
+	}{
+		{"defaults", &Config{Address: "127.0.0.1:8443"}, ""},
+		{"post-quantum curves", &Config{Policy: tlsconf.Policy{CurvePreferences: []string{"x25519mlkem768"}}}, ""},
+		{"tls 1.2 ceiling", &Config{Policy: tlsconf.Policy{MaxVersion: "1.2"}}, "requires TLS 1.3"},
+		{"cipher suites", &Config{Policy: tlsconf.Policy{CipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}}}, "not configurable"},
+		{"foreign alpn", &Config{Policy: tlsconf.Policy{ALPN: []string{"h3", "h2"}}}, "only h3"},
+		{"unknown curve", &Config{Policy: tlsconf.Policy{CurvePreferences: []string{"p192"}}}, "unsupported curve"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Valid()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigInheritSSL(t *testing.T) {
+	ssl := &https.SSL{
+		Address:  "127.0.0.1:8443",
+		Key:      "server.key",
+		Cert:     "server.crt",
+		RootCA:   "ca.crt",
+		AuthType: https.RequireAndVerifyClientCert,
+		Policy: tlsconf.Policy{
+			MinVersion:       "1.2",
+			MaxVersion:       "1.2",
+			CipherSuites:     []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+			CurvePreferences: []string{"x25519"},
+			ALPN:             []string{"h2", "http/1.1"},
+		},
+	}
+
+	cfg := &Config{}
+	cfg.InheritSSL(ssl)
+
+	if cfg.Address != "127.0.0.1:8443" {
+		t.Errorf("address = %q, want the https one", cfg.Address)
+	}
+	if cfg.Key != "server.key" || cfg.Cert != "server.crt" {
+		t.Errorf("key/cert = %q/%q, want the ssl ones", cfg.Key, cfg.Cert)
+	}
+	if cfg.RootCA != "ca.crt" || cfg.AuthType != https.RequireAndVerifyClientCert {
+		t.Errorf("root_ca/client_auth_type = %q/%q, want the ssl ones", cfg.RootCA, cfg.AuthType)
+	}
+	if cfg.MinVersion != "1.2" || cfg.MaxVersion != "" {
+		t.Errorf("versions = %q-%q, want 1.2 without the 1.2 ceiling", cfg.MinVersion, cfg.MaxVersion)
+	}
+	if len(cfg.CipherSuites) != 0 || len(cfg.ALPN) != 0 {
+		t.Errorf("cipher_suites/alpn = %v/%v, want them not inherited", cfg.CipherSuites, cfg.ALPN)
+	}
+	if err := cfg.Valid(); err != nil {
+		t.Fatal(err)
+	}
+
+	own := &Config{Address: "127.0.0.1:8444", Key: "h3.key", Cert: "h3.crt", RootCA: "h3-ca.crt", AuthType: https.VerifyClientCertIfGiven}
+	own.InheritSSL(ssl)
+	if own.Address != "127.0.0.1:8444" || own.Key != "h3.key" || own.Cert != "h3.crt" || own.RootCA != "h3-ca.crt" || own.AuthType != https.VerifyClientCertIfGiven {
+		t.Errorf("own settings were overwritten: %+v", own)
+	}
+}
+
+func TestConfigAltSvc(t *testing.T) {
+	tests := []struct {
+		address string
+		want    string
+	}{
+		{"127.0.0.1:8444", `h3=":8444"; ma=86400`},
+		{":443", `h3=":443"; ma=86400`},
+		{"[::1]:8443", `h3=":8443"; ma=86400`},
+		{"127.0.0.1", ""},
+		{"127.0.0.1:0", ""},
+	}
+
+	for _, tt := range tests {
+		cfg := &Config{Address: tt.address}
+		cfg.InitDefaults()
+		if got := cfg.AltSvc(); got != tt.want {
+			t.Errorf("AltSvc(%q) = %q, want %q", tt.address, got, tt.want)
+		}
+	}
+
+	cfg := &Config{Address: ":443", AltSvcMaxAge: time.Minute}
+	if got := cfg.AltSvc(); got != `h3=":443"; ma=60` {
+		t.Errorf("AltSvc = %q", got)
+	}
+}
+
+func TestConfigValid_QUIC(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     *Config
+		wantErr string
+	}{
+		{"tuned", &Config{MaxIdleTimeout: time.Minute, KeepAlivePeriod: 15 * time.Second, MaxIncomingStreams: 256, InitialStreamReceiveWindow: 1 << 20, MaxStreamReceiveWindow: 6 << 20, AddressValidation: AddressValidationAuto}, ""},
+		{"keep alive above idle timeout", &Config{MaxIdleTimeout: 10 * time.Second, KeepAlivePeriod: 30 * time.Second}, "keep_alive_period"},
+		{"negative streams", &Config{MaxIncomingStreams: -1}, "max_incoming_streams"},
+		{"stream window", &Config{InitialStreamReceiveWindow: 2 << 20, MaxStreamReceiveWindow: 1 << 20}, "initial_stream_receive_window"},
+		{"connection window", &Config{InitialConnectionReceiveWindow: 2 << 20, MaxConnectionReceiveWindow: 1 << 20}, "initial_connection_receive_window"},
+		{"unknown address validation", &Config{AddressValidation: "sometimes"}, "unknown address_validation"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Valid()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewHTTP3server_QUICConfig(t *testing.T) {
+	srv := testServer(t, &Config{Address: "127.0.0.1:8443", MaxIdleTimeout: time.Minute, MaxIncomingStreams: 64, Allow0RTT: true})
+
+	qc := srv.server.QUICConfig
+	if qc.MaxIdleTimeout != time.Minute || qc.MaxIncomingStreams != 64 || !qc.Allow0RTT {
+		t.Errorf("QUICConfig = %+v", qc)
+	}
+}
+
+func TestEarlyData_RejectsUnsafeMethods(t *testing.T) {
+	stats := NewStats()
+	h := earlyData(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusNoContent) }), stats)
+
+	tests := []struct {
+		method   string
+		complete bool
+		want     int
+	}{
+		{http.MethodGet, false, http.StatusNoContent},
+		{http.MethodHead, false, http.StatusNoContent},
+		{http.MethodPost, false, http.StatusTooEarly},
+		{http.MethodDelete, false, http.StatusTooEarly},
+		{http.MethodPost, true, http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequestWithContext(t.Context(), tt.method, "/", nil)
+		req.TLS = &tls.ConnectionState{HandshakeComplete: tt.complete}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != tt.want {
+			t.Errorf("%s (handshake complete %v) = %d, want %d", tt.method, tt.complete, rec.Code, tt.want)
+		}
+	}
+
+	if stats.EarlyAccepted.Load() != 2 || stats.EarlyRejected.Load() != 2 {
+		t.Errorf("early accepted/rejected = %d/%d, want 2/2", stats.EarlyAccepted.Load(), stats.EarlyRejected.Load())
+	}
+}
+
+func TestAddressValidator(t *testing.T) {
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5000}
+	now := time.Unix(0, 0)
+
+	always := &addressValidator{mode: AddressValidationAlways, stats: NewStats(), now: time.Now}
+	if !always.verify(addr) {
+		t.Error("always: the address was not validated")
+	}
+
+	auto := &addressValidator{mode: AddressValidationAuto, threshold: 2, stats: NewStats(), now: func() time.Time { return now }}
+	got := []bool{auto.verify(addr), auto.verify(addr), auto.verify(addr)}
+	if got[0] || got[1] || !got[2] {
+		t.Errorf("auto: retries = %v, want only above the threshold", got)
+	}
+
+	// the next second starts a new window
+	now = now.Add(time.Second)
+	if auto.verify(addr) {
+		t.Error("auto: retry in a new window below the threshold")
+	}
+
+	if auto.stats.Retries.Load() != 1 {
+		t.Errorf("retries = %d, want 1", auto.stats.Retries.Load())
+	}
+}
+
+func TestListenUDP_Buffers(t *testing.T) {
+	conn, err := listenUDP(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}, &Config{ReadBufferSize: 1 << 20, WriteBufferSize: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	if conn.LocalAddr().(*net.UDPAddr).Port == 0 {
+		t.Error("the socket is not bound")
+	}
+}
+
+func TestSetProcessOptions(t *testing.T) {
+	// restored after the test, the toggles are process-wide
+	t.Setenv("QUIC_GO_DISABLE_GSO", "")
+	t.Setenv("QUIC_GO_DISABLE_ECN", "")
+
+	if err := SetProcessOptions(&Config{DisableGSO: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if os.Getenv("QUIC_GO_DISABLE_GSO") != "true" || os.Getenv("QUIC_GO_DISABLE_ECN") != "" {
+		t.Errorf("GSO = %q, ECN = %q, want only GSO disabled", os.Getenv("QUIC_GO_DISABLE_GSO"), os.Getenv("QUIC_GO_DISABLE_ECN"))
+	}
+}
+
+func TestStop_IdleServerReturnsAtOnce(t *testing.T) {
+	srv := testServer(t, &Config{Address: "127.0.0.1:0", ShutdownTimeout: time.Second})
+
+	// the server was never started, graceful shutdown returns at once
+	start := time.Now()
+	srv.Stop()
+	if time.Since(start) > 500*time.Millisecond {
+		t.Error("stop of an idle server waited for the shutdown timeout")
+	}
+}
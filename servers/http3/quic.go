@@ -0,0 +1,145 @@
+package http3
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+const (
+	AddressValidationOff    string = "off"
+	AddressValidationAlways string = "always"
+	AddressValidationAuto   string = "auto"
+)
+
+// quicConfig returns the QUIC transport settings of the configuration.
+func quicConfig(cfg *Config) *quic.Config {
+	return &quic.Config{
+		MaxIdleTimeout:                 cfg.MaxIdleTimeout,
+		KeepAlivePeriod:                cfg.KeepAlivePeriod,
+		MaxIncomingStreams:             cfg.MaxIncomingStreams,
+		InitialStreamReceiveWindow:     cfg.InitialStreamReceiveWindow,
+		MaxStreamReceiveWindow:         cfg.MaxStreamReceiveWindow,
+		InitialConnectionReceiveWindow: cfg.InitialConnectionReceiveWindow,
+		MaxConnectionReceiveWindow:     cfg.MaxConnectionReceiveWindow,
+		Allow0RTT:                      cfg.Allow0RTT,
+	}
+}
+
+// SetProcessOptions applies the GSO and ECN toggles. quic-go reads them only from the environment variables,
+// so they are process-wide: they affect every QUIC socket of the process and are set once at the plugin Init.
+func SetProcessOptions(cfg *Config) error {
+	if cfg.DisableGSO {
+		err := os.Setenv("QUIC_GO_DISABLE_GSO", "true")
+		if err != nil {
+			return err
+		}
+	}
+
+	if cfg.DisableECN {
+		err := os.Setenv("QUIC_GO_DISABLE_ECN", "true")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// listenUDP opens the UDP socket with the configured buffers.
+func listenUDP(addr *net.UDPAddr, cfg *Config) (*net.UDPConn, error) {
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.ReadBufferSize > 0 {
+		err = conn.SetReadBuffer(cfg.ReadBufferSize)
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+
+	if cfg.WriteBufferSize > 0 {
+		err = conn.SetWriteBuffer(cfg.WriteBufferSize)
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+// addressValidator decides which connection attempts from unvalidated addresses get a Retry.
+type addressValidator struct {
+	mode      string
+	threshold int
+	stats     *Stats
+	now       func() time.Time
+
+	mu          sync.Mutex
+	windowStart time.Time
+	attempts    int
+}
+
+// verify is the quic.Transport VerifySourceAddress callback.
+func (v *addressValidator) verify(net.Addr) bool {
+	retry := false
+
+	switch v.mode {
+	case AddressValidationAlways:
+		retry = true
+	case AddressValidationAuto:
+		now := v.now()
+
+		v.mu.Lock()
+		if now.Sub(v.windowStart) >= time.Second {
+			v.windowStart = now
+			v.attempts = 0
+		}
+		v.attempts++
+		retry = v.attempts > v.threshold
+		v.mu.Unlock()
+	}
+
+	if retry {
+		v.stats.Retries.Add(1)
+	}
+
+	return retry
+}
+
+// earlyData rejects the unsafe requests received in the 0-RTT data, which could be replayed by an attacker (RFC 8470).
+func earlyData(next http.Handler, stats *Stats) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && !r.TLS.HandshakeComplete {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+				stats.EarlyAccepted.Add(1)
+			default:
+				stats.EarlyRejected.Add(1)
+				w.WriteHeader(http.StatusTooEarly)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// countStreams tracks the request streams.
+func countStreams(next http.Handler, stats *Stats) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stats.Streams.Add(1)
+		stats.ActiveStreams.Add(1)
+		defer stats.ActiveStreams.Add(-1)
+
+		next.ServeHTTP(w, r)
+	})
+}
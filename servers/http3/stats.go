@@ -0,0 +1,107 @@
+package http3
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/quic-go/quic-go"
+)
+
+// RTTBuckets are the upper bounds (seconds) of the smoothed RTT histogram.
+var RTTBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+
+// Transfer is the traffic of the closed connections.
+type Transfer struct {
+	PacketsSent     uint64
+	PacketsReceived uint64
+	PacketsLost     uint64
+	BytesSent       uint64
+	BytesReceived   uint64
+	BytesLost       uint64
+}
+
+// Stats contains QUIC connection and stream counters of the HTTP/3 server.
+type Stats struct {
+	// Connections is the number of accepted connections.
+	Connections atomic.Uint64
+	// ActiveConnections is the number of open connections.
+	ActiveConnections atomic.Int64
+	// Streams is the number of request streams.
+	Streams atomic.Uint64
+	// ActiveStreams is the number of requests in progress.
+	ActiveStreams atomic.Int64
+	// EarlyAccepted is the number of safe requests served from 0-RTT data.
+	EarlyAccepted atomic.Uint64
+	// EarlyRejected is the number of unsafe 0-RTT requests answered with 425 Too Early.
+	EarlyRejected atomic.Uint64
+	// Retries is the number of connection attempts asked to validate the address with a Retry.
+	Retries atomic.Uint64
+
+	mu       sync.Mutex
+	transfer Transfer
+	// smoothed RTT of the closed connections, counts per RTTBuckets (non-cumulative) and the +Inf bucket
+	rttCounts []uint64
+	rttSum    float64
+}
+
+func NewStats() *Stats {
+	return &Stats{
+		rttCounts: make([]uint64, len(RTTBuckets)+1),
+	}
+}
+
+// OpenConnection records an accepted connection.
+func (s *Stats) OpenConnection() {
+	s.Connections.Add(1)
+	s.ActiveConnections.Add(1)
+}
+
+// CloseConnection records the traffic and the RTT of a closed connection.
+func (s *Stats) CloseConnection(cs *quic.ConnectionStats) {
+	s.ActiveConnections.Add(-1)
+
+	rtt := cs.SmoothedRTT.Seconds()
+	i := len(RTTBuckets)
+	for j, le := range RTTBuckets {
+		if rtt <= le {
+			i = j
+			break
+		}
+	}
+
+	s.mu.Lock()
+	s.transfer.PacketsSent += cs.PacketsSent
+	s.transfer.PacketsReceived += cs.PacketsReceived
+	s.transfer.PacketsLost += cs.PacketsLost
+	s.transfer.BytesSent += cs.BytesSent
+	s.transfer.BytesReceived += cs.BytesReceived
+	s.transfer.BytesLost += cs.BytesLost
+	s.rttCounts[i]++
+	s.rttSum += rtt
+	s.mu.Unlock()
+}
+
+// Transfer returns the traffic of the closed connections, open connections are not included.
+func (s *Stats) Transfer() Transfer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.transfer
+}
+
+// RTT returns the smoothed RTT histogram of the closed connections: the observations count, the sum (seconds)
+// and the cumulative counts per RTTBuckets upper bound.
+func (s *Stats) RTT() (uint64, float64, map[float64]uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var count uint64
+	buckets := make(map[float64]uint64, len(RTTBuckets))
+	for i, le := range RTTBuckets {
+		count += s.rttCounts[i]
+		buckets[le] = count
+	}
+	count += s.rttCounts[len(RTTBuckets)]
+
+	return count, s.rttSum, buckets
+}
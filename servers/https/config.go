@@ -4,11 +4,18 @@ import (
 	"errors"
 	"io/fs"
 	"net"
+	"net/http"
 	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	rrerrors "github.com/roadrunner-server/errors"
 	"github.com/roadrunner-server/http/v6/acme"
+	"github.com/roadrunner-server/http/v6/devcert"
+	"github.com/roadrunner-server/http/v6/tlsconf"
 )
 
 type ClientAuthType string
@@ -21,6 +28,9 @@ const (
 	RequireAndVerifyClientCert ClientAuthType = "require_and_verify_client_cert"
 )
 
+// environment variables marking a production deployment, dev certificates refuse to run there
+var productionEnv = []string{"RR_ENV", "APP_ENV"}
+
 // HTTP2 HTTP/2 server customizations.
 type HTTP2 struct {
 	// h2cHandler is a Handler which implements h2c by hijacking the HTTP/1 traffic
@@ -37,12 +47,50 @@ type HTTP2 struct {
 
 	// MaxConcurrentStreams defaults to 128.
 	MaxConcurrentStreams uint32 `mapstructure:"max_concurrent_streams"`
+	// MaxReadFrameSize is the largest frame the server is willing to read, 16KB - 16MB.
+	MaxReadFrameSize uint32 `mapstructure:"max_read_frame_size"`
+	// MaxUploadBufferPerConnection is the connection flow control window, at least 64KB.
+	MaxUploadBufferPerConnection int32 `mapstructure:"max_upload_buffer_per_connection"`
+	// MaxUploadBufferPerStream is the stream flow control window.
+	MaxUploadBufferPerStream int32 `mapstructure:"max_upload_buffer_per_stream"`
+	// MaxDecoderHeaderTableSize is the HPACK table size for the request headers.
+	MaxDecoderHeaderTableSize uint32 `mapstructure:"max_decoder_header_table_size"`
+	// MaxEncoderHeaderTableSize is the upper limit of the HPACK table size for the response headers.
+	MaxEncoderHeaderTableSize uint32 `mapstructure:"max_encoder_header_table_size"`
+	// ReadIdleTimeout sends a ping when no frame was received for this period.
+	ReadIdleTimeout time.Duration `mapstructure:"read_idle_timeout"`
+	// PingTimeout closes the connection when the ping is not answered within this period, defaults to 15s.
+	PingTimeout time.Duration `mapstructure:"ping_timeout"`
+	// WriteByteTimeout closes the connection when no data could be written for this period.
+	WriteByteTimeout time.Duration `mapstructure:"write_byte_timeout"`
+	// PermitProhibitedCipherSuites allows the TLS 1.2 cipher suites blacklisted by RFC 7540.
+	PermitProhibitedCipherSuites bool `mapstructure:"permit_prohibited_cipher_suites"`
+
+	// Stream abuse (rapid reset) protection, per connection, 0 - unlimited.
+
+	// MaxStreamsPerSecond limits the new streams, the exceeding streams get 429 and the connection GOAWAY.
+	MaxStreamsPerSecond uint32 `mapstructure:"max_streams_per_second"`
+	// MaxResetsPerSecond limits the streams canceled by the client, the connection is closed when exceeded.
+	MaxResetsPerSecond uint32 `mapstructure:"max_resets_per_second"`
 }
 
 func (h2 *HTTP2) EnableHTTP2() bool {
 	return h2 != nil && h2.H2C
 }
 
+// SessionTickets configures TLS session resumption tickets shared between several RoadRunner instances.
+type SessionTickets struct {
+	// Disabled turns session tickets off, every connection does a full handshake.
+	Disabled bool `mapstructure:"disabled"`
+	// KeyFile contains one or more raw 32-byte keys, the first key encrypts new tickets,
+	// the rest are used only to decrypt tickets issued before a rotation.
+	KeyFile string `mapstructure:"key_file"`
+	// KeysDir contains key files, the keys from the most recently modified file encrypt new tickets.
+	KeysDir string `mapstructure:"keys_dir"`
+	// ReloadInterval defines how often the keys are re-read from disk, 1m by default.
+	ReloadInterval time.Duration `mapstructure:"reload_interval"`
+}
+
 // SSL defines https server configuration.
 type SSL struct {
 	// Address to listen as HTTPS server, defaults to 0.0.0.0:443.
@@ -59,6 +107,16 @@ type SSL struct {
 	RootCA string `mapstructure:"root_ca"`
 	// mTLS auth
 	AuthType ClientAuthType `mapstructure:"client_auth_type"`
+	// TLS versions, cipher suites, curves and ALPN
+	tlsconf.Policy `mapstructure:",squash"`
+	// SessionTickets keys shared across the instances
+	SessionTickets *SessionTickets `mapstructure:"session_tickets"`
+	// DevCertificates generates a local CA and a certificate for the listener, for development only.
+	DevCertificates bool `mapstructure:"dev_certificates"`
+	// DevCertificatesDir caches the generated CA and certificates, defaults to .rr-dev-certs.
+	DevCertificatesDir string `mapstructure:"dev_certificates_dir"`
+	// DevCertificatesNames are additional DNS names and IPs of the certificate, localhost is always included.
+	DevCertificatesNames []string `mapstructure:"dev_certificates_names"`
 	// internal
 	host string
 	// internal
@@ -71,9 +129,49 @@ func (h2 *HTTP2) InitDefaults() error {
 		h2.MaxConcurrentStreams = 128
 	}
 
+	return h2.Valid()
+}
+
+// Valid checks the HTTP/2 limits against the RFC 7540 bounds.
+func (h2 *HTTP2) Valid() error {
+	const op = rrerrors.Op("http2_valid")
+
+	if h2.MaxReadFrameSize != 0 && (h2.MaxReadFrameSize < 16<<10 || h2.MaxReadFrameSize > 1<<24-1) {
+		return rrerrors.E(op, rrerrors.Errorf("max_read_frame_size should be between 16384 and 16777215, got %d", h2.MaxReadFrameSize))
+	}
+
+	if h2.MaxUploadBufferPerConnection < 0 || h2.MaxUploadBufferPerStream < 0 {
+		return rrerrors.E(op, rrerrors.Str("max_upload_buffer_per_connection and max_upload_buffer_per_stream could not be negative"))
+	}
+
+	// smaller values are silently replaced by the default
+	if h2.MaxUploadBufferPerConnection != 0 && h2.MaxUploadBufferPerConnection < 65535 {
+		return rrerrors.E(op, rrerrors.Errorf("max_upload_buffer_per_connection should be at least 65535, got %d", h2.MaxUploadBufferPerConnection))
+	}
+
+	if h2.ReadIdleTimeout < 0 || h2.PingTimeout < 0 || h2.WriteByteTimeout < 0 {
+		return rrerrors.E(op, rrerrors.Str("read_idle_timeout, ping_timeout and write_byte_timeout could not be negative"))
+	}
+
 	return nil
 }
 
+// NetHTTPConfig returns the settings for the net/http HTTP/2 implementation.
+func (h2 *HTTP2) NetHTTPConfig() *http.HTTP2Config {
+	return &http.HTTP2Config{
+		MaxConcurrentStreams:          int(h2.MaxConcurrentStreams),
+		MaxReadFrameSize:              int(h2.MaxReadFrameSize),
+		MaxReceiveBufferPerConnection: int(h2.MaxUploadBufferPerConnection),
+		MaxReceiveBufferPerStream:     int(h2.MaxUploadBufferPerStream),
+		MaxDecoderHeaderTableSize:     int(h2.MaxDecoderHeaderTableSize),
+		MaxEncoderHeaderTableSize:     int(h2.MaxEncoderHeaderTableSize),
+		SendPingTimeout:               h2.ReadIdleTimeout,
+		PingTimeout:                   h2.PingTimeout,
+		WriteByteTimeout:              h2.WriteByteTimeout,
+		PermitProhibitedCipherSuites:  h2.PermitProhibitedCipherSuites,
+	}
+}
+
 func (s *SSL) InitDefaults() error {
 	if s.Acme != nil {
 		err := s.Acme.InitDefaults()
@@ -86,9 +184,94 @@ func (s *SSL) InitDefaults() error {
 		s.Address = "127.0.0.1:443"
 	}
 
+	if s.SessionTickets != nil && s.SessionTickets.ReloadInterval == 0 {
+		s.SessionTickets.ReloadInterval = time.Minute
+	}
+
+	if s.DevCertificates {
+		return s.initDevCertificates()
+	}
+
+	return nil
+}
+
+// initDevCertificates generates (or reuses) the development certificates and points Cert and Key to them.
+func (s *SSL) initDevCertificates() error {
+	const op = rrerrors.Op("ssl_dev_certificates")
+
+	if s.Acme != nil {
+		if s.Acme.UseProductionEndpoint {
+			return rrerrors.E(op, rrerrors.Str("dev_certificates could not be used with acme use_production_endpoint"))
+		}
+
+		return rrerrors.E(op, rrerrors.Str("dev_certificates could not be used with acme"))
+	}
+
+	for _, env := range productionEnv {
+		if v := strings.ToLower(os.Getenv(env)); v == "prod" || v == "production" {
+			return rrerrors.E(op, rrerrors.Errorf("dev_certificates could not be used in production (%s=%s)", env, os.Getenv(env)))
+		}
+	}
+
+	if s.Key != "" || s.Cert != "" {
+		return rrerrors.E(op, rrerrors.Str("dev_certificates could not be used together with key and cert"))
+	}
+
+	if s.DevCertificatesDir == "" {
+		s.DevCertificatesDir = ".rr-dev-certs"
+	}
+
+	dir, err := filepath.Abs(s.DevCertificatesDir)
+	if err != nil {
+		return rrerrors.E(op, err)
+	}
+	s.DevCertificatesDir = dir
+
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if host, _, err := net.SplitHostPort(s.Address); err == nil {
+		hosts = appendHost(hosts, host)
+	}
+	for _, name := range s.DevCertificatesNames {
+		hosts = appendHost(hosts, name)
+	}
+
+	bundle, err := devcert.Ensure(s.DevCertificatesDir, hosts)
+	if err != nil {
+		return rrerrors.E(op, err)
+	}
+
+	s.Cert = bundle.Cert
+	s.Key = bundle.Key
+
 	return nil
 }
 
+// DevCA returns the path of the development CA certificate, empty when dev certificates are disabled.
+func (s *SSL) DevCA() string {
+	if s == nil || !s.DevCertificates {
+		return ""
+	}
+
+	return filepath.Join(s.DevCertificatesDir, devcert.CAFile)
+}
+
+// appendHost adds the host to the certificate names, skipping the wildcard listen addresses and duplicates.
+func appendHost(hosts []string, host string) []string {
+	host = strings.TrimSpace(host)
+	switch host {
+	case "", "0.0.0.0", "::":
+		return hosts
+	}
+
+	for _, h := range hosts {
+		if strings.EqualFold(h, host) {
+			return hosts
+		}
+	}
+
+	return append(hosts, host)
+}
+
 func (s *SSL) EnableACME() bool {
 	if s == nil {
 		return false
@@ -143,5 +326,47 @@ func (s *SSL) Valid() error {
 		}
 	}
 
+	err = s.Policy.Valid()
+	if err != nil {
+		return rrerrors.E(op, err)
+	}
+
+	// net/http serves only these two, an alpn list without both would disable the server
+	if len(s.ALPN) > 0 && !slices.Contains(s.ALPN, "h2") && !slices.Contains(s.ALPN, "http/1.1") {
+		return rrerrors.E(op, rrerrors.Str("alpn should contain h2 or http/1.1"))
+	}
+
+	if s.SessionTickets != nil {
+		err = s.SessionTickets.Valid()
+		if err != nil {
+			return rrerrors.E(op, err)
+		}
+	}
+
 	return nil
 }
+
+func (st *SessionTickets) Valid() error {
+	if st.Disabled {
+		if st.KeyFile != "" || st.KeysDir != "" {
+			return rrerrors.Str("session tickets are disabled, key_file and keys_dir should not be set")
+		}
+
+		return nil
+	}
+
+	switch {
+	case st.KeyFile != "" && st.KeysDir != "":
+		return rrerrors.Str("only one of the session tickets key_file or keys_dir could be set")
+	case st.KeyFile == "" && st.KeysDir == "":
+		return rrerrors.Str("session tickets should have key_file or keys_dir, or be disabled")
+	}
+
+	if st.ReloadInterval < 0 {
+		return rrerrors.Str("session tickets reload_interval could not be negative")
+	}
+
+	// fail fast on a missing or malformed key material
+	_, err := loadTicketKeys(st)
+	return err
+}
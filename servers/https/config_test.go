@@ -1,10 +1,13 @@
 package https
 
 import (
+	"crypto/tls"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/roadrunner-server/http/v6/acme"
+	"github.com/roadrunner-server/http/v6/tlsconf"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -139,6 +142,16 @@ func TestSSL_ValidIPv6ParseOK(t *testing.T) {
 	assert.Equal(t, 443, conf.Port)
 }
 
+func TestSSL_ValidALPN(t *testing.T) {
+	conf := &SSL{Address: "127.0.0.1:443", Acme: &acme.Config{}, Policy: tlsconf.Policy{ALPN: []string{"spdy/3"}}}
+	err := conf.Valid()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "h2 or http/1.1")
+
+	conf.ALPN = []string{"spdy/3", "http/1.1"}
+	assert.NoError(t, conf.Valid())
+}
+
 func TestTlsAddr(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -264,3 +277,133 @@ func TestSSL_ValidACMESkipsCertChecks(t *testing.T) {
 	require.NoError(t, conf.Valid())
 	assert.Equal(t, "127.0.0.1", conf.host)
 }
+
+func TestSSL_ValidTLSPolicy(t *testing.T) {
+	chain := writeTestChain(t)
+	conf := &SSL{
+		Address: "127.0.0.1:8443",
+		Key:     chain.key,
+		Cert:    chain.cert,
+	}
+	conf.MinVersion = "1.1"
+
+	err := conf.Valid()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unsupported min_version")
+
+	conf.MinVersion = "1.3"
+	conf.CurvePreferences = []string{"x25519mlkem768", "x25519"}
+	require.NoError(t, conf.Valid())
+}
+
+func TestSSL_DevCertificates(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "certs")
+	conf := &SSL{
+		Address:              "0.0.0.0:8443",
+		DevCertificates:      true,
+		DevCertificatesDir:   dir,
+		DevCertificatesNames: []string{"app.test", "localhost"},
+	}
+
+	require.NoError(t, conf.InitDefaults())
+	require.NoError(t, conf.Valid())
+
+	assert.Equal(t, filepath.Join(dir, "cert.pem"), conf.Cert)
+	assert.Equal(t, filepath.Join(dir, "key.pem"), conf.Key)
+	assert.Equal(t, filepath.Join(dir, "rootCA.pem"), conf.DevCA())
+
+	pair, err := tls.LoadX509KeyPair(conf.Cert, conf.Key)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"localhost", "app.test"}, pair.Leaf.DNSNames)
+	assert.Len(t, pair.Leaf.IPAddresses, 2)
+}
+
+func TestSSL_DevCertificatesRefused(t *testing.T) {
+	tests := []struct {
+		name string
+		conf *SSL
+		env  string
+		err  string
+	}{
+		{
+			name: "acme production",
+			conf: &SSL{Acme: &acme.Config{Email: "user@example.com", Domains: []string{"example.com"}, UseProductionEndpoint: true}},
+			err:  "use_production_endpoint",
+		},
+		{
+			name: "production env",
+			conf: &SSL{},
+			env:  "production",
+			err:  "RR_ENV=production",
+		},
+		{
+			name: "own certificates",
+			conf: &SSL{Key: "key.pem", Cert: "cert.pem"},
+			err:  "key and cert",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("RR_ENV", tt.env)
+			tt.conf.DevCertificates = true
+			tt.conf.DevCertificatesDir = t.TempDir()
+
+			err := tt.conf.InitDefaults()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
+
+func TestHTTP2_Valid(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *HTTP2
+		err  string
+	}{
+		{"defaults", &HTTP2{}, ""},
+		{"tuned", &HTTP2{MaxReadFrameSize: 1 << 20, MaxUploadBufferPerConnection: 4 << 20, MaxUploadBufferPerStream: 1 << 20, PingTimeout: time.Second}, ""},
+		{"small frame", &HTTP2{MaxReadFrameSize: 1024}, "max_read_frame_size"},
+		{"big frame", &HTTP2{MaxReadFrameSize: 1 << 24}, "max_read_frame_size"},
+		{"small connection window", &HTTP2{MaxUploadBufferPerConnection: 1024}, "at least 65535"},
+		{"negative stream window", &HTTP2{MaxUploadBufferPerStream: -1}, "could not be negative"},
+		{"negative timeout", &HTTP2{WriteByteTimeout: -time.Second}, "could not be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.InitDefaults()
+			if tt.err == "" {
+				require.NoError(t, err)
+				assert.Equal(t, uint32(128), tt.cfg.MaxConcurrentStreams)
+				return
+			}
+
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
+
+func TestHTTP2_NetHTTPConfig(t *testing.T) {
+	cfg := (&HTTP2{
+		MaxConcurrentStreams:         64,
+		MaxReadFrameSize:             1 << 20,
+		MaxUploadBufferPerConnection: 4 << 20,
+		MaxUploadBufferPerStream:     1 << 20,
+		ReadIdleTimeout:              30 * time.Second,
+		PingTimeout:                  5 * time.Second,
+		WriteByteTimeout:             10 * time.Second,
+		PermitProhibitedCipherSuites: true,
+	}).NetHTTPConfig()
+
+	assert.Equal(t, 64, cfg.MaxConcurrentStreams)
+	assert.Equal(t, 1<<20, cfg.MaxReadFrameSize)
+	assert.Equal(t, 4<<20, cfg.MaxReceiveBufferPerConnection)
+	assert.Equal(t, 1<<20, cfg.MaxReceiveBufferPerStream)
+	assert.Equal(t, 30*time.Second, cfg.SendPingTimeout)
+	assert.Equal(t, 5*time.Second, cfg.PingTimeout)
+	assert.Equal(t, 10*time.Second, cfg.WriteByteTimeout)
+	assert.True(t, cfg.PermitProhibitedCipherSuites)
+}
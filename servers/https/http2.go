@@ -1,14 +1,108 @@
 package https
 
 import (
+	"context"
+	"log/slog"
+	"net"
 	"net/http"
+	"sync"
+	"time"
 
 	"golang.org/x/net/http2"
 )
 
 // init http/2 server
-func initHTTP2(server *http.Server, streams uint32) error {
+func initHTTP2(server *http.Server, cfg *HTTP2) error {
 	return http2.ConfigureServer(server, &http2.Server{
-		MaxConcurrentStreams: streams,
+		MaxConcurrentStreams:         cfg.MaxConcurrentStreams,
+		MaxReadFrameSize:             cfg.MaxReadFrameSize,
+		MaxUploadBufferPerConnection: cfg.MaxUploadBufferPerConnection,
+		MaxUploadBufferPerStream:     cfg.MaxUploadBufferPerStream,
+		MaxDecoderHeaderTableSize:    cfg.MaxDecoderHeaderTableSize,
+		MaxEncoderHeaderTableSize:    cfg.MaxEncoderHeaderTableSize,
+		ReadIdleTimeout:              cfg.ReadIdleTimeout,
+		PingTimeout:                  cfg.PingTimeout,
+		WriteByteTimeout:             cfg.WriteByteTimeout,
+		PermitProhibitedCipherSuites: cfg.PermitProhibitedCipherSuites,
+	})
+}
+
+type streamLimiterKey struct{}
+
+// streamLimiter counts the streams and the client resets of one connection in one second windows.
+type streamLimiter struct {
+	conn net.Conn
+
+	mu          sync.Mutex
+	windowStart time.Time
+	streams     uint32
+	resets      uint32
+}
+
+// add counts a stream or a reset, false means the connection exceeded the limit.
+func (l *streamLimiter) add(now time.Time, reset bool, limit uint32) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.windowStart) >= time.Second {
+		l.windowStart = now
+		l.streams = 0
+		l.resets = 0
+	}
+
+	n := &l.streams
+	if reset {
+		n = &l.resets
+	}
+	*n++
+
+	return limit == 0 || *n <= limit
+}
+
+// GuardStreams protects the workers from the HTTP/2 stream abuse (rapid reset): the streams reset before
+// the handler started never reach the worker, and the connections exceeding the per second limits are
+// sent GOAWAY (streams) or closed (resets).
+func GuardStreams(server *http.Server, cfg *HTTP2, log *slog.Logger) {
+	connContext := server.ConnContext
+	server.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+		if connContext != nil {
+			ctx = connContext(ctx, c)
+		}
+
+		return context.WithValue(ctx, streamLimiterKey{}, &streamLimiter{conn: c})
+	}
+
+	next := server.Handler
+	server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l, ok := r.Context().Value(streamLimiterKey{}).(*streamLimiter)
+		if !ok || r.ProtoMajor != 2 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// the client reset the stream while the handler was queued
+		if r.Context().Err() != nil {
+			if !l.add(time.Now(), true, cfg.MaxResetsPerSecond) {
+				log.Warn("http2 connection closed, too many stream resets", "remote", r.RemoteAddr)
+				_ = l.conn.Close()
+			}
+			return
+		}
+
+		if !l.add(time.Now(), false, cfg.MaxStreamsPerSecond) {
+			log.Warn("http2 connection exceeded the streams rate, sending GOAWAY", "remote", r.RemoteAddr)
+			// Connection: close makes the HTTP/2 server send GOAWAY
+			w.Header().Set("Connection", "close")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+
+		// reset while the worker was handling the request
+		if r.Context().Err() != nil && !l.add(time.Now(), true, cfg.MaxResetsPerSecond) {
+			log.Warn("http2 connection closed, too many stream resets", "remote", r.RemoteAddr)
+			_ = l.conn.Close()
+		}
 	})
 }
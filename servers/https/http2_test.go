@@ -0,0 +1,81 @@
+package https
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamLimiterWindow(t *testing.T) {
+	l := &streamLimiter{}
+	now := time.Unix(100, 0)
+
+	assert.True(t, l.add(now, false, 2))
+	assert.True(t, l.add(now, false, 2))
+	assert.False(t, l.add(now, false, 2))
+	// resets are counted separately
+	assert.True(t, l.add(now, true, 1))
+	assert.False(t, l.add(now, true, 1))
+
+	// a new window
+	now = now.Add(time.Second)
+	assert.True(t, l.add(now, false, 2))
+	assert.True(t, l.add(now, true, 1))
+
+	// no limit
+	for range 100 {
+		assert.True(t, l.add(now, false, 0))
+	}
+}
+
+func TestGuardStreams(t *testing.T) {
+	var served int
+	srv := &http.Server{ //nolint:gosec
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			served++
+			w.WriteHeader(http.StatusNoContent)
+		}),
+	}
+
+	GuardStreams(srv, &HTTP2{MaxStreamsPerSecond: 2, MaxResetsPerSecond: 1}, discardLogger())
+
+	client, server := net.Pipe()
+	t.Cleanup(func() { _ = client.Close() })
+	connCtx := srv.ConnContext(t.Context(), server)
+
+	request := func(ctx context.Context, protoMajor int) *httptest.ResponseRecorder {
+		req := httptest.NewRequestWithContext(ctx, http.MethodGet, "/", nil)
+		req.ProtoMajor = protoMajor
+		rec := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusNoContent, request(connCtx, 2).Code)
+	assert.Equal(t, http.StatusNoContent, request(connCtx, 2).Code)
+
+	rec := request(connCtx, 2)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "close", rec.Header().Get("Connection"))
+
+	// HTTP/1 requests are not limited
+	assert.Equal(t, http.StatusNoContent, request(connCtx, 1).Code)
+	assert.Equal(t, 3, served)
+
+	// streams reset before the handler started never reach the worker
+	canceled, cancel := context.WithCancel(connCtx)
+	cancel()
+	request(canceled, 2)
+	assert.Equal(t, 3, served)
+
+	// the second reset within the second closes the connection
+	request(canceled, 2)
+	_, err := server.Write([]byte{0})
+	require.Error(t, err)
+}
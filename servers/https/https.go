@@ -13,6 +13,7 @@ import (
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/roadrunner-server/tcplisten"
@@ -20,7 +21,6 @@ import (
 	"github.com/roadrunner-server/http/v6/acme"
 	"github.com/roadrunner-server/http/v6/api"
 	"github.com/roadrunner-server/http/v6/servers"
-	"github.com/roadrunner-server/http/v6/tlsconf"
 
 	"github.com/mholt/acmez"
 	"github.com/roadrunner-server/errors"
@@ -30,68 +30,80 @@ type Server struct {
 	cfg   *SSL
 	log   *slog.Logger
 	https *http.Server
+	stats *Stats
+	// session ticket keys rotation (nil if not configured)
+	tickets  *ticketKeys
+	stopCh   chan struct{}
+	stopOnce sync.Once
 }
 
-func NewHTTPSServer(handler http.Handler, cfg *SSL, cfgHTTP2 *HTTP2, errLog *log.Logger, logger *slog.Logger) (servers.InternalServer[any], error) {
-	httpsServer := initTLS(handler, errLog, cfg.Address, cfg.Port)
+// NewHTTPSServer creates the https server, certs are the ACME certificates shared with the http3 server (nil without ACME).
+func NewHTTPSServer(handler http.Handler, cfg *SSL, cfgHTTP2 *HTTP2, certs *acme.Certificates, errLog *log.Logger, logger *slog.Logger) (servers.InternalServer[any], error) {
+	tlsCfg, err := cfg.Policy.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	stats := NewStats()
+	httpsServer := initTLS(handler, errLog, cfg.Address, cfg.Port, tlsCfg)
+	if len(cfg.ALPN) > 0 {
+		httpsServer.Protocols = alpnProtocols(cfg.ALPN)
+	}
 
 	if cfg.RootCA != "" {
-		pool, err := createCertPool(cfg.RootCA)
+		err = ApplyClientAuth(httpsServer.TLSConfig, cfg.RootCA, cfg.AuthType)
 		if err != nil {
 			return nil, err
 		}
+	}
 
-		if pool != nil {
-			httpsServer.TLSConfig.ClientCAs = pool
-			// auth type used only for the CA
-			switch cfg.AuthType {
-			case NoClientCert:
-				httpsServer.TLSConfig.ClientAuth = tls.NoClientCert
-			case RequestClientCert:
-				httpsServer.TLSConfig.ClientAuth = tls.RequestClientCert
-			case RequireAnyClientCert:
-				httpsServer.TLSConfig.ClientAuth = tls.RequireAnyClientCert
-			case VerifyClientCertIfGiven:
-				httpsServer.TLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
-			case RequireAndVerifyClientCert:
-				httpsServer.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
-			default:
-				httpsServer.TLSConfig.ClientAuth = tls.NoClientCert
-			}
-		}
+	if certs != nil {
+		stats.SetACME(certs.Stats)
+
+		httpsServer.TLSConfig.GetCertificate = certs.TLSConfig.GetCertificate
+		httpsServer.TLSConfig.NextProtos = append(httpsServer.TLSConfig.NextProtos, acmez.ACMETLS1Protocol)
 	}
 
-	if cfg.EnableACME() {
-		tlsCfg, err := acme.IssueCertificates(
-			cfg.Acme.CacheDir,
-			cfg.Acme.Email,
-			cfg.Acme.ChallengeType,
-			cfg.Acme.Domains,
-			cfg.Acme.UseProductionEndpoint,
-			cfg.Acme.AltHTTPPort,
-			cfg.Acme.AltTLSALPNPort,
-			logger,
-		)
+	if cfgHTTP2 != nil {
+		httpsServer.HTTP2 = cfgHTTP2.NetHTTPConfig()
+		GuardStreams(httpsServer, cfgHTTP2, logger)
 
-		if err != nil {
-			return nil, err
+		if cfgHTTP2.EnableHTTP2() {
+			err := initHTTP2(httpsServer, cfgHTTP2)
+			if err != nil {
+				return nil, err
+			}
 		}
-
-		httpsServer.TLSConfig.GetCertificate = tlsCfg.GetCertificate
-		httpsServer.TLSConfig.NextProtos = append(httpsServer.TLSConfig.NextProtos, acmez.ACMETLS1Protocol)
 	}
 
-	if cfgHTTP2 != nil && cfgHTTP2.EnableHTTP2() {
-		err := initHTTP2(httpsServer, cfgHTTP2.MaxConcurrentStreams)
-		if err != nil {
-			return nil, err
+	var tickets *ticketKeys
+	if cfg.SessionTickets != nil {
+		if cfg.SessionTickets.Disabled {
+			httpsServer.TLSConfig.SessionTicketsDisabled = true
+		} else {
+			tickets = &ticketKeys{
+				cfg:    cfg.SessionTickets,
+				tlsCfg: httpsServer.TLSConfig,
+				log:    logger,
+			}
+
+			err := tickets.apply()
+			if err != nil {
+				return nil, err
+			}
 		}
 	}
 
+	CountHandshakes(httpsServer.TLSConfig, stats)
+	countFailures(httpsServer, stats)
+
 	return &Server{
-		cfg:   cfg,
-		log:   logger,
-		https: httpsServer,
+		cfg:     cfg,
+		log:     logger,
+		https:   httpsServer,
+		stats:   stats,
+		tickets: tickets,
+		stopCh:  make(chan struct{}),
 	}, nil
 }
 
@@ -106,30 +118,34 @@ func (s *Server) Serve(mdwr map[string]api.Middleware, order []string) error {
 		return errors.E(op, err)
 	}
 
-	/*
-		ACME powered server
-	*/
-	if s.cfg.EnableACME() {
-		s.log.Debug("https(acme) server was started", "address", s.cfg.Address)
-		err = s.https.ServeTLS(
-			l,
-			"",
-			"",
-		)
-		if err != nil && !stderr.Is(err, http.ErrServerClosed) {
-			return errors.E(op, err)
+	// ACME powered server gets certificates via GetCertificate
+	if !s.cfg.EnableACME() {
+		cert, errL := tls.LoadX509KeyPair(s.cfg.Cert, s.cfg.Key)
+		if errL != nil {
+			_ = l.Close()
+			return errors.E(op, errL)
 		}
 
-		return nil
+		s.https.TLSConfig.Certificates = append(s.https.TLSConfig.Certificates, cert)
+		s.stats.AddCertificate(&cert)
 	}
 
-	s.log.Debug("https server was started", "address", s.cfg.Address)
-	err = s.https.ServeTLS(
-		l,
-		s.cfg.Cert,
-		s.cfg.Key,
-	)
+	if ca := s.cfg.DevCA(); ca != "" {
+		s.log.Warn("https server uses self-signed development certificates, add the CA to the trust store of your browser or OS", "ca", ca)
+	}
+
+	/*
+		ServeTLS clones the TLS config, so the session ticket keys could not be rotated after the start.
+		Serve the TLS listener with our own config instead.
+	*/
+	s.https.TLSConfig.NextProtos = nextProtos(s.https)
 
+	if s.tickets != nil {
+		go s.tickets.rotate(s.stopCh)
+	}
+
+	s.log.Debug("https server was started", "address", s.cfg.Address, "acme", s.cfg.EnableACME())
+	err = s.https.Serve(tls.NewListener(l, s.https.TLSConfig))
 	if err != nil && !stderr.Is(err, http.ErrServerClosed) {
 		return errors.E(op, err)
 	}
@@ -141,13 +157,53 @@ func (s *Server) Server() any {
 	return s.https
 }
 
+// Stats returns TLS handshake counters and the server certificates.
+func (s *Server) Stats() *Stats {
+	return s.stats
+}
+
 func (s *Server) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+	})
+
 	err := s.https.Close()
 	if err != nil && !stderr.Is(err, http.ErrServerClosed) {
 		s.log.Error("https shutdown", "error", err)
 	}
 }
 
+// ApplyClientAuth trusts the root CA for the client certificates and sets the client authentication type (mTLS).
+func ApplyClientAuth(tlsCfg *tls.Config, rootCA string, authType ClientAuthType) error {
+	pool, err := createCertPool(rootCA)
+	if err != nil {
+		return err
+	}
+
+	if pool == nil {
+		return nil
+	}
+
+	tlsCfg.ClientCAs = pool
+	// auth type used only for the CA
+	switch authType {
+	case NoClientCert:
+		tlsCfg.ClientAuth = tls.NoClientCert
+	case RequestClientCert:
+		tlsCfg.ClientAuth = tls.RequestClientCert
+	case RequireAnyClientCert:
+		tlsCfg.ClientAuth = tls.RequireAnyClientCert
+	case VerifyClientCertIfGiven:
+		tlsCfg.ClientAuth = tls.VerifyClientCertIfGiven
+	case RequireAndVerifyClientCert:
+		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		tlsCfg.ClientAuth = tls.NoClientCert
+	}
+
+	return nil
+}
+
 // append RootCA to the https server TLS config
 func createCertPool(rootCa string) (*x509.CertPool, error) {
 	const op = errors.Op("http_plugin_append_root_ca")
@@ -174,18 +230,28 @@ func createCertPool(rootCa string) (*x509.CertPool, error) {
 }
 
 // Init https server
-func initTLS(handler http.Handler, errLog *log.Logger, addr string, port int) *http.Server {
+func initTLS(handler http.Handler, errLog *log.Logger, addr string, port int, tlsCfg *tls.Config) *http.Server {
 	sslServer := &http.Server{
 		Addr:              tlsAddr(addr, true, port),
 		Handler:           handler,
 		ErrorLog:          errLog,
 		ReadHeaderTimeout: time.Minute * 5,
-		TLSConfig:         tlsconf.DefaultTLSConfig(),
+		TLSConfig:         tlsCfg,
 	}
 
 	return sslServer
 }
 
+// alpnProtocols limits the server protocols to the ones listed in the ALPN policy,
+// otherwise net/http would append h2 and http/1.1 to NextProtos on its own.
+func alpnProtocols(alpn []string) *http.Protocols {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(slices.Contains(alpn, "http/1.1"))
+	protocols.SetHTTP2(slices.Contains(alpn, "h2"))
+
+	return protocols
+}
+
 // tlsAddr replaces listen or host port with port configured by SSLConfig config.
 func tlsAddr(host string, forcePort bool, sslPort int) string {
 	if u, err := url.Parse("//" + host); err == nil {
@@ -204,6 +270,29 @@ func tlsAddr(host string, forcePort bool, sslPort int) string {
 	return host
 }
 
+// nextProtos mirrors the net/http ServeTLS behavior: keeps the configured ALPN order, drops the protocols
+// the server does not speak and appends h2 and http/1.1 when they are enabled but missing.
+func nextProtos(srv *http.Server) []string {
+	http1, http2 := true, true
+	if srv.Protocols != nil {
+		http1, http2 = srv.Protocols.HTTP1(), srv.Protocols.HTTP2()
+	}
+
+	protos := slices.DeleteFunc(slices.Clone(srv.TLSConfig.NextProtos), func(proto string) bool {
+		return (proto == "h2" && !http2) || (proto == "http/1.1" && !http1)
+	})
+
+	if http2 && !slices.Contains(protos, "h2") {
+		protos = append(protos, "h2")
+	}
+
+	if http1 && !slices.Contains(protos, "http/1.1") {
+		protos = append(protos, "http/1.1")
+	}
+
+	return protos
+}
+
 func applyMiddleware(server *http.Server, middleware map[string]api.Middleware, order []string, log *slog.Logger) {
 	for _, name := range slices.Backward(order) {
 		if mdwr, ok := middleware[name]; ok {
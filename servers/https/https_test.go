@@ -146,7 +146,7 @@ func discardLogger() *slog.Logger { return slog.New(slog.DiscardHandler) }
 func newTestServer(t *testing.T, cfg *SSL, cfgHTTP2 *HTTP2) *http.Server {
 	t.Helper()
 
-	srv, err := NewHTTPSServer(http.NotFoundHandler(), cfg, cfgHTTP2, nil, discardLogger())
+	srv, err := NewHTTPSServer(http.NotFoundHandler(), cfg, cfgHTTP2, nil, nil, discardLogger())
 	require.NoError(t, err)
 
 	https, ok := srv.Server().(*http.Server)
@@ -217,7 +217,7 @@ func TestNewHTTPSServerRootCAErrors(t *testing.T) {
 				Address: "127.0.0.1:8443",
 				Port:    8443,
 				RootCA:  tt.rootCA,
-			}, nil, nil, discardLogger())
+			}, nil, nil, nil, discardLogger())
 
 			require.Error(t, err)
 			assert.Nil(t, srv)
@@ -247,6 +247,20 @@ func TestNewHTTPSServerHTTP2(t *testing.T) {
 	}
 }
 
+func TestNewHTTPSServerTLSPolicy(t *testing.T) {
+	cfg := &SSL{Address: "127.0.0.1:8443", Port: 8443}
+	cfg.MinVersion = "1.3"
+	cfg.ALPN = []string{"http/1.1"}
+
+	https := newTestServer(t, cfg, nil)
+
+	assert.Equal(t, uint16(tls.VersionTLS13), https.TLSConfig.MinVersion)
+	assert.Equal(t, []string{"http/1.1"}, https.TLSConfig.NextProtos)
+	require.NotNil(t, https.Protocols)
+	assert.True(t, https.Protocols.HTTP1())
+	assert.False(t, https.Protocols.HTTP2())
+}
+
 func TestApplyMiddleware(t *testing.T) {
 	replacement := &markerHandler{}
 	known := &namedMiddleware{name: "known", replacement: replacement}
@@ -275,7 +289,7 @@ func TestApplyMiddleware(t *testing.T) {
 func TestServeBadAddress(t *testing.T) {
 	cfg := &SSL{Address: "invalid://127.0.0.1:8443", Port: 8443}
 
-	srv, err := NewHTTPSServer(http.NotFoundHandler(), cfg, nil, nil, discardLogger())
+	srv, err := NewHTTPSServer(http.NotFoundHandler(), cfg, nil, nil, nil, discardLogger())
 	require.NoError(t, err)
 
 	err = srv.Serve(map[string]api.Middleware{"known": &namedMiddleware{
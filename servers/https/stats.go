@@ -0,0 +1,303 @@
+package https
+
+import (
+	"crypto/tls"
+	stderr "errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/roadrunner-server/http/v6/acme"
+)
+
+const (
+	CertSourceFile string = "file"
+	CertSourceACME string = "acme"
+)
+
+// Handshake describes the negotiated parameters of a completed handshake.
+type Handshake struct {
+	Version string
+	Cipher  string
+	ALPN    string
+}
+
+// Certificate is a server certificate loaded by the https server.
+type Certificate struct {
+	Name     string
+	Source   string
+	NotAfter time.Time
+}
+
+// Stats contains TLS handshake counters and the certificates of the https server.
+type Stats struct {
+	// Handshakes is the number of completed handshakes.
+	Handshakes atomic.Uint64
+	// Resumed is the number of handshakes resumed from a session ticket.
+	Resumed atomic.Uint64
+
+	mu         sync.Mutex
+	handshakes map[Handshake]uint64
+	failures   map[string]uint64
+	certs      []Certificate
+	// ACME issuance stats, nil without ACME
+	acme *acme.Stats
+}
+
+func NewStats() *Stats {
+	return &Stats{
+		handshakes: make(map[Handshake]uint64),
+		failures:   make(map[string]uint64),
+	}
+}
+
+// HandshakesBy returns the completed handshakes counters by the negotiated parameters.
+func (s *Stats) HandshakesBy() map[Handshake]uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make(map[Handshake]uint64, len(s.handshakes))
+	for k, v := range s.handshakes {
+		out[k] = v
+	}
+
+	return out
+}
+
+// Failures returns the failed handshakes counters by reason.
+func (s *Stats) Failures() map[string]uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make(map[string]uint64, len(s.failures))
+	for k, v := range s.failures {
+		out[k] = v
+	}
+
+	return out
+}
+
+// Certificates returns the file based and ACME managed server certificates.
+func (s *Stats) Certificates() []Certificate {
+	s.mu.Lock()
+	certs := append([]Certificate(nil), s.certs...)
+	acmeStats := s.acme
+	s.mu.Unlock()
+
+	if acmeStats != nil {
+		for _, c := range acmeStats.Certificates() {
+			certs = append(certs, Certificate{Name: c.Name, Source: CertSourceACME, NotAfter: c.NotAfter})
+		}
+	}
+
+	return certs
+}
+
+// ACME returns the ACME issuance stats, nil without ACME.
+func (s *Stats) ACME() *acme.Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.acme
+}
+
+// SetACME attaches the ACME issuance stats of the certificates shared with the other server.
+func (s *Stats) SetACME(acmeStats *acme.Stats) {
+	s.mu.Lock()
+	s.acme = acmeStats
+	s.mu.Unlock()
+}
+
+// AddCertificate records a file based server certificate, certificates without the parsed leaf are skipped.
+func (s *Stats) AddCertificate(cert *tls.Certificate) {
+	if cert.Leaf == nil {
+		return
+	}
+
+	name := cert.Leaf.Subject.CommonName
+	if len(cert.Leaf.DNSNames) > 0 {
+		name = cert.Leaf.DNSNames[0]
+	}
+
+	s.mu.Lock()
+	s.certs = append(s.certs, Certificate{Name: name, Source: CertSourceFile, NotAfter: cert.Leaf.NotAfter})
+	s.mu.Unlock()
+}
+
+// AddHandshake records a completed handshake.
+func (s *Stats) AddHandshake(cs *tls.ConnectionState) {
+	s.Handshakes.Add(1)
+	if cs.DidResume {
+		s.Resumed.Add(1)
+	}
+
+	hs := Handshake{
+		Version: tls.VersionName(cs.Version),
+		Cipher:  tls.CipherSuiteName(cs.CipherSuite),
+		ALPN:    cs.NegotiatedProtocol,
+	}
+
+	s.mu.Lock()
+	s.handshakes[hs]++
+	s.mu.Unlock()
+}
+
+// AddFailure records a failed handshake.
+func (s *Stats) AddFailure(reason string) {
+	s.mu.Lock()
+	s.failures[reason]++
+	s.mu.Unlock()
+}
+
+// CountHandshakes records every completed handshake into stats, chaining the previous VerifyConnection (if any).
+func CountHandshakes(tlsCfg *tls.Config, stats *Stats) {
+	next := tlsCfg.VerifyConnection
+	tlsCfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		if next != nil {
+			err := next(cs)
+			if err != nil {
+				return err
+			}
+		}
+
+		stats.AddHandshake(&cs)
+
+		return nil
+	}
+}
+
+// countFailures records the failed handshakes, chaining the previous ConnState (if any). net/http closes the
+// connection right after a failed handshake, the tls.Conn keeps the handshake error.
+func countFailures(srv *http.Server, stats *Stats) {
+	markCertificateErrors(srv.TLSConfig)
+
+	next := srv.ConnState
+	srv.ConnState = func(c net.Conn, state http.ConnState) {
+		if next != nil {
+			next(c, state)
+		}
+
+		if state != http.StateClosed {
+			return
+		}
+
+		tc, ok := c.(*tls.Conn)
+		if !ok || tc.ConnectionState().HandshakeComplete {
+			return
+		}
+
+		// returns the cached error of the failed handshake, the connection is already closed
+		err := tc.Handshake()
+		if err != nil {
+			stats.AddFailure(failureReason(err))
+		}
+	}
+}
+
+// certificateError is the error of GetCertificate, e.g. ACME could not provide a certificate for the requested name.
+type certificateError struct {
+	err error
+}
+
+func (e *certificateError) Error() string {
+	return e.err.Error()
+}
+
+func (e *certificateError) Unwrap() error {
+	return e.err
+}
+
+// markCertificateErrors wraps the GetCertificate errors, crypto/tls returns them as is.
+func markCertificateErrors(tlsCfg *tls.Config) {
+	next := tlsCfg.GetCertificate
+	if next == nil {
+		return
+	}
+
+	tlsCfg.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		cert, err := next(hello)
+		if err != nil {
+			return nil, &certificateError{err: err}
+		}
+
+		return cert, nil
+	}
+}
+
+// the alerts sent by the server, wrapped into the handshake errors of the QUIC connections (RFC 8446)
+var alertReasons = map[tls.AlertError]string{
+	70:  "protocol_version",
+	112: "server_certificate",
+	116: "client_certificate",
+	120: "alpn",
+}
+
+// failureReason maps the handshake error to a low cardinality reason.
+func failureReason(err error) string {
+	var recordErr tls.RecordHeaderError
+	var verifyErr *tls.CertificateVerificationError
+	var certErr *certificateError
+	var echErr *tls.ECHRejectionError
+	var alertErr tls.AlertError
+	var opErr *net.OpError
+	var netErr net.Error
+
+	switch {
+	case stderr.As(err, &recordErr):
+		if looksLikeHTTP(recordErr.RecordHeader) {
+			return "plain_http"
+		}
+
+		return "other"
+	case stderr.As(err, &verifyErr):
+		return "client_certificate"
+	case stderr.As(err, &certErr):
+		return "server_certificate"
+	case stderr.As(err, &echErr):
+		return "ech_rejected"
+	case stderr.As(err, &alertErr) && alertReasons[alertErr] != "":
+		return alertReasons[alertErr]
+	case stderr.As(err, &opErr) && opErr.Op == "remote error":
+		// alert sent by the client, e.g. our certificate is not trusted
+		return "remote_alert"
+	case stderr.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case stderr.Is(err, io.EOF),
+		stderr.Is(err, io.ErrUnexpectedEOF),
+		stderr.Is(err, net.ErrClosed),
+		stderr.Is(err, syscall.ECONNRESET),
+		stderr.Is(err, syscall.EPIPE):
+		return "connection_closed"
+	}
+
+	// crypto/tls rejects the ClientHello and the missing client certificate with untyped errors,
+	// TestFailureReason_Handshakes pins the messages
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "client didn't provide a certificate"):
+		return "client_certificate"
+	case strings.Contains(msg, "unsupported versions"):
+		return "protocol_version"
+	case strings.Contains(msg, "no cipher suite"):
+		return "cipher_suite"
+	case strings.Contains(msg, "unsupported application protocols"):
+		return "alpn"
+	default:
+		return "other"
+	}
+}
+
+// looksLikeHTTP reports whether the record header is the start of a plain HTTP request, the same check as net/http.
+func looksLikeHTTP(hdr [5]byte) bool {
+	switch string(hdr[:]) {
+	case "GET /", "HEAD ", "POST ", "PUT /", "OPTIO":
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,235 @@
+package https
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFailureReason(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{tls.RecordHeaderError{RecordHeader: [5]byte{'G', 'E', 'T', ' ', '/'}}, "plain_http"},
+		{tls.RecordHeaderError{RecordHeader: [5]byte{'S', 'S', 'H', '-', '2'}}, "other"},
+		{&tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}, "client_certificate"},
+		{errors.New("tls: client didn't provide a certificate"), "client_certificate"},
+		{&net.OpError{Op: "remote error", Err: errors.New("tls: bad certificate")}, "remote_alert"},
+		{errors.New("tls: client offered only unsupported versions: [302 301]"), "protocol_version"},
+		{errors.New("tls: no cipher suite supported by both client and server; client offered: [2f]"), "cipher_suite"},
+		{errors.New(`tls: client requested unsupported application protocols (["spdy/3"])`), "alpn"},
+		{&certificateError{err: errors.New("no certificate available for 'unknown.com'")}, "server_certificate"},
+		{&tls.ECHRejectionError{}, "ech_rejected"},
+		{fmt.Errorf("tls: client offered only unsupported versions: [303]%.0w", tls.AlertError(70)), "protocol_version"},
+		{fmt.Errorf("tls: handshake failure%.0w", tls.AlertError(40)), "other"},
+		{&net.OpError{Op: "read", Err: os.ErrDeadlineExceeded}, "timeout"},
+		{io.EOF, "connection_closed"},
+		{&net.OpError{Op: "read", Err: syscall.ECONNRESET}, "connection_closed"},
+		{errors.New("tls: unexpected message"), "other"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			assert.Equal(t, tt.want, failureReason(tt.err))
+		})
+	}
+}
+
+// The untyped crypto/tls errors are pinned by the real handshakes, a Go upgrade changing the messages fails here.
+func TestFailureReason_Handshakes(t *testing.T) {
+	chain := writeTestChain(t)
+	cert, err := tls.LoadX509KeyPair(chain.cert, chain.key)
+	require.NoError(t, err)
+
+	pool, err := createCertPool(chain.rootCA)
+	require.NoError(t, err)
+
+	server := func(modify func(cfg *tls.Config)) *tls.Config {
+		cfg := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+		if modify != nil {
+			modify(cfg)
+		}
+		markCertificateErrors(cfg)
+		return cfg
+	}
+
+	tests := []struct {
+		name   string
+		server *tls.Config
+		client *tls.Config
+	}{
+		{
+			name:   "protocol_version",
+			server: server(func(cfg *tls.Config) { cfg.MinVersion = tls.VersionTLS13 }),
+			client: &tls.Config{InsecureSkipVerify: true, MaxVersion: tls.VersionTLS12}, //nolint:gosec
+		},
+		{
+			name: "cipher_suite",
+			server: server(func(cfg *tls.Config) {
+				cfg.MaxVersion = tls.VersionTLS12
+				cfg.CipherSuites = []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}
+			}),
+			client: &tls.Config{ //nolint:gosec
+				InsecureSkipVerify: true,
+				MaxVersion:         tls.VersionTLS12,
+				CipherSuites:       []uint16{tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256},
+			},
+		},
+		{
+			name: "client_certificate",
+			server: server(func(cfg *tls.Config) {
+				cfg.ClientCAs = pool
+				cfg.ClientAuth = tls.RequireAndVerifyClientCert
+			}),
+			client: &tls.Config{InsecureSkipVerify: true}, //nolint:gosec
+		},
+		{
+			name:   "alpn",
+			server: server(func(cfg *tls.Config) { cfg.NextProtos = []string{"h2"} }),
+			client: &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"spdy/3"}}, //nolint:gosec
+		},
+		{
+			name: "server_certificate",
+			server: server(func(cfg *tls.Config) {
+				cfg.Certificates = nil
+				cfg.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+					return nil, errors.New("no certificate available")
+				}
+			}),
+			client: &tls.Config{InsecureSkipVerify: true}, //nolint:gosec
+		},
+		{
+			// the client does not trust the test CA
+			name:   "remote_alert",
+			server: server(nil),
+			client: &tls.Config{ServerName: "localhost", RootCAs: x509.NewCertPool(), MinVersion: tls.VersionTLS12},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// net.Pipe is not buffered, the alerts sent by both sides would block
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			t.Cleanup(func() { _ = l.Close() })
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				cc, errD := net.Dial("tcp", l.Addr().String())
+				if errD != nil {
+					return
+				}
+				_ = tls.Client(cc, tt.client).Handshake()
+				_ = cc.Close()
+			}()
+
+			sc, err := l.Accept()
+			require.NoError(t, err)
+
+			err = tls.Server(sc, tt.server).Handshake()
+			_ = sc.Close()
+			<-done
+
+			require.Error(t, err)
+			assert.Equal(t, tt.name, failureReason(err), err.Error())
+		})
+	}
+}
+
+// The failed handshakes are classified from the handshake error kept by the closed connection.
+func TestNewHTTPSServer_CountsHandshakeFailures(t *testing.T) {
+	chain := writeTestChain(t)
+	cert, err := tls.LoadX509KeyPair(chain.cert, chain.key)
+	require.NoError(t, err)
+
+	srv, err := NewHTTPSServer(http.NotFoundHandler(), &SSL{Address: "127.0.0.1:8443", Port: 8443}, nil, nil, log.New(io.Discard, "", 0), discardLogger())
+	require.NoError(t, err)
+
+	https := srv.Server().(*http.Server)
+	https.TLSConfig.Certificates = []tls.Certificate{cert}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = https.Serve(tls.NewListener(l, https.TLSConfig)) }()
+	t.Cleanup(func() { _ = https.Close() })
+
+	addr := l.Addr().String()
+
+	resp, err := http.Get("http://" + addr) //nolint:noctx
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+
+	_, err = tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true, MinVersion: tls.VersionTLS10, MaxVersion: tls.VersionTLS10}) //nolint:gosec
+	require.Error(t, err)
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	_ = conn.Close()
+
+	// the completed handshake is not a failure
+	tc, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true}) //nolint:gosec
+	require.NoError(t, err)
+	_ = tc.Close()
+
+	want := map[string]uint64{"plain_http": 1, "protocol_version": 1, "connection_closed": 1}
+	stats := srv.(*Server).Stats()
+	assert.Eventually(t, func() bool {
+		return maps.Equal(want, stats.Failures()) && stats.Handshakes.Load() == 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestStats_Handshakes(t *testing.T) {
+	stats := NewStats()
+	stats.AddHandshake(&tls.ConnectionState{Version: tls.VersionTLS13, CipherSuite: tls.TLS_AES_256_GCM_SHA384, NegotiatedProtocol: "h2"})
+	stats.AddHandshake(&tls.ConnectionState{Version: tls.VersionTLS13, CipherSuite: tls.TLS_AES_256_GCM_SHA384, NegotiatedProtocol: "h2", DidResume: true})
+	stats.AddHandshake(&tls.ConnectionState{Version: tls.VersionTLS12, CipherSuite: tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256})
+
+	assert.Equal(t, uint64(3), stats.Handshakes.Load())
+	assert.Equal(t, uint64(1), stats.Resumed.Load())
+	assert.Equal(t, map[Handshake]uint64{
+		{Version: "TLS 1.3", Cipher: "TLS_AES_256_GCM_SHA384", ALPN: "h2"}:                2,
+		{Version: "TLS 1.2", Cipher: "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", ALPN: ""}: 1,
+	}, stats.HandshakesBy())
+}
+
+func TestStats_Certificates(t *testing.T) {
+	notAfter := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	stats := NewStats()
+	stats.AddCertificate(&tls.Certificate{Leaf: &x509.Certificate{DNSNames: []string{"example.com", "www.example.com"}, NotAfter: notAfter}})
+	// not parsed certificates are skipped
+	stats.AddCertificate(&tls.Certificate{})
+
+	assert.Equal(t, []Certificate{{Name: "example.com", Source: CertSourceFile, NotAfter: notAfter}}, stats.Certificates())
+	assert.Nil(t, stats.ACME())
+}
+
+// tls.LoadX509KeyPair fills the leaf, so the certificate loaded by Serve is reported with its expiry.
+func TestStats_LoadedKeyPair(t *testing.T) {
+	chain := writeTestChain(t)
+	cert, err := tls.LoadX509KeyPair(chain.cert, chain.key)
+	require.NoError(t, err)
+
+	stats := NewStats()
+	stats.AddCertificate(&cert)
+
+	certs := stats.Certificates()
+	require.Len(t, certs, 1)
+	assert.Equal(t, "localhost", certs[0].Name)
+	assert.Equal(t, cert.Leaf.NotAfter, certs[0].NotAfter)
+}
@@ -0,0 +1,156 @@
+package https
+
+import (
+	"crypto/tls"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/roadrunner-server/errors"
+)
+
+// ticketKeySize is the size of the key accepted by tls.Config.SetSessionTicketKeys
+const ticketKeySize = 32
+
+// ticketKeys keeps the session ticket keys of the tls.Config in sync with the key material on disk.
+type ticketKeys struct {
+	cfg    *SessionTickets
+	tlsCfg *tls.Config
+	log    *slog.Logger
+	// keys applied last time
+	current [][ticketKeySize]byte
+}
+
+// apply loads the keys and updates the tls.Config when they were changed.
+func (tk *ticketKeys) apply() error {
+	keys, err := loadTicketKeys(tk.cfg)
+	if err != nil {
+		return err
+	}
+
+	if slices.Equal(keys, tk.current) {
+		return nil
+	}
+
+	tk.tlsCfg.SetSessionTicketKeys(keys)
+	tk.current = keys
+	tk.log.Debug("session ticket keys were updated", "keys", len(keys))
+
+	return nil
+}
+
+// rotate reloads the keys every ReloadInterval until the stop channel is closed.
+func (tk *ticketKeys) rotate(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(tk.cfg.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			err := tk.apply()
+			if err != nil {
+				// keep the previous keys, the resumption continues to work on this node
+				tk.log.Error("session ticket keys reload", "error", err)
+			}
+		}
+	}
+}
+
+// loadTicketKeys reads the keys from the key file or from the keys directory.
+// In the directory mode, files are ordered by the modification time (newest first), hidden files and
+// subdirectories (e.g. ..data in the kubernetes secrets) are skipped.
+func loadTicketKeys(cfg *SessionTickets) ([][ticketKeySize]byte, error) {
+	const op = errors.Op("session_ticket_keys_load")
+
+	if cfg.KeyFile != "" {
+		data, err := os.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return nil, errors.E(op, err)
+		}
+
+		keys, err := splitTicketKeys(data, cfg.KeyFile)
+		if err != nil {
+			return nil, errors.E(op, err)
+		}
+
+		return keys, nil
+	}
+
+	entries, err := os.ReadDir(cfg.KeysDir)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	type keyFile struct {
+		name    string
+		modTime time.Time
+		keys    [][ticketKeySize]byte
+	}
+
+	files := make([]keyFile, 0, len(entries))
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		path := filepath.Join(cfg.KeysDir, entry.Name())
+		// follow symlinks
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, errors.E(op, err)
+		}
+
+		if info.IsDir() {
+			continue
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.E(op, err)
+		}
+
+		keys, err := splitTicketKeys(data, path)
+		if err != nil {
+			return nil, errors.E(op, err)
+		}
+
+		files = append(files, keyFile{name: entry.Name(), modTime: info.ModTime(), keys: keys})
+	}
+
+	if len(files) == 0 {
+		return nil, errors.E(op, errors.Errorf("no session ticket keys found in '%s'", cfg.KeysDir))
+	}
+
+	slices.SortFunc(files, func(a, b keyFile) int {
+		if c := b.modTime.Compare(a.modTime); c != 0 {
+			return c
+		}
+		return strings.Compare(a.name, b.name)
+	})
+
+	keys := make([][ticketKeySize]byte, 0, len(files))
+	for _, f := range files {
+		keys = append(keys, f.keys...)
+	}
+
+	return keys, nil
+}
+
+// splitTicketKeys splits raw key material into 32-byte keys.
+func splitTicketKeys(data []byte, path string) ([][ticketKeySize]byte, error) {
+	if len(data) == 0 || len(data)%ticketKeySize != 0 {
+		return nil, errors.Errorf("session ticket key file '%s' should contain one or more %d-byte keys, got %d bytes", path, ticketKeySize, len(data))
+	}
+
+	keys := make([][ticketKeySize]byte, 0, len(data)/ticketKeySize)
+	for chunk := range slices.Chunk(data, ticketKeySize) {
+		keys = append(keys, [ticketKeySize]byte(chunk))
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,210 @@
+package https
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeKeyFile(t *testing.T, path string, fill ...byte) {
+	t.Helper()
+
+	data := make([]byte, 0, len(fill)*ticketKeySize)
+	for _, b := range fill {
+		data = append(data, bytes.Repeat([]byte{b}, ticketKeySize)...)
+	}
+
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+}
+
+func TestLoadTicketKeys_KeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tickets.key")
+	writeKeyFile(t, path, 1, 2)
+
+	keys, err := loadTicketKeys(&SessionTickets{KeyFile: path})
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.Equal(t, byte(1), keys[0][0])
+	assert.Equal(t, byte(2), keys[1][0])
+}
+
+func TestLoadTicketKeys_MalformedKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tickets.key")
+	require.NoError(t, os.WriteFile(path, []byte("short"), 0o600))
+
+	_, err := loadTicketKeys(&SessionTickets{KeyFile: path})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "32-byte keys")
+}
+
+// The newest file encrypts, hidden entries and subdirectories are ignored.
+func TestLoadTicketKeys_KeysDirOrderedByModTime(t *testing.T) {
+	dir := t.TempDir()
+	writeKeyFile(t, filepath.Join(dir, "old.key"), 1)
+	writeKeyFile(t, filepath.Join(dir, "new.key"), 2)
+	writeKeyFile(t, filepath.Join(dir, ".hidden"), 3)
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "..data"), 0o700))
+
+	past := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "old.key"), past, past))
+
+	keys, err := loadTicketKeys(&SessionTickets{KeysDir: dir})
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.Equal(t, byte(2), keys[0][0])
+	assert.Equal(t, byte(1), keys[1][0])
+}
+
+func TestLoadTicketKeys_EmptyKeysDir(t *testing.T) {
+	_, err := loadTicketKeys(&SessionTickets{KeysDir: t.TempDir()})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no session ticket keys found")
+}
+
+func TestSessionTickets_Valid(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "tickets.key")
+	writeKeyFile(t, keyFile, 1)
+
+	tests := []struct {
+		name    string
+		cfg     SessionTickets
+		wantErr string
+	}{
+		{"disabled", SessionTickets{Disabled: true}, ""},
+		{"disabled with keys", SessionTickets{Disabled: true, KeyFile: keyFile}, "should not be set"},
+		{"no source", SessionTickets{}, "should have key_file or keys_dir"},
+		{"both sources", SessionTickets{KeyFile: keyFile, KeysDir: t.TempDir()}, "only one of"},
+		{"missing file", SessionTickets{KeyFile: filepath.Join(t.TempDir(), "absent")}, "no such file"},
+		{"key file", SessionTickets{KeyFile: keyFile}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Valid()
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestNewHTTPSServer_SessionTicketsDisabled(t *testing.T) {
+	https := newTestServer(t, &SSL{Address: "127.0.0.1:8443", Port: 8443, SessionTickets: &SessionTickets{Disabled: true}}, nil)
+	assert.True(t, https.TLSConfig.SessionTicketsDisabled)
+}
+
+// handshake performs a TLS handshake against srvCfg and reports whether the session was resumed.
+func handshake(t *testing.T, srvCfg *tls.Config, clientCfg *tls.Config) bool {
+	t.Helper()
+
+	srvConn, cliConn := net.Pipe()
+	errCh := make(chan error, 1)
+	go func() {
+		conn := tls.Server(srvConn, srvCfg)
+		err := conn.Handshake()
+		if err == nil {
+			// the client reads the session ticket together with this byte
+			_, err = conn.Write([]byte{1})
+		}
+		_ = conn.Close()
+		errCh <- err
+	}()
+
+	conn := tls.Client(cliConn, clientCfg)
+	require.NoError(t, conn.Handshake())
+	_, err := conn.Read(make([]byte, 1))
+	require.NoError(t, err)
+	resumed := conn.ConnectionState().DidResume
+	_ = conn.Close()
+	require.NoError(t, <-errCh)
+
+	return resumed
+}
+
+// Two servers sharing the key file resume each other's sessions, a server with other keys does not.
+func TestSessionTickets_ResumedAcrossServers(t *testing.T) {
+	chain := writeTestChain(t)
+	cert, err := tls.LoadX509KeyPair(chain.cert, chain.key)
+	require.NoError(t, err)
+	caPEM, err := os.ReadFile(chain.rootCA)
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM(caPEM))
+
+	dir := t.TempDir()
+	shared := filepath.Join(dir, "shared.key")
+	other := filepath.Join(dir, "other.key")
+	writeKeyFile(t, shared, 7)
+	writeKeyFile(t, other, 9)
+
+	newServer := func(keyFile string) (*tls.Config, *Stats) {
+		cfg := &SSL{Address: "127.0.0.1:8443", Port: 8443, SessionTickets: &SessionTickets{KeyFile: keyFile, ReloadInterval: time.Minute}}
+		srv, err := NewHTTPSServer(http.NotFoundHandler(), cfg, nil, nil, nil, discardLogger())
+		require.NoError(t, err)
+		t.Cleanup(srv.Stop)
+
+		https := srv.Server().(*http.Server)
+		https.TLSConfig.Certificates = []tls.Certificate{cert}
+		return https.TLSConfig, srv.(*Server).Stats()
+	}
+
+	firstCfg, firstStats := newServer(shared)
+	secondCfg, secondStats := newServer(shared)
+	otherCfg, _ := newServer(other)
+
+	clientCfg := &tls.Config{
+		RootCAs:            roots,
+		ServerName:         "localhost",
+		ClientSessionCache: tls.NewLRUClientSessionCache(1),
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	assert.False(t, handshake(t, firstCfg, clientCfg))
+	assert.True(t, handshake(t, secondCfg, clientCfg))
+	assert.False(t, handshake(t, otherCfg, clientCfg))
+
+	assert.Equal(t, uint64(1), firstStats.Handshakes.Load())
+	assert.Equal(t, uint64(0), firstStats.Resumed.Load())
+	assert.Equal(t, uint64(1), secondStats.Resumed.Load())
+}
+
+func TestTicketKeys_ApplyPicksUpRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tickets.key")
+	writeKeyFile(t, path, 1)
+
+	tk := &ticketKeys{cfg: &SessionTickets{KeyFile: path}, tlsCfg: &tls.Config{MinVersion: tls.VersionTLS12}, log: discardLogger()}
+	require.NoError(t, tk.apply())
+	require.Len(t, tk.current, 1)
+
+	// new key first, the old one still decrypts issued tickets
+	writeKeyFile(t, path, 2, 1)
+	require.NoError(t, tk.apply())
+	require.Len(t, tk.current, 2)
+	assert.Equal(t, byte(2), tk.current[0][0])
+
+	// broken key material keeps the previous keys
+	require.NoError(t, os.WriteFile(path, []byte("broken"), 0o600))
+	require.Error(t, tk.apply())
+	assert.Len(t, tk.current, 2)
+}
+
+func TestNextProtos(t *testing.T) {
+	srv := &http.Server{TLSConfig: &tls.Config{NextProtos: []string{"acme-tls/1"}, MinVersion: tls.VersionTLS12}, ReadHeaderTimeout: time.Minute}
+	assert.Equal(t, []string{"acme-tls/1", "h2", "http/1.1"}, nextProtos(srv))
+
+	srv.TLSConfig.NextProtos = []string{"h2", "http/1.1"}
+	srv.Protocols = alpnProtocols([]string{"http/1.1"})
+	assert.Equal(t, []string{"http/1.1"}, nextProtos(srv))
+}
@@ -0,0 +1,135 @@
+package tlsconf
+
+import (
+	"crypto/tls"
+	"slices"
+	"strings"
+
+	"github.com/roadrunner-server/errors"
+)
+
+// supported protocol versions, TLS 1.0 and 1.1 are intentionally not configurable
+var versions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// supported key exchange mechanisms, keys are lowercase
+var curves = map[string]tls.CurveID{
+	"x25519":             tls.X25519,
+	"p256":               tls.CurveP256,
+	"p384":               tls.CurveP384,
+	"p521":               tls.CurveP521,
+	"x25519mlkem768":     tls.X25519MLKEM768,
+	"secp256r1mlkem768":  tls.SecP256r1MLKEM768,
+	"secp384r1mlkem1024": tls.SecP384r1MLKEM1024,
+}
+
+// Policy describes the negotiable TLS parameters of a listener. Zero values keep DefaultTLSConfig untouched.
+type Policy struct {
+	// MinVersion is the minimum TLS version: 1.2 (default) or 1.3.
+	MinVersion string `mapstructure:"min_version"`
+	// MaxVersion is the maximum TLS version: 1.2 or 1.3 (default).
+	MaxVersion string `mapstructure:"max_version"`
+	// CipherSuites is the list of TLS 1.2 cipher suites in Go naming (e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256).
+	// TLS 1.3 suites are not configurable.
+	CipherSuites []string `mapstructure:"cipher_suites"`
+	// CurvePreferences is the ordered list of key exchange mechanisms,
+	// supported values: x25519, p256, p384, p521, x25519mlkem768, secp256r1mlkem768, secp384r1mlkem1024.
+	CurvePreferences []string `mapstructure:"curve_preferences"`
+	// ALPN is the ordered list of application protocols to advertise.
+	ALPN []string `mapstructure:"alpn"`
+}
+
+// Valid checks that every configured value is known and the versions range is consistent.
+func (p *Policy) Valid() error {
+	_, err := p.TLSConfig()
+	return err
+}
+
+// TLSConfig returns DefaultTLSConfig with the policy applied.
+func (p *Policy) TLSConfig() (*tls.Config, error) {
+	const op = errors.Op("tls_policy")
+
+	cfg := DefaultTLSConfig()
+
+	if p.MinVersion != "" {
+		v, ok := versions[p.MinVersion]
+		if !ok {
+			return nil, errors.E(op, errors.Errorf("unsupported min_version '%s', supported: 1.2, 1.3", p.MinVersion))
+		}
+		cfg.MinVersion = v
+	}
+
+	if p.MaxVersion != "" {
+		v, ok := versions[p.MaxVersion]
+		if !ok {
+			return nil, errors.E(op, errors.Errorf("unsupported max_version '%s', supported: 1.2, 1.3", p.MaxVersion))
+		}
+		cfg.MaxVersion = v
+	}
+
+	if cfg.MaxVersion != 0 && cfg.MaxVersion < cfg.MinVersion {
+		return nil, errors.E(op, errors.Errorf("max_version '%s' is lower than min_version", p.MaxVersion))
+	}
+
+	if len(p.CipherSuites) > 0 {
+		if cfg.MinVersion == tls.VersionTLS13 {
+			return nil, errors.E(op, errors.Str("cipher_suites has no effect with min_version 1.3, TLS 1.3 suites are not configurable"))
+		}
+
+		suites := make([]uint16, 0, len(p.CipherSuites))
+		for _, name := range p.CipherSuites {
+			id, err := cipherSuite(name)
+			if err != nil {
+				return nil, errors.E(op, err)
+			}
+			suites = append(suites, id)
+		}
+		cfg.CipherSuites = suites
+	}
+
+	if len(p.CurvePreferences) > 0 {
+		ids := make([]tls.CurveID, 0, len(p.CurvePreferences))
+		for _, name := range p.CurvePreferences {
+			id, ok := curves[strings.ToLower(name)]
+			if !ok {
+				return nil, errors.E(op, errors.Errorf("unsupported curve '%s'", name))
+			}
+			if slices.Contains(ids, id) {
+				return nil, errors.E(op, errors.Errorf("duplicate curve '%s'", name))
+			}
+			ids = append(ids, id)
+		}
+		cfg.CurvePreferences = ids
+	}
+
+	for _, proto := range p.ALPN {
+		if proto == "" {
+			return nil, errors.E(op, errors.Str("alpn protocol could not be empty"))
+		}
+	}
+
+	if len(p.ALPN) > 0 {
+		cfg.NextProtos = slices.Clone(p.ALPN)
+	}
+
+	return cfg, nil
+}
+
+// cipherSuite resolves a secure TLS 1.2 cipher suite by its Go name.
+func cipherSuite(name string) (uint16, error) {
+	for _, cs := range tls.CipherSuites() {
+		if cs.Name != name {
+			continue
+		}
+
+		if !slices.Contains(cs.SupportedVersions, tls.VersionTLS12) {
+			return 0, errors.Errorf("cipher suite '%s' is TLS 1.3 only and could not be configured", name)
+		}
+
+		return cs.ID, nil
+	}
+
+	return 0, errors.Errorf("unsupported or insecure cipher suite '%s'", name)
+}
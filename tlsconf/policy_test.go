@@ -0,0 +1,121 @@
+package tlsconf
+
+import (
+	"crypto/tls"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPolicyTLSConfig_EmptyPolicyKeepsDefaults(t *testing.T) {
+	cfg, err := (&Policy{}).TLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	def := DefaultTLSConfig()
+	if cfg.MinVersion != def.MinVersion || cfg.MaxVersion != def.MaxVersion {
+		t.Errorf("versions = %x-%x, want %x-%x", cfg.MinVersion, cfg.MaxVersion, def.MinVersion, def.MaxVersion)
+	}
+	if !slices.Equal(cfg.CipherSuites, def.CipherSuites) {
+		t.Errorf("CipherSuites = %v, want %v", cfg.CipherSuites, def.CipherSuites)
+	}
+	if !slices.Equal(cfg.CurvePreferences, def.CurvePreferences) {
+		t.Errorf("CurvePreferences = %v, want %v", cfg.CurvePreferences, def.CurvePreferences)
+	}
+	if cfg.NextProtos != nil {
+		t.Errorf("NextProtos = %v, want nil", cfg.NextProtos)
+	}
+}
+
+func TestPolicyTLSConfig_AppliesEveryOption(t *testing.T) {
+	cfg, err := (&Policy{
+		MinVersion:       "1.2",
+		MaxVersion:       "1.3",
+		CipherSuites:     []string{"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384"},
+		CurvePreferences: []string{"X25519MLKEM768", "x25519"},
+		ALPN:             []string{"h2", "http/1.1"},
+	}).TLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.MinVersion != tls.VersionTLS12 || cfg.MaxVersion != tls.VersionTLS13 {
+		t.Errorf("versions = %x-%x, want 1.2-1.3", cfg.MinVersion, cfg.MaxVersion)
+	}
+	if !slices.Equal(cfg.CipherSuites, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384}) {
+		t.Errorf("CipherSuites = %v", cfg.CipherSuites)
+	}
+	if !slices.Equal(cfg.CurvePreferences, []tls.CurveID{tls.X25519MLKEM768, tls.X25519}) {
+		t.Errorf("CurvePreferences = %v", cfg.CurvePreferences)
+	}
+	if !slices.Equal(cfg.NextProtos, []string{"h2", "http/1.1"}) {
+		t.Errorf("NextProtos = %v", cfg.NextProtos)
+	}
+}
+
+func TestPolicyValid_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  Policy
+		wantErr string
+	}{
+		{
+			name:    "legacy min version",
+			policy:  Policy{MinVersion: "1.0"},
+			wantErr: "unsupported min_version",
+		},
+		{
+			name:    "unknown max version",
+			policy:  Policy{MaxVersion: "2.0"},
+			wantErr: "unsupported max_version",
+		},
+		{
+			name:    "inverted range",
+			policy:  Policy{MinVersion: "1.3", MaxVersion: "1.2"},
+			wantErr: "lower than min_version",
+		},
+		{
+			name:    "suites with tls 1.3 only",
+			policy:  Policy{MinVersion: "1.3", CipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}},
+			wantErr: "has no effect",
+		},
+		{
+			name:    "tls 1.3 suite",
+			policy:  Policy{CipherSuites: []string{"TLS_AES_128_GCM_SHA256"}},
+			wantErr: "TLS 1.3 only",
+		},
+		{
+			name:    "insecure suite",
+			policy:  Policy{CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}},
+			wantErr: "unsupported or insecure",
+		},
+		{
+			name:    "unknown curve",
+			policy:  Policy{CurvePreferences: []string{"p192"}},
+			wantErr: "unsupported curve",
+		},
+		{
+			name:    "duplicate curve",
+			policy:  Policy{CurvePreferences: []string{"x25519", "X25519"}},
+			wantErr: "duplicate curve",
+		},
+		{
+			name:    "empty alpn",
+			policy:  Policy{ALPN: []string{"h2", ""}},
+			wantErr: "alpn protocol could not be empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Valid()
+			if err == nil {
+				t.Fatalf("expected an error containing %q", tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}